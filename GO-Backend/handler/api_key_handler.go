@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"errors"
+	model "go-fiber-app/models"
+	"go-fiber-app/service"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" validate:"required" example:"nightly-sync"`
+	Scopes        []string `json:"scopes" validate:"required" example:"users:read"`
+	ExpiresInDays int      `json:"expires_in_days" example:"90"`
+}
+
+type APIKeyHandler struct {
+	apiKeyService *service.APIKeyService
+	events        *service.SecurityEventService
+}
+
+func NewAPIKeyHandler(apiKeyService *service.APIKeyService, events *service.SecurityEventService) *APIKeyHandler {
+	return &APIKeyHandler{apiKeyService: apiKeyService, events: events}
+}
+
+// CreateAPIKey godoc
+// @Summary      Create an API key
+// @Description  Create a named, scoped, expiring API key for the user. The raw key is only returned in this response.
+// @Description  Send it as "X-API-Key: <key>" or "Authorization: Bearer <key>".
+// @Tags         API Keys
+// @Accept       json
+// @Produce      json
+// @Param        id       path  string               true  "User ID"
+// @Param        request  body  CreateAPIKeyRequest  true  "Key name, scopes and lifetime (default from server config)"
+// @Success      201  {object}  map[string]interface{}
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /users/{id}/api-keys [post]
+func (h *APIKeyHandler) CreateAPIKey(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	creatorID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
+
+	var req CreateAPIKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.ExpiresInDays < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "expires_in_days cannot be negative"})
+	}
+
+	ttl := time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	key, raw, err := h.apiKeyService.CreateKey(userID, creatorID, req.Name, req.Scopes, ttl)
+	if err != nil {
+		return apiKeyError(c, err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Copy the key now; it will not be shown again.",
+		"key":     raw,
+		"api_key": key,
+	})
+}
+
+// ListAPIKeys godoc
+// @Summary      List API keys
+// @Description  List the user's API keys, including revoked and expired ones. Raw keys are never returned.
+// @Tags         API Keys
+// @Produce      json
+// @Param        id  path  string  true  "User ID"
+// @Success      200  {array}   model.APIKey
+// @Failure      400  {object}  map[string]string
+// @Router       /users/{id}/api-keys [get]
+func (h *APIKeyHandler) ListAPIKeys(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	keys, err := h.apiKeyService.ListKeys(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(keys)
+}
+
+// RevokeAPIKey godoc
+// @Summary      Revoke an API key
+// @Description  Revoke one of the user's API keys. It stops working immediately.
+// @Tags         API Keys
+// @Param        id     path  string  true  "User ID"
+// @Param        keyId  path  string  true  "API key ID"
+// @Success      204  "No Content"
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /users/{id}/api-keys/{keyId} [delete]
+func (h *APIKeyHandler) RevokeAPIKey(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	keyID, err := primitive.ObjectIDFromHex(c.Params("keyId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid API key ID"})
+	}
+
+	if err := h.apiKeyService.RevokeKey(userID, keyID); err != nil {
+		return apiKeyError(c, err)
+	}
+	event := securityEvent(c, model.EventTokenRevoked, nil, "API key "+keyID.Hex()+" revoked")
+	event.UserID = userID.Hex()
+	h.events.Record(event)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func apiKeyError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrAPIKeyNameMissing), errors.Is(err, service.ErrInvalidScope), errors.Is(err, service.ErrInvalidExpiry):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Not found"})
+	default:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+}
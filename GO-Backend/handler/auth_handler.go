@@ -1,13 +1,16 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
+	model "go-fiber-app/models"
 	"go-fiber-app/service"
-	"os"
-	"time"
+	"strconv"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type AuthRequest struct {
@@ -15,17 +18,37 @@ type AuthRequest struct {
 	Password string `json:"password"`
 }
 
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
 type AuthHandler struct {
-	userService *service.UserService
+	userService         *service.UserService
+	tokenService        *service.TokenService
+	loginGuard          *service.LoginGuard
+	verificationService *service.EmailVerificationService
+	twoFactorService    *service.TwoFactorService
+	events              *service.SecurityEventService
+
+	oidcService           *service.OIDCService
+	oidcPostLoginRedirect string
 }
 
-func NewAuthHandler(userService *service.UserService) *AuthHandler {
-	return &AuthHandler{userService: userService}
+func NewAuthHandler(userService *service.UserService, tokenService *service.TokenService, loginGuard *service.LoginGuard, verificationService *service.EmailVerificationService, twoFactorService *service.TwoFactorService, events *service.SecurityEventService) *AuthHandler {
+	return &AuthHandler{
+		userService:         userService,
+		tokenService:        tokenService,
+		loginGuard:          loginGuard,
+		verificationService: verificationService,
+		twoFactorService:    twoFactorService,
+		events:              events,
+	}
 }
 
 // Login godoc
 // @Summary      User login
-// @Description  Authenticate user with email and password
+// @Description  Authenticate user with email and password. When 2FA is enabled the response carries
+// @Description  two_factor_required and a challenge_token for /api/auth/2fa/verify instead of tokens.
 // @Tags         Authentication
 // @Accept       json
 // @Produce      json
@@ -33,6 +56,9 @@ func NewAuthHandler(userService *service.UserService) *AuthHandler {
 // @Success      200 {object} map[string]interface{} "Login successful"
 // @Failure      400 {object} map[string]string "Invalid request"
 // @Failure      401 {object} map[string]string "Invalid credentials"
+// @Failure      403 {object} map[string]string "Email address not verified"
+// @Failure      423 {object} map[string]string "Account temporarily locked"
+// @Failure      429 {object} map[string]string "Too many failed attempts"
 // @Failure      500 {object} map[string]string "Internal server error"
 // @Router       /api/auth/login [post]
 func (h *AuthHandler) Login(c *fiber.Ctx) error {
@@ -42,35 +68,232 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	}
 
 	// Get user from database
-	user, err := h.userService.GetUserByEmail(req.Email)
-	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid credentials"})
+	var user *model.User
+	if found, err := h.userService.GetUserByEmail(req.Email); err == nil {
+		user = found
+	}
+
+	// Reject blocked emails, IPs and locked accounts before checking the password
+	ip := c.IP()
+	if err := h.loginGuard.Check(req.Email, ip, user); err != nil {
+		recordLoginFailure(h.events, c, req.Email, user, err.Error())
+		return loginGuardError(c, err)
 	}
 
-	// Check password (assuming you have password hashing)
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+	// Check password against whichever algorithm its hash was made with
+	if user == nil || !h.userService.VerifyPassword(user, req.Password) {
+		reason := "wrong password"
+		if user == nil {
+			reason = "unknown email"
+		}
+		recordLoginFailure(h.events, c, req.Email, user, reason)
+		if err := h.loginGuard.RecordFailure(req.Email, ip, user); err != nil {
+			recordLockout(h.events, c, user, err)
+			return loginGuardError(c, err)
+		}
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid credentials"})
 	}
 
-	// Create JWT token
-	claims := jwt.MapClaims{
-		"user_id": user.ID.Hex(),
-		"email":   user.Email,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(), // 24-hour token
+	// The plain password is only available now, so move old hashes to the current algorithm
+	if err := h.userService.UpgradePasswordHash(user, req.Password); err != nil {
+		fmt.Printf("Error upgrading password hash for user %s: %v\n", user.ID.Hex(), err)
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	secret := os.Getenv("JWT_SECRET")
-	signedToken, err := token.SignedString([]byte(secret))
+
+	body, err := h.completeLogin(c, user, "password")
 	if err != nil {
+		if errors.Is(err, errEmailNotVerified) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Please verify your email address before logging in"})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not login"})
 	}
+	return c.JSON(body)
+}
+
+var errEmailNotVerified = errors.New("email address not verified")
+
+// completeLogin runs the steps shared by every sign-in method once the user has
+// proved who they are: the verification policy, the 2FA challenge and token issuing
+func (h *AuthHandler) completeLogin(c *fiber.Ctx, user *model.User, method string) (fiber.Map, error) {
+	// Under the "block" policy unverified accounts cannot sign in at all
+	if !user.EmailVerified && h.verificationService.Policy() == service.VerificationBlock {
+		recordLoginFailure(h.events, c, user.Email, user, "email not verified")
+		return nil, errEmailNotVerified
+	}
+
+	// With 2FA enabled the first factor only earns a challenge for the second step
+	if user.TwoFactorEnabled {
+		challenge, err := h.twoFactorService.CreateChallenge(user)
+		if err != nil {
+			return nil, err
+		}
+		return fiber.Map{
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+			"expires_in":          int64(h.twoFactorService.ChallengeTTL().Seconds()),
+		}, nil
+	}
+
+	// Issue a short-lived access token and a refresh token
+	tokens, err := h.tokenService.IssueTokens(user, clientInfo(c))
+	if err != nil {
+		return nil, err
+	}
+	recordLoginSuccess(h.loginGuard, user)
+	h.events.Record(securityEvent(c, model.EventLoginSuccess, user, method))
+	return loginResponse(tokens, user), nil
+}
+
+// recordLoginSuccess clears the user's failed logins once tokens were issued. A
+// password alone does not clear them while a second factor is still owed.
+func recordLoginSuccess(guard *service.LoginGuard, user *model.User) {
+	if err := guard.RecordSuccess(user.Email); err != nil {
+		fmt.Printf("Error clearing failed logins for user %s: %v\n", user.ID.Hex(), err)
+	}
+}
+
+// recordLoginFailure logs a failed sign-in. The email is recorded even when no account has it.
+func recordLoginFailure(events *service.SecurityEventService, c *fiber.Ctx, email string, user *model.User, reason string) {
+	event := securityEvent(c, model.EventLoginFailure, user, reason)
+	if user == nil {
+		event.Email = strings.ToLower(strings.TrimSpace(email))
+	}
+	events.Record(event)
+}
+
+// recordLockout logs the account lock when the failure that was just counted caused one
+func recordLockout(events *service.SecurityEventService, c *fiber.Ctx, user *model.User, err error) {
+	var lockout *service.LockoutError
+	if user != nil && errors.As(err, &lockout) && lockout.AccountLocked {
+		events.Record(securityEvent(c, model.EventAccountLocked, user, "too many failed logins"))
+	}
+}
+
+// clientInfo describes the device making the request, for the session list
+func clientInfo(c *fiber.Ctx) service.ClientInfo {
+	return service.ClientInfo{IP: c.IP(), UserAgent: c.Get(fiber.HeaderUserAgent)}
+}
 
-	return c.JSON(fiber.Map{
-		"token": signedToken,
+// loginResponse is the body returned by every successful sign-in
+func loginResponse(tokens *service.TokenPair, user *model.User) fiber.Map {
+	return fiber.Map{
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
 		"user": fiber.Map{
-			"id":    user.ID.Hex(),
-			"email": user.Email,
-			"name":  user.Name,
+			"id":                 user.ID.Hex(),
+			"email":              user.Email,
+			"name":               user.Name,
+			"email_verified":     user.EmailVerified,
+			"two_factor_enabled": user.TwoFactorEnabled,
 		},
+	}
+}
+
+// Refresh godoc
+// @Summary      Refresh access token
+// @Description  Exchange a refresh token for a new access token and a rotated refresh token
+// @Tags         Authentication
+// @Accept       json
+// @Produce      json
+// @Param        request body RefreshRequest true "Refresh token"
+// @Success      200 {object} service.TokenPair
+// @Failure      400 {object} map[string]string "Invalid request"
+// @Failure      401 {object} map[string]string "Invalid, expired or reused refresh token"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Router       /api/auth/refresh [post]
+func (h *AuthHandler) Refresh(c *fiber.Ctx) error {
+	var req RefreshRequest
+	if err := c.BodyParser(&req); err != nil || req.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	tokens, _, err := h.tokenService.Refresh(req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, service.ErrRefreshTokenReused) {
+			h.events.Record(securityEvent(c, model.EventTokenRevoked, nil, "refresh token reused, session revoked"))
+		}
+		if errors.Is(err, service.ErrInvalidRefreshToken) || errors.Is(err, service.ErrRefreshTokenReused) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not refresh token"})
+	}
+
+	return c.JSON(tokens)
+}
+
+// Logout godoc
+// @Summary      Logout
+// @Description  End the session the refresh token belongs to, revoking its access and refresh tokens
+// @Tags         Authentication
+// @Accept       json
+// @Produce      json
+// @Param        request body RefreshRequest true "Refresh token"
+// @Success      204 "No Content"
+// @Failure      400 {object} map[string]string "Invalid request"
+// @Failure      401 {object} map[string]string "Unknown refresh token"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Router       /api/auth/logout [post]
+func (h *AuthHandler) Logout(c *fiber.Ctx) error {
+	var req RefreshRequest
+	if err := c.BodyParser(&req); err != nil || req.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	userID, err := h.tokenService.Revoke(req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRefreshToken) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not logout"})
+	}
+	event := securityEvent(c, model.EventTokenRevoked, nil, "logout")
+	event.UserID = userID.Hex()
+	h.events.Record(event)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// UnlockAccount godoc
+// @Summary      Unlock a user account
+// @Description  Clear a lockout caused by failed logins before it expires (admin only)
+// @Tags         Authentication
+// @Produce      json
+// @Param        id   path      string  true  "User ID"
+// @Success      200  {object}  model.User
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /users/{id}/unlock [post]
+func (h *AuthHandler) UnlockAccount(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	user, err := h.loginGuard.Unlock(userID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(user)
+}
+
+// loginGuardError turns a lockout into 423/429 with a Retry-After header
+func loginGuardError(c *fiber.Ctx, err error) error {
+	var lockout *service.LockoutError
+	if !errors.As(err, &lockout) {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not login"})
+	}
+
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(lockout.RetryAfterSeconds()))
+	status := fiber.StatusTooManyRequests
+	if lockout.AccountLocked {
+		status = fiber.StatusLocked
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"error":       lockout.Error(),
+		"retry_after": lockout.RetryAfterSeconds(),
 	})
 }
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	model "go-fiber-app/models"
+	"go-fiber-app/service"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// etag formats a record version as a strong entity tag
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// setETag sends the record version so the client can make a conditional request with it
+func setETag(c *fiber.Ctx, version int64) {
+	c.Set(fiber.HeaderETag, etag(version))
+}
+
+// setPhonesETag sends a weak entity tag for a list of phone numbers that changes
+// whenever one is added, changed or removed. Lists cannot be written as a whole, so
+// it only serves to tell whether the list changed; each phone's own version is its If-Match.
+func setPhonesETag(c *fiber.Ctx, phones []*model.PhoneNumber) {
+	hash := sha256.New()
+	for _, phone := range phones {
+		hash.Write([]byte(phone.ID.Hex() + ":" + strconv.FormatInt(phone.Version, 10) + ";"))
+	}
+	c.Set(fiber.HeaderETag, `W/"`+hex.EncodeToString(hash.Sum(nil)[:16])+`"`)
+}
+
+// parseIfMatch reads the If-Match header and reports whether it was sent. "*" accepts
+// any version. Weak tags never match, as If-Match uses strong comparison.
+func parseIfMatch(c *fiber.Ctx) (service.IfMatch, bool) {
+	header := strings.TrimSpace(c.Get(fiber.HeaderIfMatch))
+	if header == "" {
+		return nil, false
+	}
+	if header == "*" {
+		return nil, true
+	}
+	versions := service.IfMatch{}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+			continue
+		}
+		if version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64); err == nil {
+			versions = append(versions, version)
+		}
+	}
+	return versions, true
+}
+
+// preconditionRequired answers a write that did not say which version it expects to change
+func preconditionRequired(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusPreconditionRequired).JSON(fiber.Map{
+		"error": "If-Match is required; send the ETag from the last GET",
+	})
+}
+
+// preconditionFailed answers a write made against an outdated version with the current one
+func preconditionFailed(c *fiber.Ctx, version int64, current interface{}) error {
+	setETag(c, version)
+	return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{
+		"error":   "The record was changed since you read it",
+		"current": current,
+	})
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"go-fiber-app/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestParseIfMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   service.IfMatch
+		sent   bool
+	}{
+		{"missing", "", nil, false},
+		{"blank", "  ", nil, false},
+		{"any version", "*", nil, true},
+		{"one version", etag(4), service.IfMatch{4}, true},
+		{"several versions", `"4", "5" ,"6"`, service.IfMatch{4, 5, 6}, true},
+		{"weak tags never match", `W/"4"`, service.IfMatch{}, true},
+		{"unquoted and non-numeric tags are skipped", `4, "x", "", "5"`, service.IfMatch{5}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			var got service.IfMatch
+			var sent bool
+			app.Put("/", func(c *fiber.Ctx) error {
+				got, sent = parseIfMatch(c)
+				return nil
+			})
+			req := httptest.NewRequest("PUT", "/", nil)
+			if tt.header != "" {
+				req.Header.Set(fiber.HeaderIfMatch, tt.header)
+			}
+			if _, err := app.Test(req); err != nil {
+				t.Fatal(err)
+			}
+			if sent != tt.sent || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseIfMatch(%q) = %#v, %v, want %#v, %v", tt.header, got, sent, tt.want, tt.sent)
+			}
+		})
+	}
+}
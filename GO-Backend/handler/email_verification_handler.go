@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"errors"
+	"go-fiber-app/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" validate:"required,email" example:"john.doe@example.com"`
+}
+
+type EmailVerificationHandler struct {
+	verificationService *service.EmailVerificationService
+}
+
+func NewEmailVerificationHandler(verificationService *service.EmailVerificationService) *EmailVerificationHandler {
+	return &EmailVerificationHandler{verificationService: verificationService}
+}
+
+// VerifyEmail godoc
+// @Summary      Verify email address
+// @Description  Confirm an email address using the signed link sent on registration
+// @Tags         Authentication
+// @Produce      json
+// @Param        token  query     string  true  "Signed verification token"
+// @Success      200    {object}  map[string]interface{}
+// @Failure      400    {object}  map[string]string "Invalid or expired link"
+// @Failure      500    {object}  map[string]string "Internal server error"
+// @Router       /api/auth/verify-email [get]
+func (h *EmailVerificationHandler) VerifyEmail(c *fiber.Ctx) error {
+	token := c.Query("token")
+	if token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Token is required"})
+	}
+
+	user, err := h.verificationService.Verify(token)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidVerificationToken) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not verify email"})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Email verified successfully",
+		"email":   user.Email,
+	})
+}
+
+// ResendVerification godoc
+// @Summary      Resend verification email
+// @Description  Send a new verification link. Always returns 202 so account existence is not revealed.
+// @Tags         Authentication
+// @Accept       json
+// @Produce      json
+// @Param        request body ResendVerificationRequest true "Account email"
+// @Success      202 {object} map[string]string
+// @Failure      400 {object} map[string]string "Invalid request"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Router       /api/auth/resend-verification [post]
+func (h *EmailVerificationHandler) ResendVerification(c *fiber.Ctx) error {
+	var req ResendVerificationRequest
+	if err := c.BodyParser(&req); err != nil || req.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Email is required"})
+	}
+
+	if err := h.verificationService.Resend(req.Email); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not send verification email"})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "If the account exists and is unverified, a new link has been sent"})
+}
@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"go-fiber-app/keyring"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type JWKSHandler struct {
+	keys *keyring.KeyRing
+}
+
+func NewJWKSHandler(keys *keyring.KeyRing) *JWKSHandler {
+	return &JWKSHandler{keys: keys}
+}
+
+// GetJWKS godoc
+// @Summary      JSON Web Key Set
+// @Description  Public keys that verify access tokens. Includes retired keys until their tokens have expired.
+// @Tags         Auth
+// @Produce      json
+// @Success      200  {object}  keyring.JWKSet
+// @Router       /.well-known/jwks.json [get]
+func (h *JWKSHandler) GetJWKS(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(h.keys.JWKS())
+}
@@ -0,0 +1,237 @@
+package handler
+
+import (
+	"errors"
+	"go-fiber-app/repository"
+	"go-fiber-app/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type DeleteAccountRequest struct {
+	Password string `json:"password" validate:"required" example:"password123"`
+}
+
+// GetMe godoc
+// @Summary      Get the current user
+// @Description  Return the profile of the user the access token belongs to
+// @Tags         Me
+// @Produce      json
+// @Success      200  {object}  model.User
+// @Failure      401  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /api/auth/me [get]
+func (h *UserHandler) GetMe(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
+	user, err := h.userService.GetUserWithPhones(userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	setETag(c, user.Version)
+	return c.JSON(user)
+}
+
+// UpdateMe godoc
+// @Summary      Update the current user
+// @Description  Update the caller's profile. Only the fields sent are changed; accepts JSON, multipart/form-data with a photo,
+// @Description  or an RFC 7396 merge patch (application/merge-patch+json) in which null clears a field.
+// @Tags         Me
+// @Accept       json,multipart/form-data,application/merge-patch+json
+// @Produce      json
+// @Param        request  body  UpdateUserRequest  false  "Fields to change"
+// @Param        If-Match  header  string  true  "ETag from the last GET"
+// @Success      200  {object}  model.User
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      412  {object}  map[string]string  "Changed since read; body has the current version"
+// @Failure      428  {object}  map[string]string  "If-Match missing"
+// @Router       /api/auth/me [patch]
+func (h *UserHandler) UpdateMe(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
+	if _, sent := parseIfMatch(c); !sent {
+		return preconditionRequired(c)
+	}
+	if isMergePatch(c) {
+		return h.patchUser(c, userID)
+	}
+	return h.updateUser(c, userID)
+}
+
+// ChangeMyPassword godoc
+// @Summary      Change the current user's password
+// @Description  Change the caller's password after checking the current one
+// @Tags         Me
+// @Accept       json
+// @Produce      json
+// @Param        request  body  UpdatePasswordRequest  true  "Current and new password"
+// @Param        If-Match  header  string  true  "ETag from the last GET"
+// @Success      200  {object}  map[string]string
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string  "Current password is incorrect"
+// @Failure      412  {object}  map[string]string  "Changed since read; body has the current version"
+// @Failure      428  {object}  map[string]string  "If-Match missing"
+// @Router       /api/auth/me/password [put]
+func (h *UserHandler) ChangeMyPassword(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
+	if _, sent := parseIfMatch(c); !sent {
+		return preconditionRequired(c)
+	}
+	return h.updatePassword(c, userID)
+}
+
+// ChangeMyPhoto godoc
+// @Summary      Change the current user's photo
+// @Description  Upload a new profile image (jpg/png/gif) for the caller
+// @Tags         Me
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        photo  formData  file  true  "Profile image"
+// @Param        If-Match  header  string  true  "ETag from the last GET"
+// @Success      200  {object}  model.User
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      412  {object}  map[string]string  "Changed since read; body has the current version"
+// @Failure      428  {object}  map[string]string  "If-Match missing"
+// @Router       /api/auth/me/photo [put]
+func (h *UserHandler) ChangeMyPhoto(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
+	ifMatch, sent := parseIfMatch(c)
+	if !sent {
+		return preconditionRequired(c)
+	}
+
+	file, err := c.FormFile("photo")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Photo is required"})
+	}
+	user, err := h.userService.GetUser(userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if !ifMatch.Allows(user.Version) {
+		return preconditionFailed(c, user.Version, user)
+	}
+
+	photo, err := savePhoto(c, file)
+	if err != nil {
+		return photoError(c, err)
+	}
+	user.Photo = photo
+	if err := h.userService.UpdateUser(user, userID); err != nil {
+		// The photo was never attached to the user, so it would only be left behind
+		h.userService.DiscardPhoto(photo)
+		if errors.Is(err, repository.ErrVersionConflict) {
+			return h.userConflict(c, userID)
+		}
+		return saveError(c, err)
+	}
+	setETag(c, user.Version)
+	return c.JSON(user)
+}
+
+// DeleteMe godoc
+// @Summary      Delete the current user's account
+// @Description  Schedule the caller's account for deletion, confirmed with the password. The account keeps working
+// @Description  until deletion_scheduled_at and the deletion can be cancelled until then; after that the user,
+// @Description  their phone numbers and photo are removed.
+// @Tags         Me
+// @Accept       json
+// @Produce      json
+// @Param        request  body  DeleteAccountRequest  true  "Current password"
+// @Param        If-Match  header  string  true  "ETag from the last GET"
+// @Success      202  {object}  map[string]interface{}
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string  "Password is incorrect"
+// @Failure      409  {object}  map[string]string  "The caller is the last admin"
+// @Failure      412  {object}  map[string]string  "Changed since read; body has the current version"
+// @Failure      428  {object}  map[string]string  "If-Match missing"
+// @Router       /api/auth/me [delete]
+func (h *UserHandler) DeleteMe(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
+
+	ifMatch, sent := parseIfMatch(c)
+	if !sent {
+		return preconditionRequired(c)
+	}
+
+	var req DeleteAccountRequest
+	if err := c.BodyParser(&req); err != nil || req.Password == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Password is required"})
+	}
+	user, err := h.userService.GetUser(userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if !h.userService.VerifyPassword(user, req.Password) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Password is incorrect"})
+	}
+	if !ifMatch.Allows(user.Version) {
+		return preconditionFailed(c, user.Version, user)
+	}
+
+	scheduledAt, err := h.userService.ScheduleDeletion(user)
+	if err != nil {
+		if errors.Is(err, repository.ErrVersionConflict) {
+			return h.userConflict(c, userID)
+		}
+		if errors.Is(err, service.ErrDeleteLastAdmin) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	setETag(c, user.Version)
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message":               "Your account will be deleted. Cancel before the scheduled time to keep it.",
+		"deletion_scheduled_at": scheduledAt,
+	})
+}
+
+// CancelMyDeletion godoc
+// @Summary      Cancel account deletion
+// @Description  Keep the caller's account when its deletion is still in the grace period
+// @Tags         Me
+// @Produce      json
+// @Success      200  {object}  model.User
+// @Failure      401  {object}  map[string]string
+// @Failure      409  {object}  map[string]string  "No deletion is scheduled"
+// @Failure      412  {object}  map[string]string  "Changed meanwhile; body has the current version"
+// @Router       /api/auth/me/deletion [delete]
+func (h *UserHandler) CancelMyDeletion(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
+	user, err := h.userService.GetUser(userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	if err := h.userService.CancelDeletion(user); err != nil {
+		if errors.Is(err, service.ErrDeletionNotScheduled) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		}
+		if errors.Is(err, repository.ErrVersionConflict) {
+			return h.userConflict(c, userID)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	setETag(c, user.Version)
+	return c.JSON(user)
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	model "go-fiber-app/models"
+	"go-fiber-app/repository"
+	"go-fiber-app/service"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// userDoc encodes the user the way the mock database returns it
+func userDoc(t *testing.T, user model.User) bson.D {
+	t.Helper()
+	data, err := bson.Marshal(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc bson.D
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	return mtest.CreateCursorResponse(0, "test.users", mtest.FirstBatch, doc)
+}
+
+// serveAs runs the request against the handler with the caller signed in as user
+func serveAs(t *testing.T, user model.User, method string, h fiber.Handler, req *http.Request) *http.Response {
+	t.Helper()
+	app := fiber.New()
+	app.Add(method, "/", func(c *fiber.Ctx) error {
+		c.Locals("user", &jwt.Token{Claims: jwt.MapClaims{"user_id": user.ID.Hex()}, Valid: true})
+		return c.Next()
+	}, h)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestChangeMyPhotoConflict(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	user := model.User{ID: primitive.NewObjectID(), Name: "Nimal", Email: "nimal@example.com", Version: 3}
+
+	mt.Run("a concurrent change answers 412 and removes the uploaded photo", func(mt *mtest.T) {
+		mt.Chdir(mt.TempDir())
+		h := NewUserHandler(service.NewUserService(repository.NewUserRepository(mt.DB)), nil)
+		changed := user
+		changed.Version = 4
+		mt.AddMockResponses(
+			userDoc(mt.T, user),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}),
+			mtest.CreateCursorResponse(0, "test.users", mtest.FirstBatch, bson.D{{Key: "n", Value: 1}}),
+			userDoc(mt.T, changed),
+		)
+
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile("photo", "me.png")
+		part.Write([]byte("not really a png"))
+		form.Close()
+		req := httptest.NewRequest("PUT", "/", &body)
+		req.Header.Set(fiber.HeaderContentType, form.FormDataContentType())
+		req.Header.Set(fiber.HeaderIfMatch, etag(3))
+
+		resp := serveAs(mt.T, user, "PUT", h.ChangeMyPhoto, req)
+		if resp.StatusCode != fiber.StatusPreconditionFailed {
+			mt.Fatalf("status = %d, want 412", resp.StatusCode)
+		}
+		if got := resp.Header.Get(fiber.HeaderETag); got != etag(4) {
+			mt.Errorf("ETag = %q, want the current version %q", got, etag(4))
+		}
+		var conflict struct{ Current model.User }
+		if err := json.NewDecoder(resp.Body).Decode(&conflict); err != nil || conflict.Current.Version != 4 {
+			mt.Errorf("body = %+v, %v, want the current user", conflict, err)
+		}
+		if entries, _ := os.ReadDir("storage/uploads"); len(entries) != 0 {
+			mt.Errorf("%d uploaded files left behind", len(entries))
+		}
+	})
+}
+
+func TestDeleteMeRequiresIfMatch(t *testing.T) {
+	h := NewUserHandler(nil, nil)
+	req := httptest.NewRequest("DELETE", "/", strings.NewReader(`{"password":"Violet-Harbor-42"}`))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+
+	resp := serveAs(t, model.User{ID: primitive.NewObjectID()}, "DELETE", h.DeleteMe, req)
+	if resp.StatusCode != fiber.StatusPreconditionRequired {
+		t.Errorf("status = %d, want 428", resp.StatusCode)
+	}
+}
@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"go-fiber-app/service"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SetOIDCService enables sign-in through an OpenID Connect provider. When
+// postLoginRedirect is set the callback redirects the browser there with the
+// login result in the URL fragment; otherwise it responds with JSON like Login.
+func (h *AuthHandler) SetOIDCService(oidcService *service.OIDCService, postLoginRedirect string) {
+	h.oidcService = oidcService
+	h.oidcPostLoginRedirect = postLoginRedirect
+}
+
+// OIDCLogin godoc
+// @Summary      Start OpenID Connect login
+// @Description  Redirect the browser to the identity provider (authorization code flow with PKCE)
+// @Tags         Authentication
+// @Success      302  "Redirect to the identity provider"
+// @Failure      404  {object}  map[string]string  "OIDC login is not configured"
+// @Failure      502  {object}  map[string]string  "Identity provider unavailable"
+// @Router       /api/auth/oidc/login [get]
+func (h *AuthHandler) OIDCLogin(c *fiber.Ctx) error {
+	if h.oidcService == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "OIDC login is not configured"})
+	}
+
+	authURL, binding, err := h.oidcService.AuthURL()
+	if err != nil {
+		return h.oidcError(c, err)
+	}
+	h.setOIDCStateCookie(c, binding, time.Now().Add(h.oidcService.StateTTL()))
+	return c.Redirect(authURL, fiber.StatusFound)
+}
+
+// OIDCCallback godoc
+// @Summary      Finish OpenID Connect login
+// @Description  Redirect target registered at the identity provider. Issues the same tokens as /api/auth/login,
+// @Description  or a 2FA challenge when the account has two-factor authentication enabled.
+// @Description  Only accepted from the browser that started the login, which holds its oidc_state cookie.
+// @Tags         Authentication
+// @Produce      json
+// @Param        code   query  string  true  "Authorization code"
+// @Param        state  query  string  true  "State from the login request"
+// @Success      200  {object}  map[string]interface{}
+// @Success      302  "Redirect to the frontend with the result in the URL fragment"
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      423  {object}  map[string]string
+// @Failure      502  {object}  map[string]string
+// @Router       /api/auth/oidc/callback [get]
+func (h *AuthHandler) OIDCCallback(c *fiber.Ctx) error {
+	if h.oidcService == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "OIDC login is not configured"})
+	}
+	// The login state is single-use, whatever the outcome
+	binding := c.Cookies(oidcStateCookie)
+	h.setOIDCStateCookie(c, "", time.Unix(0, 0))
+
+	if providerError := c.Query("error"); providerError != "" {
+		return h.oidcResult(c, fiber.StatusBadRequest, fiber.Map{"error": "Login was cancelled or denied: " + providerError})
+	}
+	code, state := c.Query("code"), c.Query("state")
+	if code == "" || state == "" {
+		return h.oidcResult(c, fiber.StatusBadRequest, fiber.Map{"error": "Missing code or state"})
+	}
+
+	user, err := h.oidcService.Callback(code, state, binding)
+	if err != nil {
+		return h.oidcError(c, err)
+	}
+
+	// Locked accounts stay locked whichever way the user signs in
+	if err := h.loginGuard.Check(user.Email, c.IP(), user); err != nil {
+		recordLoginFailure(h.events, c, user.Email, user, err.Error())
+		return h.oidcError(c, err)
+	}
+
+	body, err := h.completeLogin(c, user, "oidc")
+	if err != nil {
+		if errors.Is(err, errEmailNotVerified) {
+			return h.oidcResult(c, fiber.StatusForbidden, fiber.Map{"error": "Please verify your email address before logging in"})
+		}
+		return h.oidcResult(c, fiber.StatusInternalServerError, fiber.Map{"error": "Could not login"})
+	}
+	return h.oidcResult(c, fiber.StatusOK, body)
+}
+
+// oidcStateCookie holds the hash of the login state in the browser that started the login
+const oidcStateCookie = "oidc_state"
+
+// setOIDCStateCookie stores the login binding, or clears it when expires is in the past.
+// Lax still sends the cookie on the provider's top-level redirect back to the callback.
+func (h *AuthHandler) setOIDCStateCookie(c *fiber.Ctx, value string, expires time.Time) {
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/api/auth/oidc",
+		Expires:  expires,
+		Secure:   c.Protocol() == "https",
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+}
+
+// oidcResult answers the callback with JSON, or hands the result to the frontend
+// in the URL fragment, which is never sent to servers or logged in access logs
+func (h *AuthHandler) oidcResult(c *fiber.Ctx, status int, body fiber.Map) error {
+	if h.oidcPostLoginRedirect == "" {
+		return c.Status(status).JSON(body)
+	}
+
+	fragment := url.Values{}
+	for key, value := range body {
+		if key == "user" {
+			continue // the frontend loads the profile with the access token
+		}
+		fragment.Set(key, fmt.Sprint(value))
+	}
+	return c.Redirect(h.oidcPostLoginRedirect+"#"+fragment.Encode(), fiber.StatusFound)
+}
+
+func (h *AuthHandler) oidcError(c *fiber.Ctx, err error) error {
+	var lockout *service.LockoutError
+	switch {
+	case errors.As(err, &lockout):
+		status := fiber.StatusTooManyRequests
+		if lockout.AccountLocked {
+			status = fiber.StatusLocked
+		}
+		return h.oidcResult(c, status, fiber.Map{"error": lockout.Error(), "retry_after": lockout.RetryAfterSeconds()})
+	case errors.Is(err, service.ErrOIDCInvalidState):
+		return h.oidcResult(c, fiber.StatusBadRequest, fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrOIDCEmailNotVerified), errors.Is(err, service.ErrOIDCNoAccount), errors.Is(err, service.ErrOIDCIdentityConflict):
+		return h.oidcResult(c, fiber.StatusForbidden, fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrOIDCProvider):
+		return h.oidcResult(c, fiber.StatusBadGateway, fiber.Map{"error": err.Error()})
+	default:
+		return h.oidcResult(c, fiber.StatusInternalServerError, fiber.Map{"error": "Could not login"})
+	}
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"errors"
+	model "go-fiber-app/models"
+	"go-fiber-app/password"
+	"go-fiber-app/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email" example:"john.doe@example.com"`
+}
+
+type ResetPasswordRequest struct {
+	Token           string `json:"token" validate:"required"`
+	NewPassword     string `json:"newPassword" validate:"required,min=6" example:"newpassword123"`
+	ConfirmPassword string `json:"confirmPassword" validate:"required" example:"newpassword123"`
+}
+
+type PasswordResetHandler struct {
+	resetService *service.PasswordResetService
+	events       *service.SecurityEventService
+}
+
+func NewPasswordResetHandler(resetService *service.PasswordResetService, events *service.SecurityEventService) *PasswordResetHandler {
+	return &PasswordResetHandler{resetService: resetService, events: events}
+}
+
+// ForgotPassword godoc
+// @Summary      Request a password reset
+// @Description  Email a single-use reset link. Always returns 202 so account existence is not revealed.
+// @Description  While the last link is recent, no new one is sent and the emailed link keeps working.
+// @Tags         Authentication
+// @Accept       json
+// @Produce      json
+// @Param        request body ForgotPasswordRequest true "Account email"
+// @Success      202 {object} map[string]string
+// @Failure      400 {object} map[string]string "Invalid request"
+// @Failure      429 {object} map[string]string "Too many requests from this IP"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Router       /api/auth/forgot-password [post]
+func (h *PasswordResetHandler) ForgotPassword(c *fiber.Ctx) error {
+	var req ForgotPasswordRequest
+	if err := c.BodyParser(&req); err != nil || req.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Email is required"})
+	}
+
+	if err := h.resetService.RequestReset(req.Email); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not send reset email"})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "If the email is registered, a reset link has been sent"})
+}
+
+// ResetPassword godoc
+// @Summary      Reset password
+// @Description  Set a new password using the token from the reset email. All sessions are signed out.
+// @Tags         Authentication
+// @Accept       json
+// @Produce      json
+// @Param        request body ResetPasswordRequest true "Reset token and new password"
+// @Success      200 {object} map[string]string "Password reset successfully"
+// @Failure      400 {object} map[string]string "Invalid request, token or password"
+// @Failure      500 {object} map[string]string "Internal server error"
+// @Router       /api/auth/reset-password [post]
+func (h *PasswordResetHandler) ResetPassword(c *fiber.Ctx) error {
+	var req ResetPasswordRequest
+	if err := c.BodyParser(&req); err != nil || req.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+
+	// Validate that new password and confirm password match
+	if req.NewPassword != req.ConfirmPassword {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "New password and confirm password do not match"})
+	}
+
+	user, err := h.resetService.ResetPassword(req.Token, req.NewPassword)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidResetToken) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		var policyErr *password.PolicyError
+		if errors.As(err, &policyErr) {
+			return passwordPolicyError(c, err)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to reset password"})
+	}
+
+	h.events.Record(securityEvent(c, model.EventPasswordChanged, user, "password reset"))
+	return c.JSON(fiber.Map{"message": "Password reset successfully"})
+}
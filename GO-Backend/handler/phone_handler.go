@@ -1,12 +1,15 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	model "go-fiber-app/models"
+	"go-fiber-app/repository"
 	"go-fiber-app/service"
 
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type PhoneHandler struct {
@@ -27,6 +30,8 @@ func NewPhoneHandler(phoneService *service.PhoneService) *PhoneHandler {
 // @Param        phone body    model.PhoneNumber    true  "Phone number data"
 // @Success      201  {object}  model.PhoneNumber
 // @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string  "User not found"
+// @Failure      409  {object}  map[string]string
 // @Failure      500  {object}  map[string]string
 // @Router       /users/{id}/phones [post]
 func (h *PhoneHandler) CreatePhone(c *fiber.Ctx) error {
@@ -46,14 +51,21 @@ func (h *PhoneHandler) CreatePhone(c *fiber.Ctx) error {
 	}
 
 	phone.UserID = userObjectID
+	// A new phone starts at the first version whatever the client sent
+	phone.Version = 0
 	fmt.Printf("Creating phone: %+v\n", phone)
+	actorID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
 
-	if err := h.phoneService.CreatePhone(&phone); err != nil {
+	if err := h.phoneService.CreatePhone(&phone, actorID); err != nil {
 		fmt.Printf("Error creating phone in service: %v\n", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return saveError(c, err)
 	}
 
 	fmt.Printf("Phone created successfully: %+v\n", phone)
+	setETag(c, phone.Version)
 	return c.Status(fiber.StatusCreated).JSON(phone)
 }
 
@@ -65,7 +77,9 @@ func (h *PhoneHandler) CreatePhone(c *fiber.Ctx) error {
 // @Produce      json
 // @Param        id   path      string  true  "User ID"
 // @Success      200  {array}   model.PhoneNumber
+// @Header       200  {string}  ETag  "Weak tag that changes with the list; each phone's version is its If-Match"
 // @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string  "User not found"
 // @Failure      500  {object}  map[string]string
 // @Router       /users/{id}/phones [get]
 func (h *PhoneHandler) GetPhonesByUser(c *fiber.Ctx) error {
@@ -77,9 +91,10 @@ func (h *PhoneHandler) GetPhonesByUser(c *fiber.Ctx) error {
 
 	phones, err := h.phoneService.GetPhonesByUser(userObjectID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return phoneError(c, err)
 	}
 
+	setPhonesETag(c, phones)
 	return c.JSON(phones)
 }
 
@@ -92,8 +107,13 @@ func (h *PhoneHandler) GetPhonesByUser(c *fiber.Ctx) error {
 // @Param        id       path      string            true  "User ID"
 // @Param        phoneId  path      string            true  "Phone ID"
 // @Param        phone    body      model.PhoneNumber true  "Updated phone data"
+// @Param        If-Match  header  string  true  "ETag from the last GET"
 // @Success      200      {object}  model.PhoneNumber
 // @Failure      400      {object}  map[string]string
+// @Failure      404      {object}  map[string]string  "User not found"
+// @Failure      409      {object}  map[string]string
+// @Failure      412      {object}  map[string]string  "Changed since read; body has the current version"
+// @Failure      428      {object}  map[string]string  "If-Match missing"
 // @Failure      500      {object}  map[string]string
 // @Router       /users/{id}/phones/{phoneId} [put]
 func (h *PhoneHandler) UpdatePhone(c *fiber.Ctx) error {
@@ -118,10 +138,22 @@ func (h *PhoneHandler) UpdatePhone(c *fiber.Ctx) error {
 	phone.ID = phoneObjectID
 	phone.UserID = userObjectID
 
-	if err := h.phoneService.UpdatePhone(&phone); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	actorID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
+	ifMatch, sent := parseIfMatch(c)
+	if !sent {
+		return preconditionRequired(c)
+	}
+	if err := h.phoneService.UpdatePhone(&phone, actorID, ifMatch); err != nil {
+		if errors.Is(err, repository.ErrVersionConflict) {
+			return h.phoneConflict(c, userObjectID, phoneObjectID)
+		}
+		return saveError(c, err)
 	}
 
+	setETag(c, phone.Version)
 	return c.JSON(phone)
 }
 
@@ -133,8 +165,12 @@ func (h *PhoneHandler) UpdatePhone(c *fiber.Ctx) error {
 // @Produce      json
 // @Param        id       path      string  true  "User ID"
 // @Param        phoneId  path      string  true  "Phone ID"
+// @Param        If-Match  header  string  true  "ETag from the last GET"
 // @Success      204      "No Content"
 // @Failure      400      {object}  map[string]string
+// @Failure      404      {object}  map[string]string  "User not found"
+// @Failure      412      {object}  map[string]string  "Changed since read; body has the current version"
+// @Failure      428      {object}  map[string]string  "If-Match missing"
 // @Failure      500      {object}  map[string]string
 // @Router       /users/{id}/phones/{phoneId} [delete]
 func (h *PhoneHandler) DeletePhone(c *fiber.Ctx) error {
@@ -151,9 +187,40 @@ func (h *PhoneHandler) DeletePhone(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid phone ID"})
 	}
 
-	if err := h.phoneService.DeletePhone(userObjectID, phoneObjectID); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	actorID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
+	ifMatch, sent := parseIfMatch(c)
+	if !sent {
+		return preconditionRequired(c)
+	}
+	if err := h.phoneService.DeletePhone(userObjectID, phoneObjectID, actorID, ifMatch); err != nil {
+		if errors.Is(err, repository.ErrVersionConflict) {
+			return h.phoneConflict(c, userObjectID, phoneObjectID)
+		}
+		return phoneError(c, err)
 	}
 
 	return c.Status(fiber.StatusNoContent).Send(nil)
 }
+
+// phoneConflict answers a write that lost a race with another change to the phone
+func (h *PhoneHandler) phoneConflict(c *fiber.Ctx, userID, phoneID primitive.ObjectID) error {
+	current, err := h.phoneService.GetPhone(userID, phoneID)
+	if err != nil {
+		return phoneError(c, err)
+	}
+	return preconditionFailed(c, current.Version, current)
+}
+
+// phoneError answers a failed phone lookup or delete, with 404 when the user or phone is missing
+func phoneError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if errors.Is(err, repository.ErrPhoneNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Phone not found"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
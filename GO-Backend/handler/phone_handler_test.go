@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	model "go-fiber-app/models"
+	"go-fiber-app/repository"
+	"go-fiber-app/service"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestCreatePhoneIgnoresClientVersion(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	userID := primitive.NewObjectID()
+
+	mt.Run("a new phone starts at version 0", func(mt *mtest.T) {
+		h := NewPhoneHandler(service.NewPhoneService(repository.NewPhoneRepository(mt.DB)))
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		app := fiber.New()
+		app.Post("/users/:id/phones", func(c *fiber.Ctx) error {
+			c.Locals("user", &jwt.Token{Claims: jwt.MapClaims{"user_id": userID.Hex()}, Valid: true})
+			return c.Next()
+		}, h.CreatePhone)
+		req := httptest.NewRequest("POST", "/users/"+userID.Hex()+"/phones", strings.NewReader(`{"number":"0771234567","type":"mobile","version":41}`))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		resp, err := app.Test(req)
+		if err != nil {
+			mt.Fatal(err)
+		}
+
+		if resp.StatusCode != fiber.StatusCreated {
+			mt.Fatalf("status = %d, want 201", resp.StatusCode)
+		}
+		if got := resp.Header.Get(fiber.HeaderETag); got != etag(0) {
+			mt.Errorf("ETag = %q, want %q", got, etag(0))
+		}
+		inserted := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		if version := inserted.Lookup("version").Int64(); version != 0 {
+			mt.Errorf("stored version %d, want 0", version)
+		}
+	})
+}
+
+func TestSetPhonesETag(t *testing.T) {
+	phone := &model.PhoneNumber{ID: primitive.NewObjectID(), Number: "0771234567", Version: 1}
+	other := &model.PhoneNumber{ID: primitive.NewObjectID(), Number: "0112345678", Version: 1}
+	tag := func(phones ...*model.PhoneNumber) string {
+		app := fiber.New()
+		app.Get("/", func(c *fiber.Ctx) error {
+			setPhonesETag(c, phones)
+			return nil
+		})
+		resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.Header.Get(fiber.HeaderETag)
+	}
+
+	before := tag(phone)
+	if !strings.HasPrefix(before, `W/"`) {
+		t.Errorf("ETag = %q, want a weak tag", before)
+	}
+	if again := tag(phone); again != before {
+		t.Errorf("ETag of the same list = %q, want %q", again, before)
+	}
+	if added := tag(phone, other); added == before {
+		t.Error("ETag unchanged after a phone was added")
+	}
+	changed := *phone
+	changed.Version++
+	if got := tag(&changed); got == before {
+		t.Error("ETag unchanged after a phone was changed")
+	}
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"errors"
+	model "go-fiber-app/models"
+	"go-fiber-app/service"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type AssignRoleRequest struct {
+	Role string `json:"role" validate:"required" example:"admin"`
+}
+
+type RoleHandler struct {
+	userService *service.UserService
+}
+
+func NewRoleHandler(userService *service.UserService) *RoleHandler {
+	return &RoleHandler{userService: userService}
+}
+
+// ListRoles godoc
+// @Summary      List roles
+// @Description  List every role and the permissions it grants
+// @Tags         Roles
+// @Produce      json
+// @Success      200  {object}  map[string][]string
+// @Router       /roles [get]
+func (h *RoleHandler) ListRoles(c *fiber.Ctx) error {
+	return c.JSON(model.RolePermissions)
+}
+
+// AssignRole godoc
+// @Summary      Assign a role to a user
+// @Description  Grant a role to a user (admin only). Takes effect on the user's next login or token refresh.
+// @Tags         Roles
+// @Accept       json
+// @Produce      json
+// @Param        id       path  string             true  "User ID"
+// @Param        request  body  AssignRoleRequest  true  "Role to assign"
+// @Success      200  {object}  model.User
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /users/{id}/roles [post]
+func (h *RoleHandler) AssignRole(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	var req AssignRoleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	actorID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
+
+	user, err := h.userService.AssignRole(userID, req.Role, actorID)
+	if err != nil {
+		return roleError(c, err)
+	}
+	return c.JSON(user)
+}
+
+// RevokeRole godoc
+// @Summary      Revoke a role from a user
+// @Description  Remove a role from a user (admin only). The last admin cannot be demoted.
+// @Tags         Roles
+// @Produce      json
+// @Param        id    path  string  true  "User ID"
+// @Param        role  path  string  true  "Role name"
+// @Success      200  {object}  model.User
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Router       /users/{id}/roles/{role} [delete]
+func (h *RoleHandler) RevokeRole(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	actorID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
+
+	user, err := h.userService.RevokeRole(userID, c.Params("role"), actorID)
+	if err != nil {
+		return roleError(c, err)
+	}
+	return c.JSON(user)
+}
+
+func roleError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidRole), errors.Is(err, service.ErrMemberRequired):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrLastAdmin):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	default:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+}
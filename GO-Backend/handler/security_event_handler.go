@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"go-fiber-app/middleware"
+	model "go-fiber-app/models"
+	"go-fiber-app/repository"
+	"go-fiber-app/service"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultSecurityEventLimit = 50
+	maxSecurityEventLimit     = 500
+)
+
+type SecurityEventHandler struct {
+	events *service.SecurityEventService
+}
+
+func NewSecurityEventHandler(events *service.SecurityEventService) *SecurityEventHandler {
+	return &SecurityEventHandler{events: events}
+}
+
+// ListSecurityEvents godoc
+// @Summary      List security events
+// @Description  Query logins, lockouts, password changes, token revocations and permission denials, newest first (admin only).
+// @Description  Pass the id of the last event as "before" to get the next page.
+// @Tags         Security
+// @Produce      json
+// @Param        type     query  string  false  "Comma-separated event types, e.g. login_failure,account_locked"
+// @Param        user_id  query  string  false  "User the event is about"
+// @Param        email    query  string  false  "Email used in the request"
+// @Param        ip       query  string  false  "Client IP"
+// @Param        from     query  string  false  "Earliest time (RFC 3339)"
+// @Param        to       query  string  false  "Latest time, exclusive (RFC 3339)"
+// @Param        before   query  string  false  "Only events older than this event ID"
+// @Param        limit    query  int     false  "Maximum number of events (default 50, max 500)"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /api/security/events [get]
+func (h *SecurityEventHandler) ListSecurityEvents(c *fiber.Ctx) error {
+	filter := repository.SecurityEventFilter{
+		UserID: c.Query("user_id"),
+		Email:  strings.TrimSpace(c.Query("email")),
+		IP:     c.Query("ip"),
+		Limit:  int64(c.QueryInt("limit", defaultSecurityEventLimit)),
+	}
+	if filter.Limit <= 0 || filter.Limit > maxSecurityEventLimit {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "limit must be between 1 and 500"})
+	}
+	if types := c.Query("type"); types != "" {
+		filter.Types = strings.Split(types, ",")
+	}
+
+	var err error
+	if from := c.Query("from"); from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "from must be an RFC 3339 time"})
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "to must be an RFC 3339 time"})
+		}
+	}
+	if before := c.Query("before"); before != "" {
+		if filter.Before, err = primitive.ObjectIDFromHex(before); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+		}
+	}
+
+	events, err := h.events.List(filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"events": events, "count": len(events)})
+}
+
+// securityEvent describes the current request as an event about the user (which may be nil)
+func securityEvent(c *fiber.Ctx, eventType string, user *model.User, reason string) *model.SecurityEvent {
+	actorID, _ := middleware.GetUserID(c)
+	event := &model.SecurityEvent{
+		Type:      eventType,
+		ActorID:   actorID,
+		IP:        c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+		Method:    c.Method(),
+		Path:      c.Path(),
+		Reason:    reason,
+	}
+	if user != nil {
+		event.UserID = user.ID.Hex()
+		event.Email = user.Email
+	}
+	return event
+}
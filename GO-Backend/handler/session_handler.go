@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"errors"
+	"go-fiber-app/middleware"
+	model "go-fiber-app/models"
+	"go-fiber-app/service"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type SessionHandler struct {
+	sessionService *service.SessionService
+	events         *service.SecurityEventService
+}
+
+func NewSessionHandler(sessionService *service.SessionService, events *service.SecurityEventService) *SessionHandler {
+	return &SessionHandler{sessionService: sessionService, events: events}
+}
+
+// ListSessions godoc
+// @Summary      List active sessions
+// @Description  List the devices the current user is signed in on. The calling session has current=true.
+// @Tags         Sessions
+// @Produce      json
+// @Success      200  {array}   model.Session
+// @Failure      401  {object}  map[string]string
+// @Router       /api/auth/sessions [get]
+func (h *SessionHandler) ListSessions(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
+
+	sessions, err := h.sessionService.List(userID, middleware.GetSessionID(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(sessions)
+}
+
+// RevokeSession godoc
+// @Summary      Sign out a device
+// @Description  Revoke one of the current user's sessions. Its access and refresh tokens stop working immediately.
+// @Tags         Sessions
+// @Param        id  path  string  true  "Session ID"
+// @Success      204  "No Content"
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /api/auth/sessions/{id} [delete]
+func (h *SessionHandler) RevokeSession(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
+	sessionID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+
+	if err := h.sessionService.Revoke(userID, sessionID); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Session not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	h.recordRevoked(c, userID, "session "+sessionID.Hex()+" signed out")
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// RevokeAllSessions godoc
+// @Summary      Sign out everywhere
+// @Description  Revoke every session of the current user, including this one
+// @Tags         Sessions
+// @Produce      json
+// @Success      200  {object}  map[string]interface{}
+// @Failure      401  {object}  map[string]string
+// @Router       /api/auth/sessions [delete]
+func (h *SessionHandler) RevokeAllSessions(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
+
+	count, err := h.sessionService.RevokeAll(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	h.recordRevoked(c, userID, "signed out everywhere")
+	return c.JSON(fiber.Map{"message": "Signed out everywhere", "revoked": count})
+}
+
+func (h *SessionHandler) recordRevoked(c *fiber.Ctx, userID primitive.ObjectID, reason string) {
+	event := securityEvent(c, model.EventTokenRevoked, nil, reason)
+	event.UserID = userID.Hex()
+	h.events.Record(event)
+}
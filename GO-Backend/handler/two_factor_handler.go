@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"errors"
+	"go-fiber-app/middleware"
+	model "go-fiber-app/models"
+	"go-fiber-app/service"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required" example:"123456"`
+}
+
+type TwoFactorVerifyRequest struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required" example:"123456"`
+}
+
+type TwoFactorPolicyRequest struct {
+	RequiredRoles []string `json:"required_roles" example:"admin"`
+}
+
+type TwoFactorHandler struct {
+	twoFactorService *service.TwoFactorService
+	tokenService     *service.TokenService
+	loginGuard       *service.LoginGuard
+	events           *service.SecurityEventService
+}
+
+func NewTwoFactorHandler(twoFactorService *service.TwoFactorService, tokenService *service.TokenService, loginGuard *service.LoginGuard, events *service.SecurityEventService) *TwoFactorHandler {
+	return &TwoFactorHandler{twoFactorService: twoFactorService, tokenService: tokenService, loginGuard: loginGuard, events: events}
+}
+
+// Enroll godoc
+// @Summary      Start two-factor enrollment
+// @Description  Generate a TOTP secret for the current user. Returns the otpauth URI and a QR code PNG (base64).
+// @Tags         Two-Factor
+// @Produce      json
+// @Success      200  {object}  service.TwoFactorEnrollment
+// @Failure      401  {object}  map[string]string
+// @Failure      409  {object}  map[string]string  "Already enabled"
+// @Router       /api/auth/2fa/enroll [post]
+func (h *TwoFactorHandler) Enroll(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
+
+	enrollment, err := h.twoFactorService.BeginEnrollment(userID)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+	return c.JSON(enrollment)
+}
+
+// ConfirmEnrollment godoc
+// @Summary      Confirm two-factor enrollment
+// @Description  Enable 2FA with the first code from the authenticator app. Returns one-time backup codes.
+// @Tags         Two-Factor
+// @Accept       json
+// @Produce      json
+// @Param        request body TwoFactorCodeRequest true "Code from the authenticator app"
+// @Success      200  {object}  map[string][]string
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Router       /api/auth/2fa/enroll/confirm [post]
+func (h *TwoFactorHandler) ConfirmEnrollment(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.BodyParser(&req); err != nil || req.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Code is required"})
+	}
+
+	codes, err := h.twoFactorService.ConfirmEnrollment(userID, req.Code)
+	if err != nil {
+		return twoFactorError(c, err)
+	}
+	return c.JSON(fiber.Map{
+		"message":      "Two-factor authentication enabled. Store the backup codes somewhere safe; they are shown only once.",
+		"backup_codes": codes,
+	})
+}
+
+// Disable godoc
+// @Summary      Disable two-factor authentication
+// @Description  Turn 2FA off using a current code or a backup code
+// @Tags         Two-Factor
+// @Accept       json
+// @Produce      json
+// @Param        request body TwoFactorCodeRequest true "Current code or backup code"
+// @Success      204  "No Content"
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Router       /api/auth/2fa/disable [post]
+func (h *TwoFactorHandler) Disable(c *fiber.Ctx) error {
+	userID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
+
+	var req TwoFactorCodeRequest
+	if err := c.BodyParser(&req); err != nil || req.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Code is required"})
+	}
+
+	if err := h.twoFactorService.Disable(userID, req.Code); err != nil {
+		return twoFactorError(c, err)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// Verify godoc
+// @Summary      Complete a two-factor login
+// @Description  Exchange the challenge token from /api/auth/login plus a TOTP or backup code for the real tokens
+// @Tags         Two-Factor
+// @Accept       json
+// @Produce      json
+// @Param        request body TwoFactorVerifyRequest true "Challenge and code"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  map[string]string
+// @Failure      401  {object}  map[string]string
+// @Failure      423  {object}  map[string]string
+// @Failure      429  {object}  map[string]string
+// @Router       /api/auth/2fa/verify [post]
+func (h *TwoFactorHandler) Verify(c *fiber.Ctx) error {
+	var req TwoFactorVerifyRequest
+	if err := c.BodyParser(&req); err != nil || req.ChallengeToken == "" || req.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Challenge token and code are required"})
+	}
+
+	user, err := h.twoFactorService.ResolveChallenge(req.ChallengeToken)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Wrong codes count towards the same lockout as wrong passwords
+	ip := c.IP()
+	if err := h.loginGuard.Check(user.Email, ip, user); err != nil {
+		recordLoginFailure(h.events, c, user.Email, user, err.Error())
+		return loginGuardError(c, err)
+	}
+	if err := h.twoFactorService.VerifyCode(user, req.Code); err != nil {
+		if !errors.Is(err, service.ErrInvalidTwoFactorCode) {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not verify code"})
+		}
+		recordLoginFailure(h.events, c, user.Email, user, "wrong two-factor code")
+		if err := h.loginGuard.RecordFailure(user.Email, ip, user); err != nil {
+			recordLockout(h.events, c, user, err)
+			return loginGuardError(c, err)
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+	}
+	// Each challenge completes one login only
+	if err := h.twoFactorService.ConsumeChallenge(req.ChallengeToken); err != nil {
+		if errors.Is(err, service.ErrInvalidChallenge) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not login"})
+	}
+
+	tokens, err := h.tokenService.IssueTokens(user, clientInfo(c))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not login"})
+	}
+	recordLoginSuccess(h.loginGuard, user)
+	h.events.Record(securityEvent(c, model.EventLoginSuccess, user, "two-factor code"))
+	return c.JSON(loginResponse(tokens, user))
+}
+
+// GetPolicy godoc
+// @Summary      Get two-factor policy
+// @Description  List the roles that must use two-factor authentication (admin only)
+// @Tags         Two-Factor
+// @Produce      json
+// @Success      200  {object}  model.SecuritySettings
+// @Router       /api/auth/2fa/policy [get]
+func (h *TwoFactorHandler) GetPolicy(c *fiber.Ctx) error {
+	settings, err := h.twoFactorService.GetPolicy()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(settings)
+}
+
+// UpdatePolicy godoc
+// @Summary      Update two-factor policy
+// @Description  Set the roles that must use two-factor authentication (admin only)
+// @Tags         Two-Factor
+// @Accept       json
+// @Produce      json
+// @Param        request body TwoFactorPolicyRequest true "Roles that require 2FA"
+// @Success      200  {object}  model.SecuritySettings
+// @Failure      400  {object}  map[string]string
+// @Router       /api/auth/2fa/policy [put]
+func (h *TwoFactorHandler) UpdatePolicy(c *fiber.Ctx) error {
+	var req TwoFactorPolicyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	}
+	if req.RequiredRoles == nil {
+		req.RequiredRoles = []string{}
+	}
+
+	settings, err := h.twoFactorService.SetRequiredRoles(req.RequiredRoles)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRole) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(settings)
+}
+
+// currentUserID reads the caller's ID from the JWT
+func currentUserID(c *fiber.Ctx) (primitive.ObjectID, error) {
+	id, err := middleware.GetUserID(c)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return primitive.ObjectIDFromHex(id)
+}
+
+func twoFactorError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, service.ErrTwoFactorAlreadyEnabled):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, service.ErrTwoFactorNotEnabled), errors.Is(err, service.ErrNoPendingEnrollment), errors.Is(err, service.ErrInvalidTwoFactorCode):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	default:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+}
@@ -2,22 +2,30 @@ package handler
 
 //used to handle HTTP requests.
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	model "go-fiber-app/models"
+	"go-fiber-app/password"
+	"go-fiber-app/repository"
 	"go-fiber-app/service"
+	"mime/multipart"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"golang.org/x/crypto/bcrypt"
 	//primitive is from MongoDB, used to convert string IDs to MongoDB’s ObjectID format.
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type UpdatePasswordRequest struct {
 	CurrentPassword string `json:"currentPassword" validate:"required" example:"oldpassword123"`
-	NewPassword     string `json:"newPassword" validate:"required,min=6" example:"newpassword123"`
+	NewPassword     string `json:"newPassword" validate:"required" example:"newpassword123"`
 	ConfirmPassword string `json:"confirmPassword" validate:"required" example:"newpassword123"`
 }
 
@@ -25,10 +33,10 @@ type CreateUserWithPasswordRequest struct {
 	Name            string `json:"name" validate:"required" example:"John Doe"`
 	Email           string `json:"email" validate:"required,email" example:"john.doe@example.com"`
 	NIC             string `json:"nic" validate:"required" example:"123456789V"`
-	Address         string `json:"address" validate:"required" example:"123 Main St, City"`
+	Address         string `json:"address" example:"123 Main St, City"`
 	Birthday        string `json:"birthday" validate:"required" example:"1990-01-15" format:"date"`
 	Gender          string `json:"gender" validate:"required" example:"Male"`
-	Password        string `json:"password" validate:"required,min=6" example:"password123"`
+	Password        string `json:"password" validate:"required" example:"password123"`
 	ConfirmPassword string `json:"confirmPassword" validate:"required" example:"password123"` // Only for validation
 }
 
@@ -43,11 +51,27 @@ type UpdateUserRequest struct {
 
 // a struct to group all user-related route functions.
 type UserHandler struct {
-	userService *service.UserService
+	userService         *service.UserService
+	verificationService *service.EmailVerificationService
+	events              *service.SecurityEventService
 }
 
-func NewUserHandler(userService *service.UserService) *UserHandler {
-	return &UserHandler{userService: userService}
+func NewUserHandler(userService *service.UserService, events *service.SecurityEventService) *UserHandler {
+	return &UserHandler{userService: userService, events: events}
+}
+
+func (h *UserHandler) SetEmailVerificationService(verificationService *service.EmailVerificationService) {
+	h.verificationService = verificationService
+}
+
+// sendVerification emails a verification link without failing the request if mail is down
+func (h *UserHandler) sendVerification(user *model.User) {
+	if h.verificationService == nil {
+		return
+	}
+	if err := h.verificationService.SendVerification(user); err != nil {
+		fmt.Printf("Error sending verification email to %s: %v\n", user.Email, err)
+	}
 }
 
 // CreateUser godoc
@@ -63,14 +87,18 @@ func NewUserHandler(userService *service.UserService) *UserHandler {
 // @Param        address         formData string false "User's address"
 // @Param        birthday        formData string false "Birthday in YYYY-MM-DD format (simple date)"
 // @Param        gender          formData string false "Gender (Male/Female)"
-// @Param        password        formData string false "Password (minimum 6 characters)"
+// @Param        password        formData string false "Password (must satisfy the password policy)"
 // @Param        confirmPassword formData string false "Confirm password (must match password)"
 // @Param        photo           formData file   false "User's profile image (jpg/png/gif)"
 // @Success      201  {object}  model.User
 // @Failure      400  {object}  map[string]string  "Invalid request or validation errors"
+// @Failure      409  {object}  map[string]string  "Email or NIC already in use"
 // @Failure      500  {object}  map[string]string  "Internal server error"
 // @Router       /users [post]
 func (h *UserHandler) CreateUser(c *fiber.Ctx) error {
+	// Also serves public registration, where there is no caller to record
+	actorID, _ := currentUserID(c)
+
 	// Try to parse as multipart form first
 	form, err := c.MultipartForm()
 	if err != nil {
@@ -85,13 +113,12 @@ func (h *UserHandler) CreateUser(c *fiber.Ctx) error {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Password and confirm password do not match"})
 		}
 
-		// Validate password length
-		if len(req.Password) < 6 {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Password must be at least 6 characters long"})
+		if err := h.userService.ValidatePassword(req.Password, req.Name, req.Email, req.NIC); err != nil {
+			return passwordPolicyError(c, err)
 		}
 
 		// Hash password
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		hashedPassword, err := h.userService.HashPassword(req.Password)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to hash password"})
 		}
@@ -110,14 +137,15 @@ func (h *UserHandler) CreateUser(c *fiber.Ctx) error {
 			Address:  req.Address,
 			Birthday: birthday,
 			Gender:   req.Gender,
-			Password: string(hashedPassword),
+			Password: hashedPassword,
 			Photo:    "", // Default empty photo
 		}
 
 		// Save user
-		if err := h.userService.CreateUser(user); err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		if err := h.userService.CreateUser(user, actorID); err != nil {
+			return saveError(c, err)
 		}
+		h.sendVerification(user)
 
 		return c.Status(fiber.StatusCreated).JSON(user)
 	}
@@ -175,17 +203,16 @@ func (h *UserHandler) CreateUser(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Password and confirm password do not match"})
 	}
 
-	// Validate password length
-	if len(password) < 6 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Password must be at least 6 characters long"})
+	if err := h.userService.ValidatePassword(password, user.Name, user.Email, user.NIC); err != nil {
+		return passwordPolicyError(c, err)
 	}
 
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := h.userService.HashPassword(password)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to hash password"})
 	}
-	user.Password = string(hashedPassword)
+	user.Password = hashedPassword
 
 	// Handle birthday
 	if birthday := form.Value["birthday"]; len(birthday) > 0 {
@@ -235,28 +262,69 @@ func (h *UserHandler) CreateUser(c *fiber.Ctx) error {
 	}
 
 	// Save user
-	if err := h.userService.CreateUser(&user); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	if err := h.userService.CreateUser(&user, actorID); err != nil {
+		return saveError(c, err)
 	}
+	h.sendVerification(&user)
 
 	return c.Status(fiber.StatusCreated).JSON(user)
 }
 
 // GetAllUsers godoc
-// @Summary      Get all users
-// @Description  Retrieve a list of all users
+// @Summary      List users
+// @Description  List users a page at a time. Pass pagination.next_cursor back as cursor (with the same sort and order)
+// @Description  to get the next page; pagination.next and the Link header hold the full URL.
 // @Tags         Users
 // @Accept       json
 // @Produce      json
-// @Success      200  {array}   model.User
+// @Param        limit          query  int     false  "Page size (default 20, max 100)"
+// @Param        cursor         query  string  false  "Cursor from the previous page"
+// @Param        sort           query  string  false  "created (default), name, email or birthday"
+// @Param        order          query  string  false  "asc (default) or desc"
+// @Param        gender         query  string  false  "Only users of this gender"
+// @Param        birthday_from  query  string  false  "Born on or after (YYYY-MM-DD)"
+// @Param        birthday_to    query  string  false  "Born on or before (YYYY-MM-DD)"
+// @Param        email_domain   query  string  false  "Only emails at this domain, e.g. example.com"
+// @Param        nic_flagged    query  bool    false  "Only users whose NIC contradicts their birthday or gender"
+// @Success      200  {object}  service.UserPage
+// @Failure      400  {object}  map[string]string
 // @Failure      500  {object}  map[string]string
 // @Router       /users [get]
 func (h *UserHandler) GetAllUsers(c *fiber.Ctx) error {
-	users, err := h.userService.GetAllUsers()
+	page, err := h.userService.ListUsers(userListParams(c))
+	if err != nil {
+		return userListError(c, err)
+	}
+	return c.JSON(withNextLink(c, page))
+}
+
+// SearchUsers godoc
+// @Summary      Search users
+// @Description  Find users by name, email, NIC, address or phone number. Prefixes and small typos match too.
+// @Description  Results are ranked by relevance; highlights holds the matched fields with the matches in <mark> tags (HTML-escaped).
+// @Tags         Users
+// @Produce      json
+// @Param        q      query  string  true   "Search text"
+// @Param        limit  query  int     false  "Maximum number of results (default 20, max 50)"
+// @Success      200  {array}   service.UserSearchResult
+// @Failure      400  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /users/search [get]
+func (h *UserHandler) SearchUsers(c *fiber.Ctx) error {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "q is required"})
+	}
+	limit := c.QueryInt("limit", 20)
+	if limit < 1 || limit > service.MaxUserSearchLimit {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("limit must be between 1 and %d", service.MaxUserSearchLimit)})
+	}
+
+	results, err := h.userService.SearchUsers(query, limit)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
-	return c.JSON(users)
+	return c.JSON(results)
 }
 
 // GetUser godoc
@@ -267,6 +335,7 @@ func (h *UserHandler) GetAllUsers(c *fiber.Ctx) error {
 // @Produce      json
 // @Param        id   path      string  true  "User ID"
 // @Success      200  {object}  model.User
+// @Header       200  {string}  ETag  "Version to send as If-Match when changing the user"
 // @Failure      400  {object}  map[string]string
 // @Failure      404  {object}  map[string]string
 // @Router       /users/{id} [get]
@@ -280,6 +349,7 @@ func (h *UserHandler) GetUser(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
 	}
+	setETag(c, user.Version)
 	return c.JSON(user)
 }
 
@@ -291,6 +361,7 @@ func (h *UserHandler) GetUser(c *fiber.Ctx) error {
 // @Produce      json
 // @Param        id   path      string  true  "User ID"
 // @Success      200  {object}  model.User
+// @Header       200  {string}  ETag  "Version to send as If-Match when changing the user"
 // @Failure      400  {object}  map[string]string
 // @Failure      404  {object}  map[string]string
 // @Router       /users/{id}/with-phones [get]
@@ -304,24 +375,116 @@ func (h *UserHandler) GetUserWithPhones(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
 	}
+	setETag(c, userWithPhones.Version)
 	return c.JSON(userWithPhones)
 }
 
 // GetAllUsersWithPhones godoc
-// @Summary      Get all users with their phone numbers
-// @Description  Retrieve all users along with their associated phone numbers
+// @Summary      List users with their phone numbers
+// @Description  Same paging, filtering and sorting as GET /users, with each user's phone numbers included
 // @Tags         Users
 // @Accept       json
 // @Produce      json
-// @Success      200  {array}   model.User
+// @Param        limit          query  int     false  "Page size (default 20, max 100)"
+// @Param        cursor         query  string  false  "Cursor from the previous page"
+// @Param        sort           query  string  false  "created (default), name, email or birthday"
+// @Param        order          query  string  false  "asc (default) or desc"
+// @Param        gender         query  string  false  "Only users of this gender"
+// @Param        birthday_from  query  string  false  "Born on or after (YYYY-MM-DD)"
+// @Param        birthday_to    query  string  false  "Born on or before (YYYY-MM-DD)"
+// @Param        email_domain   query  string  false  "Only emails at this domain, e.g. example.com"
+// @Param        nic_flagged    query  bool    false  "Only users whose NIC contradicts their birthday or gender"
+// @Success      200  {object}  service.UserPage
+// @Failure      400  {object}  map[string]string
 // @Failure      500  {object}  map[string]string
 // @Router       /users/with-phones [get]
 func (h *UserHandler) GetAllUsersWithPhones(c *fiber.Ctx) error {
-	users, err := h.userService.GetAllUsersWithPhones()
+	page, err := h.userService.ListUsersWithPhones(userListParams(c))
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		return userListError(c, err)
+	}
+	return c.JSON(withNextLink(c, page))
+}
+
+// userListParams reads the listing options from the query string
+func userListParams(c *fiber.Ctx) service.UserListParams {
+	return service.UserListParams{
+		Limit:        c.QueryInt("limit", 0),
+		Cursor:       c.Query("cursor"),
+		Sort:         c.Query("sort"),
+		Order:        c.Query("order"),
+		Gender:       c.Query("gender"),
+		BirthdayFrom: c.Query("birthday_from"),
+		BirthdayTo:   c.Query("birthday_to"),
+		EmailDomain:  c.Query("email_domain"),
+		NICFlagged:   c.QueryBool("nic_flagged"),
+	}
+}
+
+// withNextLink adds the URL of the next page to the body and the Link header
+func withNextLink(c *fiber.Ctx, page *service.UserPage) *service.UserPage {
+	if page.Pagination.NextCursor == "" {
+		return page
+	}
+	query := url.Values{}
+	for key, value := range c.Queries() {
+		query.Set(key, value)
+	}
+	query.Set("cursor", page.Pagination.NextCursor)
+	query.Set("limit", strconv.Itoa(page.Pagination.Limit))
+
+	page.Pagination.Next = c.BaseURL() + c.Path() + "?" + query.Encode()
+	c.Append(fiber.HeaderLink, fmt.Sprintf("<%s>; rel=\"next\"", page.Pagination.Next))
+	return page
+}
+
+// userConflict answers a write that lost a race with another change to the user
+func (h *UserHandler) userConflict(c *fiber.Ctx, userID primitive.ObjectID) error {
+	current, err := h.userService.GetUser(userID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	return preconditionFailed(c, current.Version, current)
+}
+
+// conflictMessages describes each unique field for a 409 response
+var conflictMessages = map[string]string{
+	"email":  "A user with this email already exists",
+	"nic":    "A user with this NIC already exists",
+	"number": "This phone number is already registered",
+}
+
+// saveError answers a failed create or update, reporting a clash with
+// another record's unique field as 409 Conflict, a bad NIC as 400, a missing
+// or deleted record as 404 and a write against an outdated version as 412
+func saveError(c *fiber.Ctx, err error) error {
+	if dup, ok := repository.IsDuplicateKey(err); ok {
+		message, known := conflictMessages[dup.Field]
+		if !known {
+			message = dup.Error()
+		}
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": message, "field": dup.Field})
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if errors.Is(err, repository.ErrPhoneNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Phone not found"})
+	}
+	if errors.Is(err, repository.ErrVersionConflict) {
+		return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{"error": err.Error()})
+	}
+	if errors.Is(err, service.ErrInvalidNIC) || errors.Is(err, service.ErrNICMismatch) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error(), "field": "nic"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
+
+func userListError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, service.ErrInvalidListQuery) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
-	return c.JSON(users)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 }
 
 // UpdateUser godoc
@@ -339,9 +502,13 @@ func (h *UserHandler) GetAllUsersWithPhones(c *fiber.Ctx) error {
 // @Param        birthday  formData  string            false  "Birthday in YYYY-MM-DD format (simple date)"
 // @Param        gender    formData  string            false  "Gender (e.g. Male or Female)"
 // @Param        photo     formData  file              false  "User's profile image (jpg/png/gif)"
+// @Param        If-Match  header  string  true  "ETag from the last GET"
 // @Success      200  {object}  model.User
 // @Failure      400  {object}  map[string]string
 // @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      412  {object}  map[string]string  "Changed since read; body has the current version"
+// @Failure      428  {object}  map[string]string  "If-Match missing"
 // @Failure      500  {object}  map[string]string
 // @Router       /users/{id} [put]
 func (h *UserHandler) UpdateUser(c *fiber.Ctx) error {
@@ -350,6 +517,89 @@ func (h *UserHandler) UpdateUser(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
 	}
+	if _, sent := parseIfMatch(c); !sent {
+		return preconditionRequired(c)
+	}
+	return h.updateUser(c, userID)
+}
+
+// PatchUser godoc
+// @Summary      Patch a user
+// @Description  Apply an RFC 7396 JSON Merge Patch to the user's profile. Fields left out are kept and null clears a field;
+// @Description  name, email, NIC, birthday and gender cannot be cleared, and photo can only be cleared.
+// @Tags         Users
+// @Accept       application/merge-patch+json
+// @Produce      json
+// @Param        id     path  string             true  "User ID"
+// @Param        patch  body  UpdateUserRequest  true  "Merge patch"
+// @Param        If-Match  header  string  true  "ETag from the last GET"
+// @Success      200  {object}  model.User
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      415  {object}  map[string]string
+// @Failure      412  {object}  map[string]string  "Changed since read; body has the current version"
+// @Failure      428  {object}  map[string]string  "If-Match missing"
+// @Failure      500  {object}  map[string]string
+// @Router       /users/{id} [patch]
+func (h *UserHandler) PatchUser(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	if _, sent := parseIfMatch(c); !sent {
+		return preconditionRequired(c)
+	}
+	return h.patchUser(c, userID)
+}
+
+func (h *UserHandler) patchUser(c *fiber.Ctx, userID primitive.ObjectID) error {
+	if !isMergePatch(c) {
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{"error": "Content-Type must be " + mergePatchType})
+	}
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal(c.Body(), &patch); err != nil || patch == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "A merge patch must be a JSON object"})
+	}
+	actorID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
+
+	ifMatch, _ := parseIfMatch(c)
+	user, changed, err := h.userService.PatchUser(userID, actorID, ifMatch, patch)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidPatch) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+		}
+		if errors.Is(err, repository.ErrVersionConflict) {
+			return h.userConflict(c, userID)
+		}
+		return saveError(c, err)
+	}
+	for _, field := range changed {
+		if field == "email" {
+			h.sendVerification(user)
+		}
+	}
+	setETag(c, user.Version)
+	return c.JSON(user)
+}
+
+const mergePatchType = "application/merge-patch+json"
+
+// isMergePatch reports whether the request body is a JSON Merge Patch
+func isMergePatch(c *fiber.Ctx) bool {
+	return strings.HasPrefix(strings.ToLower(c.Get(fiber.HeaderContentType)), mergePatchType)
+}
+
+// updateUser applies a JSON or multipart profile update; fields left out keep their value
+func (h *UserHandler) updateUser(c *fiber.Ctx, userID primitive.ObjectID) error {
+	actorID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
+	ifMatch, _ := parseIfMatch(c)
 
 	// Try to parse as multipart form first
 	form, err := c.MultipartForm()
@@ -365,11 +615,14 @@ func (h *UserHandler) UpdateUser(c *fiber.Ctx) error {
 		if err != nil {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
 		}
+		if !ifMatch.Allows(existingUser.Version) {
+			return preconditionFailed(c, existingUser.Version, existingUser)
+		}
 
 		// Create updated user object, keeping existing values for fields not provided
 		var user model.User
 		user.ID = userID
-		user.Password = existingUser.Password // Keep existing password
+		keepAccountState(&user, existingUser)
 
 		if req.Name != "" {
 			user.Name = req.Name
@@ -415,9 +668,23 @@ func (h *UserHandler) UpdateUser(c *fiber.Ctx) error {
 		// Keep existing photo
 		user.Photo = existingUser.Photo
 
-		if err := h.userService.UpdateUser(&user); err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+		// A changed address has to be verified again
+		emailChanged := user.Email != existingUser.Email
+		if emailChanged {
+			user.EmailVerified = false
+			user.EmailVerifiedAt = nil
 		}
+
+		if err := h.userService.UpdateUser(&user, actorID); err != nil {
+			if errors.Is(err, repository.ErrVersionConflict) {
+				return h.userConflict(c, userID)
+			}
+			return saveError(c, err)
+		}
+		if emailChanged {
+			h.sendVerification(&user)
+		}
+		setETag(c, user.Version)
 		return c.JSON(user)
 	}
 
@@ -426,10 +693,14 @@ func (h *UserHandler) UpdateUser(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
 	}
+	if !ifMatch.Allows(existingUser.Version) {
+		return preconditionFailed(c, existingUser.Version, existingUser)
+	}
 
 	// Update fields from form
 	var user model.User
 	user.ID = userID
+	keepAccountState(&user, existingUser)
 
 	if name := form.Value["name"]; len(name) > 0 {
 		user.Name = name[0]
@@ -473,49 +744,113 @@ func (h *UserHandler) UpdateUser(c *fiber.Ctx) error {
 	// Handle file upload if provided
 	files := form.File["photo"]
 	if len(files) > 0 {
-		file := files[0]
-
-		// Validate file type
-		ext := filepath.Ext(file.Filename)
-		if ext != ".jpg" && ext != ".jpeg" && ext != ".png" && ext != ".gif" {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Only image files are allowed"})
+		photo, err := savePhoto(c, files[0])
+		if err != nil {
+			return photoError(c, err)
 		}
+		user.Photo = photo
+	}
 
-		// Create uploads directory if it doesn't exist
-		uploadDir := "./storage/uploads"
-		if err := os.MkdirAll(uploadDir, 0755); err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create upload directory"})
+	// A changed address has to be verified again
+	emailChanged := user.Email != existingUser.Email
+	if emailChanged {
+		user.EmailVerified = false
+		user.EmailVerifiedAt = nil
+	}
+
+	if err := h.userService.UpdateUser(&user, actorID); err != nil {
+		if errors.Is(err, repository.ErrVersionConflict) {
+			return h.userConflict(c, userID)
 		}
+		return saveError(c, err)
+	}
+	if emailChanged {
+		h.sendVerification(&user)
+	}
+	setETag(c, user.Version)
+	return c.JSON(user)
+}
 
-		// Generate unique filename
-		filename := fmt.Sprintf("%d_%s", time.Now().Unix(), file.Filename)
-		filePath := fmt.Sprintf("%s/%s", uploadDir, filename)
+var errInvalidPhotoType = errors.New("only image files are allowed")
 
-		// Save file
-		if err := c.SaveFile(file, filePath); err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not save file"})
-		}
+// savePhoto stores an uploaded profile image and returns the path it is served under
+func savePhoto(c *fiber.Ctx, file *multipart.FileHeader) (string, error) {
+	// Validate file type
+	ext := filepath.Ext(file.Filename)
+	if ext != ".jpg" && ext != ".jpeg" && ext != ".png" && ext != ".gif" {
+		return "", errInvalidPhotoType
+	}
 
-		// Update photo path
-		user.Photo = fmt.Sprintf("/uploads/%s", filename)
+	// Create uploads directory if it doesn't exist
+	uploadDir := "./storage/uploads"
+	if err := os.MkdirAll(uploadDir, 0755); err != nil {
+		return "", fmt.Errorf("could not create upload directory: %w", err)
 	}
 
-	if err := h.userService.UpdateUser(&user); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	// Generate unique filename
+	filename := fmt.Sprintf("%d_%s", time.Now().Unix(), file.Filename)
+	filePath := fmt.Sprintf("%s/%s", uploadDir, filename)
+
+	// Save file
+	if err := c.SaveFile(file, filePath); err != nil {
+		return "", fmt.Errorf("could not save file: %w", err)
 	}
-	return c.JSON(user)
+	return fmt.Sprintf("/uploads/%s", filename), nil
+}
+
+func photoError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, errInvalidPhotoType) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Only image files are allowed"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not save file"})
+}
+
+// keepAccountState copies the account state UpdateUser leaves alone from the stored user,
+// so the response shows it
+func keepAccountState(user, existing *model.User) {
+	user.Password = existing.Password // Keep existing password
+	user.Roles = existing.Roles       // Roles are managed through the role endpoints
+	user.PasswordHistory = existing.PasswordHistory
+	user.LockedUntil = existing.LockedUntil
+	user.EmailVerified = existing.EmailVerified
+	user.EmailVerifiedAt = existing.EmailVerifiedAt
+	user.TwoFactorEnabled = existing.TwoFactorEnabled
+	user.TwoFactorSecret = existing.TwoFactorSecret
+	user.TwoFactorPendingSecret = existing.TwoFactorPendingSecret
+	user.TwoFactorBackupCodes = existing.TwoFactorBackupCodes
+	user.TwoFactorLastStep = existing.TwoFactorLastStep
+	user.Identities = existing.Identities
+	user.DeletionScheduledAt = existing.DeletionScheduledAt
+	user.Version = existing.Version
+}
+
+// passwordPolicyError reports every violated password rule, or a generic failure
+func passwordPolicyError(c *fiber.Ctx, err error) error {
+	var policyErr *password.PolicyError
+	if errors.As(err, &policyErr) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":      "Password does not meet the requirements",
+			"violations": policyErr.Violations,
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update password"})
 }
 
 // DeleteUser godoc
 // @Summary      Delete a user
-// @Description  Delete a user by ID
+// @Description  Soft-delete a user by ID. The user is hidden and signed out, and can be restored by an admin until the retention period ends.
 // @Tags         Users
 // @Accept       json
 // @Produce      json
 // @Param        id   path      string  true  "User ID"
+// @Param        If-Match  header  string  true  "ETag from the last GET"
 // @Success      204  "No Content"
 // @Failure      400  {object}  map[string]string
 // @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string  "The user is the last admin"
+// @Failure      412  {object}  map[string]string  "Changed since read; body has the current version"
+// @Failure      428  {object}  map[string]string  "If-Match missing"
+// @Failure      500  {object}  map[string]string
 // @Router       /users/{id} [delete]
 func (h *UserHandler) DeleteUser(c *fiber.Ctx) error {
 	id := c.Params("id")
@@ -523,13 +858,132 @@ func (h *UserHandler) DeleteUser(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
 	}
+	actorID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
 
-	if err := h.userService.DeleteUser(userID); err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	ifMatch, sent := parseIfMatch(c)
+	if !sent {
+		return preconditionRequired(c)
+	}
+
+	if err := h.userService.DeleteUser(userID, actorID, ifMatch); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+		if errors.Is(err, repository.ErrVersionConflict) {
+			return h.userConflict(c, userID)
+		}
+		if errors.Is(err, service.ErrDeleteLastAdmin) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
+// PurgeUser godoc
+// @Summary      Permanently delete a user
+// @Description  Remove a user, live or soft-deleted, together with their phone numbers and photo. This cannot be undone.
+// @Tags         Users
+// @Produce      json
+// @Param        id   path      string  true  "User ID"
+// @Param        If-Match  header  string  true  "ETag from the last GET, or the version of a deleted user"
+// @Success      200  {object}  service.DeletionResult
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string  "The user is the last admin"
+// @Failure      412  {object}  map[string]string  "Changed since read; body has the current version"
+// @Failure      428  {object}  map[string]string  "If-Match missing"
+// @Failure      500  {object}  map[string]string
+// @Router       /users/{id}/permanent [delete]
+func (h *UserHandler) PurgeUser(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	ifMatch, sent := parseIfMatch(c)
+	if !sent {
+		return preconditionRequired(c)
+	}
+
+	result, err := h.userService.PurgeUser(userID, ifMatch)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+		if errors.Is(err, repository.ErrVersionConflict) {
+			// The user may be soft-deleted, which userConflict would report as missing
+			current, err := h.userService.GetUserIncludingDeleted(userID)
+			if err != nil {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+			}
+			return preconditionFailed(c, current.Version, current)
+		}
+		if errors.Is(err, service.ErrDeleteLastAdmin) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(result)
+}
+
+// RestoreUser godoc
+// @Summary      Restore a deleted user
+// @Description  Undo a soft delete, as long as the user has not been purged yet
+// @Tags         Users
+// @Produce      json
+// @Param        id   path      string  true  "User ID"
+// @Success      200  {object}  model.User
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string  "No deleted user with this ID"
+// @Failure      409  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /users/{id}/restore [post]
+func (h *UserHandler) RestoreUser(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	actorID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
+
+	user, err := h.userService.RestoreUser(userID, actorID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "No deleted user with this ID"})
+		}
+		return saveError(c, err)
+	}
+	return c.JSON(user)
+}
+
+// GetDeletedUsers godoc
+// @Summary      List deleted users
+// @Description  Soft-deleted users that can still be restored, with the same paging, filtering and sorting as GET /users
+// @Tags         Users
+// @Produce      json
+// @Param        limit   query  int     false  "Page size (default 20, max 100)"
+// @Param        cursor  query  string  false  "Cursor from the previous page"
+// @Param        sort    query  string  false  "created (default), name, email or birthday"
+// @Param        order   query  string  false  "asc (default) or desc"
+// @Success      200  {object}  service.UserPage
+// @Failure      400  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /users/deleted [get]
+func (h *UserHandler) GetDeletedUsers(c *fiber.Ctx) error {
+	params := userListParams(c)
+	params.Deleted = true
+	page, err := h.userService.ListUsers(params)
+	if err != nil {
+		return userListError(c, err)
+	}
+	return c.JSON(withNextLink(c, page))
+}
+
 // UpdateUserPassword godoc
 // @Summary      Update user password
 // @Description  Update a user's password with current password verification
@@ -539,12 +993,15 @@ func (h *UserHandler) DeleteUser(c *fiber.Ctx) error {
 // @Param        id      path      string                 true  "User ID"
 // @Param        request body      UpdatePasswordRequest  true  "Password update data"
 // @Param        currentPassword  body  string  true  "Current password for verification"  example("oldpassword123")
-// @Param        newPassword      body  string  true  "New password (minimum 6 characters)" example("newpassword123")
+// @Param        newPassword      body  string  true  "New password (must satisfy the password policy)" example("newpassword123")
 // @Param        confirmPassword  body  string  true  "Confirm new password (must match newPassword)" example("newpassword123")
+// @Param        If-Match  header  string  true  "ETag from the last GET"
 // @Success      200  {object}  map[string]string  "Password updated successfully"
 // @Failure      400  {object}  map[string]string  "Invalid request or validation errors"
 // @Failure      401  {object}  map[string]string  "Current password is incorrect"
 // @Failure      404  {object}  map[string]string  "User not found"
+// @Failure      412  {object}  map[string]string  "Changed since read; body has the current version"
+// @Failure      428  {object}  map[string]string  "If-Match missing"
 // @Failure      500  {object}  map[string]string  "Internal server error"
 // @Router       /users/{id}/password [put]
 func (h *UserHandler) UpdateUserPassword(c *fiber.Ctx) error {
@@ -553,7 +1010,19 @@ func (h *UserHandler) UpdateUserPassword(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
 	}
+	if _, sent := parseIfMatch(c); !sent {
+		return preconditionRequired(c)
+	}
+	return h.updatePassword(c, userID)
+}
 
+// updatePassword changes the password after checking the current one
+func (h *UserHandler) updatePassword(c *fiber.Ctx, userID primitive.ObjectID) error {
+	actorID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
+	ifMatch, _ := parseIfMatch(c)
 	var req UpdatePasswordRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
@@ -564,33 +1033,29 @@ func (h *UserHandler) UpdateUserPassword(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "New password and confirm password do not match"})
 	}
 
-	// Validate password length
-	if len(req.NewPassword) < 6 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "New password must be at least 6 characters long"})
-	}
-
 	// Get existing user
 	existingUser, err := h.userService.GetUser(userID)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
 	}
+	if !ifMatch.Allows(existingUser.Version) {
+		return preconditionFailed(c, existingUser.Version, existingUser)
+	}
 
 	// Verify current password
-	if err := bcrypt.CompareHashAndPassword([]byte(existingUser.Password), []byte(req.CurrentPassword)); err != nil {
+	if !h.userService.VerifyPassword(existingUser, req.CurrentPassword) {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Current password is incorrect"})
 	}
 
-	// Hash new password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to hash new password"})
-	}
-
-	// Update user with new password
-	existingUser.Password = string(hashedPassword)
-	if err := h.userService.UpdateUser(existingUser); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update password"})
+	// Check the policy and password history, then store the new password
+	if err := h.userService.ChangePassword(existingUser, req.NewPassword, actorID); err != nil {
+		if errors.Is(err, repository.ErrVersionConflict) {
+			return h.userConflict(c, userID)
+		}
+		return passwordPolicyError(c, err)
 	}
+	h.events.Record(securityEvent(c, model.EventPasswordChanged, existingUser, "password changed"))
+	setETag(c, existingUser.Version)
 
 	return c.JSON(fiber.Map{"message": "Password updated successfully"})
 }
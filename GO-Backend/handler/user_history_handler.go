@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"errors"
+	"go-fiber-app/repository"
+	"go-fiber-app/service"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 500
+)
+
+// GetUserHistory godoc
+// @Summary      Get a user's change history
+// @Description  Every change made to the user and their phone numbers, newest first: who made it, when, and each field's
+// @Description  value before and after. Pass the revision of the last entry as "before" to get the next page.
+// @Tags         Users
+// @Produce      json
+// @Param        id      path   string  true   "User ID"
+// @Param        before  query  int     false  "Only revisions older than this one"
+// @Param        limit   query  int     false  "Maximum number of entries (default 50, max 500)"
+// @Success      200  {object}  map[string]interface{}
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /users/{id}/history [get]
+func (h *UserHandler) GetUserHistory(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	limit := int64(c.QueryInt("limit", defaultHistoryLimit))
+	if limit <= 0 || limit > maxHistoryLimit {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "limit must be between 1 and 500"})
+	}
+	var before int64
+	if value := c.Query("before"); value != "" {
+		if before, err = strconv.ParseInt(value, 10, 64); err != nil || before <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "before must be a revision number"})
+		}
+	}
+
+	changes, err := h.userService.History(userID, before, limit)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"changes": changes, "count": len(changes)})
+}
+
+// RevertUser godoc
+// @Summary      Revert a user to an earlier revision
+// @Description  Put the user's profile, roles and phone numbers back the way they were after the given revision (admin only).
+// @Description  Deletion state is not reverted, and a photo is only brought back if its file still exists.
+// @Description  The revert is recorded as a new revision.
+// @Tags         Users
+// @Produce      json
+// @Param        id        path  string  true  "User ID"
+// @Param        revision  path  int     true  "Revision to go back to"
+// @Success      200  {object}  model.User
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string  "No such user or revision"
+// @Failure      409  {object}  map[string]string  "A value now belongs to someone else, or the user is the last admin"
+// @Failure      412  {object}  map[string]string  "The user changed while reverting; body has the current version"
+// @Failure      500  {object}  map[string]string
+// @Router       /users/{id}/history/{revision}/revert [post]
+func (h *UserHandler) RevertUser(c *fiber.Ctx) error {
+	userID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid ID"})
+	}
+	revision, err := strconv.ParseInt(c.Params("revision"), 10, 64)
+	if err != nil || revision <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid revision"})
+	}
+	actorID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	}
+
+	user, changed, err := h.userService.RevertUser(userID, actorID, revision)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRevisionNotFound):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, service.ErrLastAdmin):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, repository.ErrVersionConflict):
+			return h.userConflict(c, userID)
+		}
+		return saveError(c, err)
+	}
+	for _, field := range changed {
+		if field == "email" {
+			h.sendVerification(user)
+		}
+	}
+	setETag(c, user.Version)
+	return c.JSON(user)
+}
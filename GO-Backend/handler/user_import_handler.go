@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"go-fiber-app/service"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type UserImportHandler struct {
+	importService *service.UserImportService
+}
+
+func NewUserImportHandler(importService *service.UserImportService) *UserImportHandler {
+	return &UserImportHandler{importService: importService}
+}
+
+// ImportUsers godoc
+// @Summary      Import users from a CSV or XLSX file
+// @Description  Create users from the rows of a .csv file or the first sheet of a .xlsx file. The first row holds the column
+// @Description  headers: name, email, nic, address, birthday (YYYY-MM-DD), gender and password, or others named in the mapping.
+// @Description  Each row is checked with the same rules as creating a user one by one. Rows without a password create a
+// @Description  user who is emailed an invite to choose one.
+// @Description  With dry_run the file is only checked, and the response lists what is wrong with each row. Otherwise the valid
+// @Description  rows are imported in the background; poll the returned job for progress and the errors of rows that failed.
+// @Tags         Users
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        file     formData  file    true   "The .csv or .xlsx file"
+// @Param        mapping  formData  string  false  "JSON object naming the column to read a field from, e.g. {\"email\": \"E-mail address\"}"
+// @Param        dry_run  query     bool    false  "Only check the file"
+// @Success      200  {object}  service.ImportReport  "Dry run"
+// @Success      202  {object}  model.ImportJob       "Import started"
+// @Failure      400  {object}  map[string]string     "No file, or a file or mapping that cannot be used"
+// @Failure      500  {object}  map[string]string
+// @Router       /users/import [post]
+func (h *UserImportHandler) ImportUsers(c *fiber.Ctx) error {
+	actorID, err := currentUserID(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Unauthorized"})
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Upload the file to import as \"file\""})
+	}
+	mapping := map[string]string{}
+	if value := c.FormValue("mapping"); value != "" {
+		if err := json.Unmarshal([]byte(value), &mapping); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "mapping must be a JSON object of field names to column headers"})
+		}
+	}
+	dryRun := c.QueryBool("dry_run")
+	if value := c.FormValue("dry_run"); value != "" {
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "dry_run must be true or false"})
+		}
+	}
+
+	upload, err := header.Open()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read the uploaded file"})
+	}
+	defer upload.Close()
+	file, err := h.importService.ReadImportFile(header.Filename, upload)
+	if err != nil {
+		return importError(c, err)
+	}
+
+	if dryRun {
+		report, err := h.importService.DryRun(file, mapping)
+		if err != nil {
+			return importError(c, err)
+		}
+		return c.JSON(report)
+	}
+	job, err := h.importService.StartImport(file, mapping, actorID)
+	if err != nil {
+		return importError(c, err)
+	}
+	c.Set(fiber.HeaderLocation, "/api/users/import/"+job.ID.Hex())
+	return c.Status(fiber.StatusAccepted).JSON(job)
+}
+
+// GetImportJob godoc
+// @Summary      Get the progress of a user import
+// @Description  Counts of the rows processed, created, invited and failed so far, and the errors of the rows that failed.
+// @Description  The status is queued, running, completed or failed.
+// @Tags         Users
+// @Produce      json
+// @Param        jobId  path  string  true  "Import job ID"
+// @Success      200  {object}  model.ImportJob
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /users/import/{jobId} [get]
+func (h *UserImportHandler) GetImportJob(c *fiber.Ctx) error {
+	jobID, err := primitive.ObjectIDFromHex(c.Params("jobId"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid job ID"})
+	}
+	job, err := h.importService.Job(jobID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Import job not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(job)
+}
+
+func importError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, service.ErrInvalidImport) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+}
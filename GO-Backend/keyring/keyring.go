@@ -0,0 +1,217 @@
+package keyring
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrUnknownKey = errors.New("unknown signing key")
+	ErrNoKeys     = errors.New("no signing keys found")
+)
+
+// Key is one entry of the key ring. Keys without a private part are kept only
+// to verify tokens signed before a rotation.
+type Key struct {
+	ID        string
+	Algorithm string // "RS256" or "EdDSA"
+	Private   crypto.Signer
+	Public    crypto.PublicKey
+}
+
+// KeyRing holds the JWT signing keys loaded from a directory of PEM files.
+// Each file is named <kid>.pem and holds either a private key (sign + verify)
+// or a public key (verify only). The active key signs new tokens; every key in
+// the ring verifies, so old tokens keep working while a rotation overlaps.
+type KeyRing struct {
+	dir       string
+	activeKID string
+
+	mu     sync.RWMutex
+	keys   map[string]*Key
+	active *Key
+}
+
+// Load reads every *.pem file in dir. activeKID selects the signing key; it may
+// be empty when the directory holds exactly one private key.
+func Load(dir, activeKID string) (*KeyRing, error) {
+	r := &KeyRing{dir: dir, activeKID: activeKID}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload re-reads the key directory, e.g. after a new key was added for rotation
+func (r *KeyRing) Reload() error {
+	files, err := filepath.Glob(filepath.Join(r.dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*Key)
+	var private []*Key
+	for _, file := range files {
+		key, err := loadKeyFile(file)
+		if err != nil {
+			return err
+		}
+		keys[key.ID] = key
+		if key.Private != nil {
+			private = append(private, key)
+		}
+	}
+	if len(keys) == 0 {
+		return ErrNoKeys
+	}
+
+	var active *Key
+	switch {
+	case r.activeKID != "":
+		active = keys[r.activeKID]
+		if active == nil || active.Private == nil {
+			return fmt.Errorf("active key %q has no private key in %s", r.activeKID, r.dir)
+		}
+	case len(private) == 1:
+		active = private[0]
+	default:
+		return fmt.Errorf("found %d private keys in %s, set the active key ID", len(private), r.dir)
+	}
+
+	r.mu.Lock()
+	r.keys = keys
+	r.active = active
+	r.mu.Unlock()
+	return nil
+}
+
+// ActiveKeyID returns the kid new tokens are signed with
+func (r *KeyRing) ActiveKeyID() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.active.ID
+}
+
+// Sign signs the claims with the active key and sets the kid header
+func (r *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	r.mu.RLock()
+	active := r.active
+	r.mu.RUnlock()
+
+	token := jwt.NewWithClaims(signingMethod(active.Algorithm), claims)
+	token.Header["kid"] = active.ID
+	return token.SignedString(active.Private)
+}
+
+// Parse verifies a token against the key named by its kid header
+func (r *KeyRing) Parse(tokenString string) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, r.keyfunc, jwt.WithValidMethods([]string{"RS256", "EdDSA"}))
+}
+
+func (r *KeyRing) keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	r.mu.RLock()
+	key := r.keys[kid]
+	r.mu.RUnlock()
+
+	if key == nil {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("key %q does not sign with %s", kid, token.Method.Alg())
+	}
+	return key.Public, nil
+}
+
+// Keys returns every key in the ring sorted by kid
+func (r *KeyRing) Keys() []*Key {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	keys := make([]*Key, 0, len(r.keys))
+	for _, key := range r.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys
+}
+
+// GenerateEd25519 writes a new Ed25519 private key to dir/<kid>.pem. It is meant
+// for development setups that start without any keys.
+func GenerateEd25519(dir, kid string) error {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	return os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0600)
+}
+
+func loadKeyFile(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block found", path)
+	}
+	kid := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	var parsed interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &Key{ID: kid, Algorithm: "RS256", Private: k, Public: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		return &Key{ID: kid, Algorithm: "RS256", Public: k}, nil
+	case ed25519.PrivateKey:
+		return &Key{ID: kid, Algorithm: "EdDSA", Private: k, Public: k.Public()}, nil
+	case ed25519.PublicKey:
+		return &Key{ID: kid, Algorithm: "EdDSA", Public: k}, nil
+	default:
+		return nil, fmt.Errorf("%s: only RSA and Ed25519 keys are supported", path)
+	}
+}
+
+func signingMethod(alg string) jwt.SigningMethod {
+	if alg == "EdDSA" {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
@@ -0,0 +1,261 @@
+package keyring
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func writeRSAKey(t *testing.T, dir, kid string, private bool) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	if !private {
+		block = &pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&key.PublicKey)}
+	}
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writePublicOnly replaces dir/<kid>.pem with its public half, the way a key is
+// retired after a rotation
+func writePublicOnly(t *testing.T, dir, kid string) {
+	t.Helper()
+	key, err := loadKeyFile(filepath.Join(dir, kid+".pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(key.Public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func claims() jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{Subject: "user-1", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name       string
+		setup      func(t *testing.T, dir string)
+		activeKID  string
+		wantActive string
+		wantErr    bool
+	}{
+		{
+			name:    "empty directory",
+			setup:   func(t *testing.T, dir string) {},
+			wantErr: true,
+		},
+		{
+			name:       "single private key is active",
+			setup:      func(t *testing.T, dir string) { mustGenerate(t, dir, "k1") },
+			wantActive: "k1",
+		},
+		{
+			name: "two private keys need an active kid",
+			setup: func(t *testing.T, dir string) {
+				mustGenerate(t, dir, "k1")
+				mustGenerate(t, dir, "k2")
+			},
+			wantErr: true,
+		},
+		{
+			name: "active kid picks one of several",
+			setup: func(t *testing.T, dir string) {
+				mustGenerate(t, dir, "k1")
+				writeRSAKey(t, dir, "k2", true)
+			},
+			activeKID:  "k2",
+			wantActive: "k2",
+		},
+		{
+			name: "active kid without a private key",
+			setup: func(t *testing.T, dir string) {
+				mustGenerate(t, dir, "k1")
+				writeRSAKey(t, dir, "k2", false)
+			},
+			activeKID: "k2",
+			wantErr:   true,
+		},
+		{
+			name: "unknown active kid",
+			setup: func(t *testing.T, dir string) {
+				mustGenerate(t, dir, "k1")
+			},
+			activeKID: "k9",
+			wantErr:   true,
+		},
+		{
+			name: "unsupported PEM block",
+			setup: func(t *testing.T, dir string) {
+				data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte{1}})
+				os.WriteFile(filepath.Join(dir, "cert.pem"), data, 0600)
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tt.setup(t, dir)
+			ring, err := Load(dir, tt.activeKID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && ring.ActiveKeyID() != tt.wantActive {
+				t.Errorf("ActiveKeyID() = %q, want %q", ring.ActiveKeyID(), tt.wantActive)
+			}
+		})
+	}
+}
+
+func mustGenerate(t *testing.T, dir, kid string) {
+	t.Helper()
+	if err := GenerateEd25519(dir, kid); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	dir := t.TempDir()
+	mustGenerate(t, dir, "2024-01")
+	ring, err := Load(dir, "2024-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := ring.Sign(claims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Add an RSA key, make it active and retire the old key to verify-only
+	writeRSAKey(t, dir, "2024-06", true)
+	writePublicOnly(t, dir, "2024-01")
+	ring.activeKID = "2024-06"
+	if err := ring.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	newToken, err := ring.Sign(claims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantKID string
+		wantAlg string
+	}{
+		{"token signed before the rotation", oldToken, "2024-01", "EdDSA"},
+		{"token signed after the rotation", newToken, "2024-06", "RS256"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := ring.Parse(tt.token)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if kid := token.Header["kid"]; kid != tt.wantKID {
+				t.Errorf("kid = %v, want %q", kid, tt.wantKID)
+			}
+			if alg := token.Method.Alg(); alg != tt.wantAlg {
+				t.Errorf("alg = %q, want %q", alg, tt.wantAlg)
+			}
+		})
+	}
+
+	// Once the old key is removed its tokens stop verifying
+	if err := os.Remove(filepath.Join(dir, "2024-01.pem")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ring.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ring.Parse(oldToken); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Parse() after removing the key error = %v, want %v", err, ErrUnknownKey)
+	}
+	if _, err := ring.Parse(newToken); err != nil {
+		t.Errorf("Parse() of a current token error = %v", err)
+	}
+}
+
+func TestParseRejectsAlgorithmMismatch(t *testing.T) {
+	dir := t.TempDir()
+	mustGenerate(t, dir, "ed")
+	ring, err := Load(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An RS256 token claiming the kid of an Ed25519 key
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims())
+	token.Header["kid"] = "ed"
+	forged, err := token.SignedString(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ring.Parse(forged); err == nil {
+		t.Error("Parse() accepted a token whose algorithm does not match its key")
+	}
+
+	// HS256 is never accepted
+	hmac := jwt.NewWithClaims(jwt.SigningMethodHS256, claims())
+	hmac.Header["kid"] = "ed"
+	signed, _ := hmac.SignedString([]byte("secret"))
+	if _, err := ring.Parse(signed); err == nil {
+		t.Error("Parse() accepted an HS256 token")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	dir := t.TempDir()
+	mustGenerate(t, dir, "b-ed")
+	writeRSAKey(t, dir, "a-rsa", false)
+	ring, err := Load(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := ring.JWKS()
+	tests := []struct {
+		kid, kty, alg, crv string
+	}{
+		{"a-rsa", "RSA", "RS256", ""},
+		{"b-ed", "OKP", "EdDSA", "Ed25519"},
+	}
+	if len(set.Keys) != len(tests) {
+		t.Fatalf("JWKS() has %d keys, want %d", len(set.Keys), len(tests))
+	}
+	for i, tt := range tests {
+		got := set.Keys[i]
+		if got.Kid != tt.kid || got.Kty != tt.kty || got.Alg != tt.alg || got.Crv != tt.crv || got.Use != "sig" {
+			t.Errorf("JWKS().Keys[%d] = %+v, want kid %s kty %s alg %s crv %q", i, got, tt.kid, tt.kty, tt.alg, tt.crv)
+		}
+	}
+	if set.Keys[0].N == "" || set.Keys[0].E != "AQAB" {
+		t.Errorf("RSA key n/e = %q/%q, want a modulus and AQAB", set.Keys[0].N, set.Keys[0].E)
+	}
+	if _, ok := ring.Keys()[1].Public.(ed25519.PublicKey); !ok || len(set.Keys[1].X) != 43 {
+		t.Errorf("Ed25519 x = %q, want a 32 byte key", set.Keys[1].X)
+	}
+}
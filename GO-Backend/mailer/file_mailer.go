@@ -0,0 +1,57 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileMailer writes each message as an .eml file into a directory, or to
+// stdout when no directory is configured. Nothing is actually delivered.
+type FileMailer struct {
+	dir  string
+	from string
+	out  io.Writer
+	mu   sync.Mutex
+}
+
+func NewFileMailer(dir, from string) *FileMailer {
+	return &FileMailer{dir: dir, from: from, out: os.Stdout}
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	content := buildMessage(m.from, msg)
+
+	if m.dir == "" {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		_, err := fmt.Fprintf(m.out, "----- mail -----\n%s\n----------------\n", content)
+		return err
+	}
+
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return fmt.Errorf("error creating mail directory: %w", err)
+	}
+	filename := fmt.Sprintf("%d_%s.eml", time.Now().UnixNano(), sanitize(msg.To))
+	if err := os.WriteFile(filepath.Join(m.dir, filename), []byte(content), 0644); err != nil {
+		return fmt.Errorf("error writing mail file: %w", err)
+	}
+	return nil
+}
+
+func sanitize(s string) string {
+	out := make([]rune, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			out = append(out, r)
+		default:
+			out = append(out, '_')
+		}
+	}
+	return string(out)
+}
@@ -2,23 +2,32 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"go-fiber-app/config"
 	"go-fiber-app/handler"
+	"go-fiber-app/keyring"
+	"go-fiber-app/mailer"
+	"go-fiber-app/middleware"
 	model "go-fiber-app/models"
+	"go-fiber-app/nic"
+	"go-fiber-app/password"
 	"go-fiber-app/repository"
 	"go-fiber-app/routes"
+	"go-fiber-app/search"
 	"go-fiber-app/service"
 	"go-fiber-app/utils"
 	"log"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	_ "go-fiber-app/docs" // important for swag docs
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
-	jwtware "github.com/gofiber/jwt/v3"
 	fiberSwagger "github.com/swaggo/fiber-swagger" // fiber swagger middleware
 	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
@@ -41,8 +50,9 @@ func main() {
 	// CORS middleware
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     "http://localhost:5173", // Allow Vue app origin
-		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, X-Requested-With",
+		AllowMethods:     "GET,POST,PUT,PATCH,DELETE,OPTIONS",
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, X-Requested-With, X-API-Key, If-Match",
+		ExposeHeaders:    "Retry-After, Link, ETag",
 		AllowCredentials: true,
 	}))
 
@@ -61,39 +71,415 @@ func main() {
 	})
 
 	db := config.GetDatabase()
+	appMailer := newMailer()
 	userRepo := repository.NewUserRepository(db)
 	phoneRepo := repository.NewPhoneRepository(db)
+	refreshTokenRepo := repository.NewRefreshTokenRepository(db)
+	securityEventRepo := repository.NewSecurityEventRepository(db)
+	passwordResetRepo := repository.NewPasswordResetRepository(db)
+	settingsRepo := repository.NewSettingsRepository(db)
+	apiKeyRepo := repository.NewAPIKeyRepository(db)
+	oidcStateRepo := repository.NewOIDCStateRepository(db)
+	twoFactorChallengeRepo := repository.NewTwoFactorChallengeRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+	userHistoryRepo := repository.NewUserHistoryRepository(db)
+	importJobRepo := repository.NewImportJobRepository(db)
+
+	passwordHasher := loadPasswordHasher()
+
+	// NICs saved before the 12-digit form was stored need it before the unique index is built on it
+	if migrated, err := userRepo.NormalizeLegacyNICs(context.Background(), nic.ToNewFormat); err != nil {
+		fmt.Printf("Error normalizing legacy NICs: %v\n", err)
+	} else if migrated > 0 {
+		fmt.Printf("Stored the 12-digit NIC for %d existing users\n", migrated)
+	}
+	ensureIndexes(db)
+	if err := userHistoryRepo.CreateIndexes(context.Background()); err != nil {
+		log.Fatal(err)
+	}
 
 	// Seed default data
-	seedData(userRepo)
+	seedData(userRepo, settingsRepo, passwordHasher)
+
+	// Accounts that existed before email verification are grandfathered in
+	if migrated, err := userRepo.MarkLegacyUsersVerified(context.Background()); err != nil {
+		fmt.Printf("Error migrating legacy users: %v\n", err)
+	} else if migrated > 0 {
+		fmt.Printf("Marked %d existing users as email-verified\n", migrated)
+	}
+
+	if err := securityEventRepo.SetRetention(context.Background(), utils.GetEnvDuration("SECURITY_EVENT_RETENTION", 0)); err != nil {
+		log.Fatal(err)
+	}
+	securityEvents := service.NewSecurityEventService(securityEventRepo)
+	if hook := loadAlertHook(); hook != nil {
+		securityEvents.SetAlertHook(hook, service.SecurityAlertConfig{
+			FailedAccountsPerIP: utils.GetEnvInt("SECURITY_ALERT_FAILED_ACCOUNTS_PER_IP", 5),
+			Window:              utils.GetEnvDuration("SECURITY_ALERT_WINDOW", 10*time.Minute),
+		})
+	}
 
 	userService := service.NewUserService(userRepo)
 	userService.SetPhoneRepository(phoneRepo)
-	userHandler := handler.NewUserHandler(userService)
+	userService.SetPasswordPolicy(loadPasswordPolicy(passwordHasher))
+	userService.SetPasswordHasher(passwordHasher)
+	userService.SetDeletionGracePeriod(utils.GetEnvDuration("ACCOUNT_DELETION_GRACE_PERIOD", 30*24*time.Hour))
+	transactions, err := repository.NewTransactions(context.Background(), db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !transactions.Supported() {
+		fmt.Println("MongoDB does not support transactions here (not a replica set); deletes fall back to orphan cleanup")
+	}
+	userService.SetTransactions(transactions)
+	userService.SetHistoryRepository(userHistoryRepo)
+	userService.SetDeletedUserRetention(utils.GetEnvDuration("DELETED_USER_RETENTION", 30*24*time.Hour))
+	go purgeDeletedAccounts(userService, tickerInterval("ACCOUNT_DELETION_CHECK_INTERVAL", time.Hour))
+	switch policy := service.NICPolicy(utils.GetEnv("NIC_MISMATCH_POLICY", string(service.NICFlag))); policy {
+	case service.NICFlag, service.NICReject:
+		userService.SetNICPolicy(policy)
+	default:
+		log.Fatalf("NIC_MISMATCH_POLICY must be %q or %q", service.NICFlag, service.NICReject)
+	}
+	userService.SetSearchIndex(search.NewIndex(service.UserSearchWeights))
+	go rebuildSearchIndex(userService, tickerInterval("SEARCH_REINDEX_INTERVAL", 10*time.Minute))
+	userHandler := handler.NewUserHandler(userService, securityEvents)
 
 	phoneService := service.NewPhoneService(phoneRepo)
+	phoneService.SetUserService(userService)
 	phoneHandler := handler.NewPhoneHandler(phoneService)
 
-	authHandler := handler.NewAuthHandler(userService)
+	keyRing := loadKeyRing()
+	sessionService := service.NewSessionService(sessionRepo, refreshTokenRepo)
+	userService.SetSessionService(sessionService)
+	tokenService := service.NewTokenService(
+		refreshTokenRepo,
+		userRepo,
+		sessionService,
+		keyRing,
+		utils.GetEnvDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		utils.GetEnvDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+	)
+	loginGuardConfig := service.LoginGuardConfig{
+		FreeAttempts:     utils.GetEnvInt("LOGIN_FREE_ATTEMPTS", 3),
+		BaseDelay:        utils.GetEnvDuration("LOGIN_BACKOFF_BASE", time.Second),
+		MaxDelay:         utils.GetEnvDuration("LOGIN_BACKOFF_MAX", 15*time.Minute),
+		MaxEmailFailures: utils.GetEnvInt("LOGIN_MAX_FAILURES", 5),
+		MaxIPFailures:    utils.GetEnvInt("LOGIN_MAX_IP_FAILURES", 50),
+		LockoutDuration:  utils.GetEnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		Window:           utils.GetEnvDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+	}
+	// Failed login tracking: in-memory for a single instance, Mongo when running replicas
+	var loginAttemptStore repository.LoginAttemptStore = repository.NewMemoryLoginAttemptStore(
+		loginGuardConfig.Window,
+		utils.GetEnvInt("LOGIN_ATTEMPT_MAX_ENTRIES", 100000),
+	)
+	if utils.GetEnv("LOGIN_ATTEMPT_STORE", "memory") == "mongo" {
+		mongoStore := repository.NewMongoLoginAttemptStore(db)
+		if err := mongoStore.SetExpiry(context.Background(), loginGuardConfig.CounterLifetime()); err != nil {
+			log.Fatal(err)
+		}
+		loginAttemptStore = mongoStore
+	}
+	loginGuard := service.NewLoginGuard(loginAttemptStore, userRepo, loginGuardConfig)
 
-	// JWT middleware for protected routes
-	app.Use("/api/users", jwtware.New(jwtware.Config{
-		SigningKey: []byte(os.Getenv("JWT_SECRET")),
-	}))
+	verificationService := service.NewEmailVerificationService(
+		userRepo,
+		appMailer,
+		utils.GetEnv("EMAIL_VERIFICATION_SECRET", os.Getenv("JWT_SECRET")),
+		utils.GetEnvDuration("EMAIL_VERIFICATION_TTL", 24*time.Hour),
+		utils.GetEnv("EMAIL_VERIFICATION_URL", "http://localhost:8080/api/auth/verify-email"),
+		service.VerificationPolicy(utils.GetEnv("EMAIL_VERIFICATION_POLICY", string(service.VerificationRestrict))),
+	)
+	userHandler.SetEmailVerificationService(verificationService)
+	verificationHandler := handler.NewEmailVerificationHandler(verificationService)
+
+	twoFactorService := service.NewTwoFactorService(
+		userRepo,
+		settingsRepo,
+		twoFactorChallengeRepo,
+		utils.GetEnv("TOTP_ISSUER", "Go Fiber User API"),
+		os.Getenv("JWT_SECRET"),
+		utils.GetEnvDuration("TWO_FACTOR_CHALLENGE_TTL", 5*time.Minute),
+	)
+	twoFactorHandler := handler.NewTwoFactorHandler(twoFactorService, tokenService, loginGuard, securityEvents)
+
+	authHandler := handler.NewAuthHandler(userService, tokenService, loginGuard, verificationService, twoFactorService, securityEvents)
+	if issuer := os.Getenv("OIDC_ISSUER_URL"); issuer != "" {
+		oidcService := service.NewOIDCService(oidcStateRepo, userRepo, userService, service.OIDCConfig{
+			IssuerURL:    issuer,
+			ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  utils.GetEnv("OIDC_REDIRECT_URL", "http://localhost:8080/api/auth/oidc/callback"),
+			Scopes:       strings.Fields(os.Getenv("OIDC_SCOPES")),
+			AutoCreate:   utils.GetEnv("OIDC_AUTO_CREATE", "false") == "true",
+			StateTTL:     utils.GetEnvDuration("OIDC_STATE_TTL", 10*time.Minute),
+		})
+		authHandler.SetOIDCService(oidcService, os.Getenv("OIDC_POST_LOGIN_REDIRECT"))
+	}
+	roleHandler := handler.NewRoleHandler(userService)
+	policyService := service.NewPolicyService()
+
+	passwordResetService := service.NewPasswordResetService(
+		passwordResetRepo,
+		userService,
+		sessionService,
+		appMailer,
+		utils.GetEnvDuration("PASSWORD_RESET_TTL", time.Hour),
+		utils.GetEnv("PASSWORD_RESET_URL", "http://localhost:5173/reset-password"),
+	)
+	passwordResetService.SetInviteTTL(utils.GetEnvDuration("INVITE_TTL", 7*24*time.Hour))
+	passwordResetService.SetResendInterval(utils.GetEnvDuration("PASSWORD_RESET_RESEND_INTERVAL", 5*time.Minute))
+	passwordResetHandler := handler.NewPasswordResetHandler(passwordResetService, securityEvents)
+
+	importService := service.NewUserImportService(userService, importJobRepo)
+	importService.SetInviteService(passwordResetService)
+	importService.SetEmailVerificationService(verificationService)
+	importService.SetMaxRows(utils.GetEnvInt("IMPORT_MAX_ROWS", 5000))
+	go failStaleImports(importService, tickerInterval("IMPORT_STALE_AFTER", 10*time.Minute))
+
+	apiKeyService := service.NewAPIKeyService(
+		apiKeyRepo,
+		userRepo,
+		utils.GetEnvDuration("API_KEY_DEFAULT_TTL", 90*24*time.Hour),
+		utils.GetEnvDuration("API_KEY_MAX_TTL", 365*24*time.Hour),
+	)
 
-	routes.RegisterRoutes(app, userHandler, phoneHandler, authHandler)
+	routes.RegisterRoutes(app, routes.Handlers{
+		User:          userHandler,
+		Phone:         phoneHandler,
+		Auth:          authHandler,
+		Role:          roleHandler,
+		PasswordReset: passwordResetHandler,
+		Verification:  verificationHandler,
+		TwoFactor:     twoFactorHandler,
+		JWKS:          handler.NewJWKSHandler(keyRing),
+		APIKey:        handler.NewAPIKeyHandler(apiKeyService, securityEvents),
+		Session:       handler.NewSessionHandler(sessionService, securityEvents),
+		SecurityEvent: handler.NewSecurityEventHandler(securityEvents),
+		UserImport:    handler.NewUserImportHandler(importService),
+	}, routes.Middleware{
+		AuthRequired:      middleware.JWTProtected(keyRing, apiKeyService, sessionService),
+		TwoFactorEnrolled: middleware.RequireTwoFactorEnrollment(twoFactorService),
+		Ownership:         middleware.RequireOwnership(policyService, "id"),
+		RecordDenials:     middleware.RecordDenials(securityEvents),
+		ResetRequestLimit: middleware.LimitPerIP(
+			utils.GetEnvInt("PASSWORD_RESET_RATE_LIMIT", 5),
+			utils.GetEnvDuration("PASSWORD_RESET_RATE_WINDOW", 15*time.Minute),
+		),
+	})
 
 	fmt.Println("Server starting on :8080...")
 	log.Fatal(app.Listen(":8080"))
 }
 
+// loadKeyRing loads the JWT signing keys from JWT_KEYS_DIR. A development key is
+// generated when the directory is empty and JWT_KEYS_AUTOGENERATE is true.
+// Sending SIGHUP reloads the directory so a new key can be rolled in without a restart.
+func loadKeyRing() *keyring.KeyRing {
+	dir := utils.GetEnv("JWT_KEYS_DIR", "./storage/keys")
+	activeKID := os.Getenv("JWT_ACTIVE_KID")
+
+	keyRing, err := keyring.Load(dir, activeKID)
+	if errors.Is(err, keyring.ErrNoKeys) && utils.GetEnv("JWT_KEYS_AUTOGENERATE", "false") == "true" {
+		kid := activeKID
+		if kid == "" {
+			kid = "dev-" + time.Now().Format("20060102")
+		}
+		if err := keyring.GenerateEd25519(dir, kid); err != nil {
+			log.Fatal("Could not generate signing key: ", err)
+		}
+		log.Printf("Generated development signing key %s in %s", kid, dir)
+		keyRing, err = keyring.Load(dir, activeKID)
+	}
+	if err != nil {
+		log.Fatal("Could not load JWT signing keys: ", err)
+	}
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			if err := keyRing.Reload(); err != nil {
+				log.Println("Key ring reload failed, keeping current keys:", err)
+				continue
+			}
+			log.Println("Key ring reloaded, active key:", keyRing.ActiveKeyID())
+		}
+	}()
+	return keyRing
+}
+
+// loadPasswordPolicy builds the password rules from the PASSWORD_* settings, capping
+// the length at what the hasher can take in full
+func loadPasswordPolicy(hasher *password.Hasher) *password.Policy {
+	breached, err := password.LoadBreachedList(os.Getenv("PASSWORD_BREACHED_LIST"))
+	if err != nil {
+		log.Fatal("Could not load breached password list: ", err)
+	}
+	return password.NewPolicy(password.Config{
+		MinLength:     utils.GetEnvInt("PASSWORD_MIN_LENGTH", 8),
+		RequireUpper:  utils.GetEnv("PASSWORD_REQUIRE_UPPER", "true") == "true",
+		RequireLower:  utils.GetEnv("PASSWORD_REQUIRE_LOWER", "true") == "true",
+		RequireDigit:  utils.GetEnv("PASSWORD_REQUIRE_DIGIT", "true") == "true",
+		RequireSymbol: utils.GetEnv("PASSWORD_REQUIRE_SYMBOL", "false") == "true",
+		MinStrength:   utils.GetEnvInt("PASSWORD_MIN_STRENGTH", 2),
+		HistorySize:   utils.GetEnvInt("PASSWORD_HISTORY_SIZE", 5),
+		MaxLength:     hasher.MaxPasswordLength(),
+	}, breached)
+}
+
+// loadPasswordHasher hashes new passwords with PASSWORD_HASH_ALGORITHM ("argon2id"
+// or "bcrypt"). Hashes of the other algorithm are still accepted and replaced on login.
+func loadPasswordHasher() *password.Hasher {
+	argon := password.Argon2id{
+		Memory:      uint32(utils.GetEnvInt("ARGON2_MEMORY_KIB", 64*1024)),
+		Iterations:  uint32(utils.GetEnvInt("ARGON2_ITERATIONS", 3)),
+		Parallelism: uint8(utils.GetEnvInt("ARGON2_PARALLELISM", 2)),
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+	bcryptHasher := password.Bcrypt{Cost: utils.GetEnvInt("BCRYPT_COST", bcrypt.DefaultCost)}
+
+	if utils.GetEnv("PASSWORD_HASH_ALGORITHM", "argon2id") == "bcrypt" {
+		return password.NewHasher(bcryptHasher, argon)
+	}
+	return password.NewHasher(argon, bcryptHasher)
+}
+
+// newMailer picks the mail transport from MAIL_DRIVER ("file" or "smtp")
+func newMailer() mailer.Mailer {
+	from := utils.GetEnv("MAIL_FROM", "no-reply@localhost")
+	if utils.GetEnv("MAIL_DRIVER", "file") == "smtp" {
+		return mailer.NewSMTPMailer(
+			utils.GetEnv("SMTP_HOST", "localhost"),
+			utils.GetEnv("SMTP_PORT", "1025"),
+			os.Getenv("SMTP_USERNAME"),
+			os.Getenv("SMTP_PASSWORD"),
+			from,
+		)
+	}
+	// An empty MAIL_DIR prints mail to stdout
+	return mailer.NewFileMailer(os.Getenv("MAIL_DIR"), from)
+}
+
+// tickerInterval reads a duration that drives a background ticker, stopping startup when it is
+// shorter than a second, as time.NewTicker panics on zero and negative intervals
+func tickerInterval(name string, fallback time.Duration) time.Duration {
+	interval := utils.GetEnvDuration(name, fallback)
+	if interval < time.Second {
+		log.Fatalf("%s must be at least 1s, got %s", name, interval)
+	}
+	return interval
+}
+
+// purgeDeletedAccounts removes, once per interval, accounts whose deletion grace period
+// has ended and users that were soft-deleted longer ago than the retention period, then
+// cleans up phone numbers and photos left behind by deletes that failed part way
+func purgeDeletedAccounts(userService *service.UserService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		// Both purges skip users they cannot remove, so report what they did remove either way
+		purged, err := userService.PurgeScheduledDeletions()
+		if err != nil {
+			fmt.Printf("Error purging deleted accounts: %v\n", err)
+		}
+		if purged > 0 {
+			fmt.Printf("Purged %d deleted accounts\n", purged)
+		}
+		purged, err = userService.PurgeDeletedUsers()
+		if err != nil {
+			fmt.Printf("Error purging deleted users: %v\n", err)
+		}
+		if purged > 0 {
+			fmt.Printf("Purged %d users past their retention period\n", purged)
+		}
+		if phones, photos, err := userService.CleanupOrphans(); err != nil {
+			fmt.Printf("Error cleaning up after deleted users: %v\n", err)
+		} else if phones > 0 || photos > 0 {
+			fmt.Printf("Removed %d orphaned phone numbers and %d orphaned photos\n", phones, photos)
+		}
+		<-ticker.C
+	}
+}
+
+// failStaleImports marks import jobs that have not made progress for staleAfter as failed,
+// which happens when the server running them stops part way
+func failStaleImports(importService *service.UserImportService, staleAfter time.Duration) {
+	ticker := time.NewTicker(staleAfter / 2)
+	defer ticker.Stop()
+	for {
+		if failed, err := importService.FailStaleJobs(staleAfter); err != nil {
+			fmt.Printf("Error failing stale import jobs: %v\n", err)
+		} else if failed > 0 {
+			fmt.Printf("Marked %d interrupted import jobs as failed\n", failed)
+		}
+		<-ticker.C
+	}
+}
+
+// rebuildSearchIndex fills the user search index now and then once per interval, picking up
+// changes made outside UserService, such as by another instance or directly in the database
+func rebuildSearchIndex(userService *service.UserService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := userService.RebuildSearchIndex(); err != nil {
+			fmt.Printf("Error building user search index: %v\n", err)
+		}
+		<-ticker.C
+	}
+}
+
+// ensureIndexes creates the unique indexes on email, normalized NIC and phone number along with the
+// query and expiry indexes. A unique index whose collection already holds duplicates
+// is left out until they are cleaned up.
+func ensureIndexes(db *mongo.Database) {
+	report, err := repository.EnsureIndexes(context.Background(), db)
+	if err != nil {
+		log.Fatalf("Error creating indexes: %v", err)
+	}
+	for _, dup := range report.Duplicates {
+		ids := make([]string, len(dup.IDs))
+		for i, id := range dup.IDs {
+			ids[i] = id.Hex()
+		}
+		fmt.Printf("WARNING: %s share %s %q: %s\n", dup.Collection, dup.Field, dup.Value, strings.Join(ids, ", "))
+	}
+	if len(report.Duplicates) > 0 {
+		fmt.Println("WARNING: unique indexes are not enforced on fields with duplicates; resolve them and restart")
+	}
+	fmt.Printf("Unique indexes enforced: %s\n", strings.Join(report.Enforced, ", "))
+}
+
+// loadAlertHook picks where security alerts go from SECURITY_ALERTS ("log", "webhook" or "off")
+func loadAlertHook() service.AlertHook {
+	switch utils.GetEnv("SECURITY_ALERTS", "log") {
+	case "webhook":
+		url := os.Getenv("SECURITY_ALERT_WEBHOOK_URL")
+		if url == "" {
+			log.Fatal("SECURITY_ALERTS=webhook needs SECURITY_ALERT_WEBHOOK_URL")
+		}
+		return service.NewWebhookAlertHook(url)
+	case "off":
+		return nil
+	default:
+		return service.LogAlertHook{}
+	}
+}
+
+// seedAdminRoleMigration grants the admin role to an admin user seeded before roles existed
+const seedAdminRoleMigration = "seed_admin_role"
+
 // seedData creates default users if they don't exist
-func seedData(userRepo *repository.UserRepository) {
+func seedData(userRepo *repository.UserRepository, settingsRepo *repository.SettingsRepository, hasher *password.Hasher) {
 	ctx := context.Background()
 
 	// Check if admin user already exists
-	_, err := userRepo.FindUserByEmail(ctx, "admin@example.com")
+	existing, err := userRepo.FindUserByEmail(ctx, "admin@example.com")
 	if err == nil {
+		grantSeededAdminRole(ctx, userRepo, settingsRepo, existing)
 		fmt.Println("Seed data: Admin user already exists, skipping...")
 		return
 	}
@@ -107,7 +493,7 @@ func seedData(userRepo *repository.UserRepository) {
 	fmt.Println("Seed data: Creating default admin user...")
 
 	// Hash the password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
+	hashedPassword, err := hasher.Hash("password123")
 	if err != nil {
 		fmt.Printf("Seed data: Error hashing password: %v\n", err)
 		return
@@ -115,21 +501,52 @@ func seedData(userRepo *repository.UserRepository) {
 
 	// Create admin user
 	adminUser := &model.User{
-		Name:     "Admin User",
-		Email:    "admin@example.com",
-		Password: string(hashedPassword),
-		NIC:      "123456789V",
-		Address:  "123 Admin Street",
-		Birthday: time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC),
-		Gender:   "Other",
-		Photo:    "",
+		Name:          "Admin User",
+		Email:         "admin@example.com",
+		Password:      hashedPassword,
+		NIC:           "900011234V",
+		NICNormalized: "199000101234",
+		Address:       "123 Admin Street",
+		Birthday:      time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC),
+		Gender:        "Other",
+		Photo:         "",
+		Roles:         []string{model.RoleAdmin, model.RoleMember},
+		EmailVerified: true,
 	}
 
 	if err := userRepo.CreateUser(ctx, adminUser); err != nil {
 		fmt.Printf("Seed data: Error creating admin user: %v\n", err)
 		return
 	}
+	// The new admin user already has the role, so the migration has nothing to do
+	if err := settingsRepo.MarkMigrationApplied(ctx, seedAdminRoleMigration); err != nil {
+		fmt.Printf("Seed data: %v\n", err)
+	}
 
 	fmt.Printf("Seed data: Admin user created successfully with ID: %s\n", adminUser.ID.Hex())
 	fmt.Println("Seed data: Login credentials - Email: admin@example.com, Password: password123")
 }
+
+// grantSeededAdminRole gives the seeded admin user the admin role once, for accounts
+// seeded before roles existed. After that its roles are left to the admins, so a
+// role revoked on purpose is not granted again on the next start.
+func grantSeededAdminRole(ctx context.Context, userRepo *repository.UserRepository, settingsRepo *repository.SettingsRepository, admin *model.User) {
+	applied, err := settingsRepo.MigrationApplied(ctx, seedAdminRoleMigration)
+	if err != nil {
+		fmt.Printf("Seed data: %v\n", err)
+		return
+	}
+	if applied {
+		return
+	}
+	if !admin.HasRole(model.RoleAdmin) {
+		if err := userRepo.AddRole(ctx, admin.ID, model.RoleAdmin); err != nil {
+			fmt.Printf("Seed data: Error granting admin role: %v\n", err)
+			return
+		}
+		fmt.Println("Seed data: Granted admin role to existing admin user")
+	}
+	if err := settingsRepo.MarkMigrationApplied(ctx, seedAdminRoleMigration); err != nil {
+		fmt.Printf("Seed data: %v\n", err)
+	}
+}
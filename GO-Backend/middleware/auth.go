@@ -1,14 +1,110 @@
 package middleware
 
 import (
+	"errors"
+	"go-fiber-app/keyring"
+	model "go-fiber-app/models"
+	"go-fiber-app/service"
+	"strings"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// JWTProtected authenticates the caller with either an access token or an API key
+// and stores a *jwt.Token in c.Locals("user"). API keys are accepted in the
+// X-API-Key header or as a Bearer token starting with the API key prefix; their
+// claims are built from the key's owner so the rest of the middleware treats
+// both the same way. Access tokens are only accepted while their session is active.
+func JWTProtected(keys *keyring.KeyRing, apiKeys *service.APIKeyService, sessions *service.SessionService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		auth := c.Get(fiber.HeaderAuthorization)
+		bearer := ""
+		if len(auth) >= 7 && strings.EqualFold(auth[:7], "Bearer ") {
+			bearer = auth[7:]
+		}
+
+		if apiKey := c.Get("X-API-Key"); apiKey != "" || strings.HasPrefix(bearer, service.APIKeyPrefix) {
+			if apiKey == "" {
+				apiKey = bearer
+			}
+			key, user, err := apiKeys.Authenticate(apiKey)
+			if err != nil {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired API key"})
+			}
+			c.Locals("user", apiKeyToken(key, user))
+			return c.Next()
+		}
+
+		if bearer == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Missing or malformed JWT"})
+		}
+		token, err := keys.Parse(bearer)
+		if err != nil || !token.Valid {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired JWT"})
+		}
+
+		claims, _ := token.Claims.(jwt.MapClaims)
+		sessionID, _ := claims["sid"].(string)
+		if err := sessions.Authorize(sessionID, c.IP()); err != nil {
+			if errors.Is(err, service.ErrSessionRevoked) {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Session has been signed out"})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not check session"})
+		}
+
+		c.Locals("user", token)
+		return c.Next()
+	}
+}
+
+// DenyAPIKeys keeps account-security endpoints limited to interactive logins
+func DenyAPIKeys() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, err := GetUserFromToken(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+		}
+		if _, ok := claims["api_key_id"]; ok {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "This endpoint cannot be used with an API key"})
+		}
+		return c.Next()
+	}
+}
+
+// apiKeyToken builds the claims an access token for the key's owner would carry,
+// plus the key's scopes
+func apiKeyToken(key *model.APIKey, user *model.User) *jwt.Token {
+	scopes := make([]interface{}, 0, len(key.Scopes))
+	for _, scope := range key.Scopes {
+		scopes = append(scopes, scope)
+	}
+	roles := make([]interface{}, 0)
+	for _, role := range user.EffectiveRoles() {
+		roles = append(roles, role)
+	}
+	claims := jwt.MapClaims{
+		"user_id":            user.ID.Hex(),
+		"email":              user.Email,
+		"roles":              roles,
+		"email_verified":     user.EmailVerified,
+		"two_factor_enabled": user.TwoFactorEnabled,
+		"api_key_id":         key.ID.Hex(),
+		"scopes":             scopes,
+	}
+	return &jwt.Token{Claims: claims, Valid: true}
+}
+
 // GetUserFromToken extracts user information from JWT token
 func GetUserFromToken(c *fiber.Ctx) (map[string]interface{}, error) {
-	user := c.Locals("user").(*jwt.Token)
-	claims := user.Claims.(jwt.MapClaims)
+	user, ok := c.Locals("user").(*jwt.Token)
+	if !ok {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Missing token")
+	}
+	claims, ok := user.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid token")
+	}
 	return claims, nil
 }
 
@@ -24,3 +120,52 @@ func GetUserID(c *fiber.Ctx) (string, error) {
 	}
 	return userID, nil
 }
+
+// GetSessionID returns the session the access token belongs to, or "" for API keys
+func GetSessionID(c *fiber.Ctx) string {
+	claims, err := GetUserFromToken(c)
+	if err != nil {
+		return ""
+	}
+	sessionID, _ := claims["sid"].(string)
+	return sessionID
+}
+
+// GetUserRoles extracts the roles claim from JWT token
+func GetUserRoles(c *fiber.Ctx) ([]string, error) {
+	claims, err := GetUserFromToken(c)
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := claims["roles"].([]interface{})
+	if !ok {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Invalid token")
+	}
+	roles := make([]string, 0, len(raw))
+	for _, r := range raw {
+		if role, ok := r.(string); ok {
+			roles = append(roles, role)
+		}
+	}
+	return roles, nil
+}
+
+// GetTokenScopes returns the scopes of an API key, or nil for a regular access
+// token, which is limited only by the caller's roles
+func GetTokenScopes(c *fiber.Ctx) []string {
+	claims, err := GetUserFromToken(c)
+	if err != nil {
+		return nil
+	}
+	raw, ok := claims["scopes"].([]interface{})
+	if !ok {
+		return nil
+	}
+	scopes := make([]string, 0, len(raw))
+	for _, s := range raw {
+		if scope, ok := s.(string); ok {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"go-fiber-app/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireOwnership rejects the request with 403 unless the caller owns the user
+// identified by the given path parameter or is an admin
+func RequireOwnership(policy *service.PolicyService, param string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		actorID, err := GetUserID(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+		}
+		roles, err := GetUserRoles(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+		}
+
+		targetID := c.Params(param)
+		if policy.CanActOnUser(actorID, roles, targetID) {
+			return c.Next()
+		}
+
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "You can only access your own records"})
+	}
+}
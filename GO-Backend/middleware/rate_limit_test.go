@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestLimitPerIP(t *testing.T) {
+	limit := LimitPerIP(2, time.Minute)
+	for i, want := range []int{fiber.StatusOK, fiber.StatusOK, fiber.StatusTooManyRequests} {
+		if status := serve(t, nil, limit); status != want {
+			t.Errorf("request %d: status = %d, want %d", i+1, status, want)
+		}
+	}
+}
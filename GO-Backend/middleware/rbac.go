@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	model "go-fiber-app/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireRole allows the request through if the caller has at least one of the given roles
+func RequireRole(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userRoles, err := GetUserRoles(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+		}
+		for _, have := range userRoles {
+			for _, want := range roles {
+				if have == want {
+					return c.Next()
+				}
+			}
+		}
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Insufficient role"})
+	}
+}
+
+// RequirePermission allows the request through if one of the caller's roles grants the permission.
+// API keys additionally need the permission among their scopes.
+func RequirePermission(permission string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userRoles, err := GetUserRoles(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+		}
+		if !model.RolesHavePermission(userRoles, permission) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Missing permission: " + permission})
+		}
+		if scopes := GetTokenScopes(c); scopes != nil && !containsScope(scopes, permission) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "API key is missing scope: " + permission})
+		}
+		return c.Next()
+	}
+}
+
+func containsScope(scopes []string, permission string) bool {
+	for _, scope := range scopes {
+		if scope == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	model "go-fiber-app/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// serve runs one request through the handlers with the token already authenticated
+func serve(t *testing.T, token *jwt.Token, handlers ...fiber.Handler) int {
+	t.Helper()
+	app := fiber.New()
+	chain := append([]fiber.Handler{func(c *fiber.Ctx) error {
+		if token != nil {
+			c.Locals("user", token)
+		}
+		return c.Next()
+	}}, handlers...)
+	chain = append(chain, func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+	app.Get("/", chain...)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+func accessToken(roles ...interface{}) *jwt.Token {
+	return &jwt.Token{Claims: jwt.MapClaims{"user_id": primitive.NewObjectID().Hex(), "roles": roles}, Valid: true}
+}
+
+func TestRequirePermission(t *testing.T) {
+	member := &model.User{ID: primitive.NewObjectID(), Roles: []string{model.RoleMember}}
+	admin := &model.User{ID: primitive.NewObjectID(), Roles: []string{model.RoleAdmin}}
+	key := func(owner *model.User, scopes ...string) *jwt.Token {
+		return apiKeyToken(&model.APIKey{ID: primitive.NewObjectID(), UserID: owner.ID, Scopes: scopes, ExpiresAt: time.Now().Add(time.Hour)}, owner)
+	}
+
+	tests := []struct {
+		name       string
+		token      *jwt.Token
+		permission string
+		want       int
+	}{
+		{"role grants the permission", accessToken(model.RoleMember), model.PermUsersRead, fiber.StatusOK},
+		{"role lacks the permission", accessToken(model.RoleMember), model.PermUsersList, fiber.StatusForbidden},
+		{"access tokens are not limited by scopes", accessToken(model.RoleAdmin), model.PermRolesManage, fiber.StatusOK},
+		{"no roles claim", &jwt.Token{Claims: jwt.MapClaims{"user_id": "x"}, Valid: true}, model.PermUsersRead, fiber.StatusUnauthorized},
+		{"API key with the scope", key(member, model.PermUsersRead), model.PermUsersRead, fiber.StatusOK},
+		{"API key without the scope", key(member, model.PermUsersRead), model.PermUsersUpdate, fiber.StatusForbidden},
+		{"API key with no scopes", key(admin), model.PermUsersRead, fiber.StatusForbidden},
+		{"admin key is limited to its scopes", key(admin, model.PermUsersList), model.PermUsersDelete, fiber.StatusForbidden},
+		{"scope the owner's roles no longer grant", key(member, model.PermUsersList), model.PermUsersList, fiber.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serve(t, tt.token, RequirePermission(tt.permission)); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDenyAPIKeys(t *testing.T) {
+	owner := &model.User{ID: primitive.NewObjectID(), Roles: []string{model.RoleAdmin}}
+	apiKey := apiKeyToken(&model.APIKey{ID: primitive.NewObjectID(), Scopes: []string{model.PermUsersRead}}, owner)
+
+	tests := []struct {
+		name  string
+		token *jwt.Token
+		want  int
+	}{
+		{"interactive login", accessToken(model.RoleAdmin), fiber.StatusOK},
+		{"API key", apiKey, fiber.StatusForbidden},
+		{"no token", nil, fiber.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serve(t, tt.token, DenyAPIKeys()); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetTokenScopes(t *testing.T) {
+	owner := &model.User{ID: primitive.NewObjectID()}
+	tests := []struct {
+		name  string
+		token *jwt.Token
+		want  []string
+	}{
+		{"access token", accessToken(model.RoleMember), nil},
+		{"API key", apiKeyToken(&model.APIKey{Scopes: []string{"users:read", "phones:read"}}, owner), []string{"users:read", "phones:read"}},
+		{"API key without scopes", apiKeyToken(&model.APIKey{}, owner), []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			var got []string
+			app.Get("/", func(c *fiber.Ctx) error {
+				c.Locals("user", tt.token)
+				got = GetTokenScopes(c)
+				return nil
+			})
+			if _, err := app.Test(httptest.NewRequest("GET", "/", nil)); err != nil {
+				t.Fatal(err)
+			}
+			if (got == nil) != (tt.want == nil) || len(got) != len(tt.want) {
+				t.Fatalf("GetTokenScopes() = %#v, want %#v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("GetTokenScopes()[%d] = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"encoding/json"
+	model "go-fiber-app/models"
+	"go-fiber-app/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RecordDenials records a permission_denied security event whenever an
+// authenticated request ends in 403, whichever middleware or handler refused it
+func RecordDenials(events *service.SecurityEventService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+		if c.Response().StatusCode() != fiber.StatusForbidden {
+			return err
+		}
+		actorID, idErr := GetUserID(c)
+		if idErr != nil {
+			return err
+		}
+
+		var body struct {
+			Error string `json:"error"`
+		}
+		_ = json.Unmarshal(c.Response().Body(), &body)
+
+		events.Record(&model.SecurityEvent{
+			Type:      model.EventPermissionDenied,
+			UserID:    actorID,
+			ActorID:   actorID,
+			IP:        c.IP(),
+			UserAgent: c.Get(fiber.HeaderUserAgent),
+			Method:    c.Method(),
+			Path:      c.Path(),
+			Reason:    body.Error,
+		})
+		return err
+	}
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"go-fiber-app/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireTwoFactorEnrollment blocks callers whose role requires 2FA until they have enrolled.
+// The /api/auth/2fa endpoints stay reachable so they can do so.
+func RequireTwoFactorEnrollment(twoFactorService *service.TwoFactorService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, err := GetUserFromToken(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+		}
+		if enabled, _ := claims["two_factor_enabled"].(bool); enabled {
+			return c.Next()
+		}
+
+		roles, err := GetUserRoles(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+		}
+		required, err := twoFactorService.IsRequiredForRoles(roles)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not check two-factor policy"})
+		}
+		if required {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":                          "Two-factor authentication is required for your role",
+				"two_factor_enrollment_required": true,
+			})
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireVerifiedEmail rejects callers whose token says their email is not verified yet.
+// Under the "restrict" verification policy this keeps unverified accounts read-only.
+func RequireVerifiedEmail() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, err := GetUserFromToken(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+		}
+		if verified, _ := claims["email_verified"].(bool); !verified {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Please verify your email address first"})
+		}
+		return c.Next()
+	}
+}
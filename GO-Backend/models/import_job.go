@@ -0,0 +1,41 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Import job states
+const (
+	ImportQueued    = "queued"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+)
+
+// ImportJob tracks a bulk user import running in the background
+type ImportJob struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Status     string             `json:"status" bson:"status"`
+	FileName   string             `json:"file_name" bson:"file_name"`
+	Total      int                `json:"total" bson:"total"`         // Data rows in the file
+	Processed  int                `json:"processed" bson:"processed"` // Rows handled so far, valid or not
+	Created    int                `json:"created" bson:"created"`
+	Invited    int                `json:"invited" bson:"invited"` // Created without a password and sent an invite
+	Failed     int                `json:"failed" bson:"failed"`
+	Errors     []ImportRowError   `json:"errors" bson:"errors"`
+	Error      string             `json:"error,omitempty" bson:"error,omitempty"` // Why the whole job failed
+	StartedBy  primitive.ObjectID `json:"started_by" bson:"started_by"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt  time.Time          `json:"updated_at" bson:"updated_at"` // Last progress; a running job that stops updating was interrupted
+	FinishedAt *time.Time         `json:"finished_at,omitempty" bson:"finished_at,omitempty"`
+}
+
+// ImportRowError is a problem with one row of an import file. Row is the line
+// or spreadsheet row number, counting the header as row 1.
+type ImportRowError struct {
+	Row     int    `json:"row" bson:"row"`
+	Field   string `json:"field,omitempty" bson:"field,omitempty"`
+	Message string `json:"message" bson:"message"`
+}
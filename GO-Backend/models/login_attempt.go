@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// LoginAttempt tracks consecutive failed logins for a single key (an email or a client IP)
+type LoginAttempt struct {
+	Key           string    `json:"key" bson:"_id"`
+	Failures      int       `json:"failures" bson:"failures"`
+	LastFailureAt time.Time `json:"last_failure_at" bson:"last_failure_at"`
+	BlockedUntil  time.Time `json:"blocked_until" bson:"blocked_until"`
+}
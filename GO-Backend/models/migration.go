@@ -0,0 +1,9 @@
+package model
+
+import "time"
+
+// Migration records a one-time data change that has been applied, so it is not repeated on the next start
+type Migration struct {
+	ID        string    `json:"id" bson:"_id"`
+	AppliedAt time.Time `json:"applied_at" bson:"applied_at"`
+}
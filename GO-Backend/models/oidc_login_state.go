@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// OIDCLoginState remembers an authorization request between the redirect to the
+// provider and the callback. It is keyed by the hash of the state parameter and
+// deleted when the callback consumes it.
+type OIDCLoginState struct {
+	StateHash    string    `bson:"_id"`
+	Nonce        string    `bson:"nonce"`
+	CodeVerifier string    `bson:"code_verifier"` // PKCE verifier, never sent to the browser
+	CreatedAt    time.Time `bson:"created_at"`
+	ExpiresAt    time.Time `bson:"expires_at"`
+}
@@ -5,10 +5,11 @@ import (
 )
 
 type PhoneNumber struct {
-	ID     primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	Number string             `json:"number" bson:"number"`
-	Type   string             `json:"type" bson:"type"`
-	UserID primitive.ObjectID `json:"user_id" bson:"user_id"`
+	ID      primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Number  string             `json:"number" bson:"number"`
+	Type    string             `json:"type" bson:"type"`
+	UserID  primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Version int64              `json:"version" bson:"version"` // Bumped on every change; sent as the ETag
 }
 
 func (p *PhoneNumber) Validate() bool {
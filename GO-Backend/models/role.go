@@ -0,0 +1,74 @@
+package model
+
+// Roles that can be assigned to a user
+const (
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+// Permissions checked by the route middleware
+const (
+	PermUsersList    = "users:list"
+	PermUsersCreate  = "users:create"
+	PermUsersRead    = "users:read"
+	PermUsersUpdate  = "users:update"
+	PermUsersDelete  = "users:delete"
+	PermUsersUnlock  = "users:unlock"
+	PermUsersRestore = "users:restore"
+	PermUsersPurge   = "users:purge"
+	PermUsersHistory = "users:history"
+	PermUsersRevert  = "users:revert"
+	PermPhonesRead   = "phones:read"
+	PermPhonesWrite  = "phones:write"
+	PermRolesManage  = "roles:manage"
+
+	PermSecurityManage = "security:manage"
+	PermAPIKeysManage  = "api_keys:manage"
+)
+
+// RolePermissions maps every role to the permissions it grants
+var RolePermissions = map[string][]string{
+	RoleAdmin: {
+		PermUsersList,
+		PermUsersCreate,
+		PermUsersRead,
+		PermUsersUpdate,
+		PermUsersDelete,
+		PermUsersUnlock,
+		PermUsersRestore,
+		PermUsersPurge,
+		PermUsersHistory,
+		PermUsersRevert,
+		PermPhonesRead,
+		PermPhonesWrite,
+		PermRolesManage,
+		PermSecurityManage,
+		PermAPIKeysManage,
+	},
+	RoleMember: {
+		PermUsersRead,
+		PermUsersUpdate,
+		PermUsersDelete,
+		PermPhonesRead,
+		PermPhonesWrite,
+		PermAPIKeysManage,
+	},
+}
+
+// IsValidRole reports whether the role is known
+func IsValidRole(role string) bool {
+	_, ok := RolePermissions[role]
+	return ok
+}
+
+// RolesHavePermission reports whether any of the roles grants the permission
+func RolesHavePermission(roles []string, permission string) bool {
+	for _, role := range roles {
+		for _, p := range RolePermissions[role] {
+			if p == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Security event types
+const (
+	EventLoginSuccess     = "login_success"
+	EventLoginFailure     = "login_failure"
+	EventAccountLocked    = "account_locked"
+	EventPasswordChanged  = "password_changed"
+	EventTokenRevoked     = "token_revoked"
+	EventPermissionDenied = "permission_denied"
+)
+
+// SecurityEvent records authentication and authorization activity for later review.
+// UserID is the account the event is about; ActorID is whoever made the request, when known.
+type SecurityEvent struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Type      string             `json:"type" bson:"type"`
+	UserID    string             `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	Email     string             `json:"email,omitempty" bson:"email,omitempty"`
+	ActorID   string             `json:"actor_id,omitempty" bson:"actor_id,omitempty"`
+	IP        string             `json:"ip" bson:"ip"`
+	UserAgent string             `json:"user_agent,omitempty" bson:"user_agent,omitempty"`
+	Method    string             `json:"method" bson:"method"`
+	Path      string             `json:"path" bson:"path"`
+	Reason    string             `json:"reason,omitempty" bson:"reason,omitempty"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// SecuritySettingsID is the _id of the single security settings document
+const SecuritySettingsID = "security"
+
+// SecuritySettings holds security options admins can change at runtime
+type SecuritySettings struct {
+	ID                     string    `json:"-" bson:"_id"`
+	TwoFactorRequiredRoles []string  `json:"two_factor_required_roles" bson:"two_factor_required_roles"`
+	UpdatedAt              time.Time `json:"updated_at" bson:"updated_at"`
+}
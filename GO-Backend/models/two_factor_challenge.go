@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// UsedTwoFactorChallenge records a challenge token that completed a login, so the
+// same token cannot complete another. It is keyed by the token's jti and removed
+// once the token would have expired anyway.
+type UsedTwoFactorChallenge struct {
+	ID        string    `bson:"_id"`
+	UsedAt    time.Time `bson:"used_at"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
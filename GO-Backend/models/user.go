@@ -17,8 +17,80 @@ type User struct {
 	Gender   string             `json:"gender" bson:"gender"`
 	Photo    string             `json:"photo" bson:"photo"`
 	Phones   []*PhoneNumber     `json:"phones" bson:"phones,omitempty"`
+	Roles    []string           `json:"roles" bson:"roles,omitempty"`
+	Version  int64              `json:"version" bson:"version"` // Bumped on every change; sent as the ETag
+
+	PasswordHistory []string `json:"-" bson:"password_history,omitempty"` // Previous password hashes (argon2id PHC strings or legacy bcrypt), newest first
+
+	LockedUntil     *time.Time `json:"locked_until,omitempty" bson:"locked_until,omitempty"` // Set after too many failed logins
+	EmailVerified   bool       `json:"email_verified" bson:"email_verified"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty" bson:"email_verified_at,omitempty"`
+
+	// TOTP two-factor authentication. Secrets and backup code hashes never leave the server.
+	TwoFactorEnabled       bool     `json:"two_factor_enabled" bson:"two_factor_enabled"`
+	TwoFactorSecret        string   `json:"-" bson:"two_factor_secret,omitempty"`
+	TwoFactorPendingSecret string   `json:"-" bson:"two_factor_pending_secret,omitempty"` // Awaiting the first valid code
+	TwoFactorBackupCodes   []string `json:"-" bson:"two_factor_backup_codes,omitempty"`   // bcrypt hashes
+	TwoFactorLastStep      int64    `json:"-" bson:"two_factor_last_step,omitempty"`      // Last accepted time step, blocks code replay
+
+	Identities []ExternalIdentity `json:"identities,omitempty" bson:"identities,omitempty"` // Linked OpenID Connect accounts
+
+	NICNormalized string   `json:"nic_normalized,omitempty" bson:"nic_normalized,omitempty"` // The NIC in the 12-digit format, unique across both formats
+	NICWarnings   []string `json:"nic_warnings,omitempty" bson:"nic_warnings,omitempty"`     // Where Birthday or Gender contradict the NIC
+
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty" bson:"deletion_scheduled_at,omitempty"` // Requested by the user; purged after this time
+
+	// Soft deletion. Deleted users are hidden from every read until restored or purged.
+	DeletedAt *time.Time          `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	DeletedBy *primitive.ObjectID `json:"deleted_by,omitempty" bson:"deleted_by,omitempty"`
+}
+
+// ExternalIdentity links a user to an account at an OpenID Connect provider
+type ExternalIdentity struct {
+	Issuer   string    `json:"issuer" bson:"issuer"`
+	Subject  string    `json:"subject" bson:"subject"`
+	LinkedAt time.Time `json:"linked_at" bson:"linked_at"`
 }
 
 func (u *User) Validate() bool {
-	return u.Name != "" && u.Email != "" && u.NIC != "" && u.Address != "" && !u.Birthday.IsZero() && u.Gender != ""
+	return len(u.MissingFields()) == 0
+}
+
+// MissingFields lists the required profile fields that are empty. The address and photo are optional.
+func (u *User) MissingFields() []string {
+	var missing []string
+	if u.Name == "" {
+		missing = append(missing, "name")
+	}
+	if u.Email == "" {
+		missing = append(missing, "email")
+	}
+	if u.NIC == "" {
+		missing = append(missing, "nic")
+	}
+	if u.Birthday.IsZero() {
+		missing = append(missing, "birthday")
+	}
+	if u.Gender == "" {
+		missing = append(missing, "gender")
+	}
+	return missing
+}
+
+// EffectiveRoles returns the user's roles, treating users without any as members
+func (u *User) EffectiveRoles() []string {
+	if len(u.Roles) == 0 {
+		return []string{RoleMember}
+	}
+	return u.Roles
+}
+
+// HasRole reports whether the user has the given role
+func (u *User) HasRole(role string) bool {
+	for _, r := range u.EffectiveRoles() {
+		if r == role {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Change history actions
+const (
+	ChangeCreated           = "created"
+	ChangeUpdated           = "updated"
+	ChangePasswordChanged   = "password_changed"
+	ChangeRolesChanged      = "roles_changed"
+	ChangeDeleted           = "deleted"
+	ChangeRestored          = "restored"
+	ChangeDeletionScheduled = "deletion_scheduled"
+	ChangeDeletionCancelled = "deletion_cancelled"
+	ChangePhoneAdded        = "phone_added"
+	ChangePhoneUpdated      = "phone_updated"
+	ChangePhoneRemoved      = "phone_removed"
+	ChangeReverted          = "reverted"
+	ChangeIdentityLinked    = "identity_linked"
+)
+
+// UserChange is one revision in a user's change history: who changed what, and
+// the user as it was afterwards so it can be reverted to later
+type UserChange struct {
+	ID         primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	UserID     primitive.ObjectID  `json:"user_id" bson:"user_id"`
+	Revision   int64               `json:"revision" bson:"revision"` // 1 for the first change, counting up per user
+	Action     string              `json:"action" bson:"action"`
+	ActorID    *primitive.ObjectID `json:"actor_id,omitempty" bson:"actor_id,omitempty"` // Unset for changes made by the system
+	Changes    []FieldChange       `json:"changes" bson:"changes"`
+	RevertedTo int64               `json:"reverted_to,omitempty" bson:"reverted_to,omitempty"` // The revision a revert went back to
+	Snapshot   UserSnapshot        `json:"snapshot" bson:"snapshot"`
+	CreatedAt  time.Time           `json:"created_at" bson:"created_at"`
+}
+
+// FieldChange is a field's value before and after a change, formatted as text.
+// An empty value means the field was not set. Passwords are never recorded.
+type FieldChange struct {
+	Field string `json:"field" bson:"field"`
+	From  string `json:"from" bson:"from"`
+	To    string `json:"to" bson:"to"`
+}
+
+// UserSnapshot is the part of a user the history tracks
+type UserSnapshot struct {
+	Name                string          `json:"name" bson:"name"`
+	Email               string          `json:"email" bson:"email"`
+	NIC                 string          `json:"nic" bson:"nic"`
+	Address             string          `json:"address" bson:"address"`
+	Birthday            time.Time       `json:"birthday" bson:"birthday"`
+	Gender              string          `json:"gender" bson:"gender"`
+	Photo               string          `json:"photo" bson:"photo"`
+	Roles               []string        `json:"roles" bson:"roles"`
+	Phones              []PhoneSnapshot `json:"phones" bson:"phones"`
+	DeletionScheduledAt *time.Time      `json:"deletion_scheduled_at,omitempty" bson:"deletion_scheduled_at,omitempty"`
+	Deleted             bool            `json:"deleted" bson:"deleted"`
+}
+
+// PhoneSnapshot is a phone number as recorded in a UserSnapshot
+type PhoneSnapshot struct {
+	ID     primitive.ObjectID `json:"id" bson:"id"`
+	Number string             `json:"number" bson:"number"`
+	Type   string             `json:"type" bson:"type"`
+}
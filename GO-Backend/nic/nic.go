@@ -0,0 +1,160 @@
+// Package nic parses Sri Lankan National Identity Card numbers.
+//
+// Two formats are in use. The old one has nine digits and a letter, YYDDDSSSCV:
+// the last two digits of the birth year, the day of the year, a serial, a check
+// digit and V (or X for holders without voting rights). The new one, issued
+// since 2016, has twelve digits, YYYYDDDSSSSC, with the full year and a four-digit
+// serial. In both, 500 is added to the day of the year for women.
+package nic
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Format is the layout a NIC number is written in
+type Format int
+
+const (
+	Old Format = iota // 9 digits and V or X
+	New               // 12 digits
+)
+
+const femaleOffset = 500
+
+// Genders as decoded from the NIC
+const (
+	Male   = "Male"
+	Female = "Female"
+)
+
+var (
+	ErrInvalidFormat    = errors.New("NIC must be 9 digits followed by V or X, or 12 digits")
+	ErrInvalidDay       = errors.New("NIC has an invalid day of the year")
+	ErrBirthdayMismatch = errors.New("birthday does not match the NIC")
+	ErrGenderMismatch   = errors.New("gender does not match the NIC")
+)
+
+// NIC is a decoded identity card number
+type NIC struct {
+	Number    string // Normalized: trimmed, letter upper-cased
+	Format    Format
+	BirthYear int
+	DayOfYear int // 1-366, counted as though February always has 29 days
+	Gender    string
+}
+
+// Parse validates a NIC number in either format and decodes it
+func Parse(number string) (*NIC, error) {
+	number = strings.ToUpper(strings.TrimSpace(number))
+
+	n := &NIC{Number: number}
+	switch {
+	case len(number) == 10 && isDigits(number[:9]) && (number[9] == 'V' || number[9] == 'X'):
+		n.Format = Old
+		n.BirthYear = 1900 + atoi(number[:2])
+		n.DayOfYear = atoi(number[2:5])
+	case len(number) == 12 && isDigits(number):
+		n.Format = New
+		n.BirthYear = atoi(number[:4])
+		n.DayOfYear = atoi(number[4:7])
+	default:
+		return nil, ErrInvalidFormat
+	}
+
+	n.Gender = Male
+	if n.DayOfYear > femaleOffset {
+		n.Gender = Female
+		n.DayOfYear -= femaleOffset
+	}
+	if _, err := n.birthday(); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// Birthday returns the date of birth encoded in the NIC
+func (n *NIC) Birthday() time.Time {
+	birthday, _ := n.birthday()
+	return birthday
+}
+
+// Day numbers treat every year as a leap year, so they are
+// turned into a month and day using a leap-year calendar
+func (n *NIC) birthday() (time.Time, error) {
+	if n.DayOfYear < 1 || n.DayOfYear > 366 {
+		return time.Time{}, ErrInvalidDay
+	}
+	date := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, n.DayOfYear-1)
+	birthday := time.Date(n.BirthYear, date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	if birthday.Day() != date.Day() {
+		// 29 February in a year that does not have one
+		return time.Time{}, ErrInvalidDay
+	}
+	return birthday, nil
+}
+
+// NewFormat returns the number in the 12-digit format. Old numbers gain
+// the century and a zero in front of the serial; the V or X is dropped.
+func (n *NIC) NewFormat() string {
+	if n.Format == New {
+		return n.Number
+	}
+	return "19" + n.Number[:5] + "0" + n.Number[5:9]
+}
+
+// ToNewFormat converts a NIC number in either format to the 12-digit format
+func ToNewFormat(number string) (string, error) {
+	n, err := Parse(number)
+	if err != nil {
+		return "", err
+	}
+	return n.NewFormat(), nil
+}
+
+// Check compares a birthday and gender against the NIC, returning an error for each
+// that contradicts it. Only the date of the birthday is compared. Genders other than
+// male and female cannot be checked against the NIC and are accepted.
+func (n *NIC) Check(birthday time.Time, gender string) []error {
+	var mismatches []error
+	if !birthday.IsZero() {
+		want := n.Birthday()
+		if birthday.Year() != want.Year() || birthday.Month() != want.Month() || birthday.Day() != want.Day() {
+			mismatches = append(mismatches, fmt.Errorf("%w: NIC gives %s", ErrBirthdayMismatch, want.Format("2006-01-02")))
+		}
+	}
+	if g := normalizeGender(gender); g != "" && g != n.Gender {
+		mismatches = append(mismatches, fmt.Errorf("%w: NIC gives %s", ErrGenderMismatch, n.Gender))
+	}
+	return mismatches
+}
+
+func normalizeGender(gender string) string {
+	switch strings.ToLower(strings.TrimSpace(gender)) {
+	case "m", "male":
+		return Male
+	case "f", "female":
+		return Female
+	}
+	return ""
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// atoi parses a string already checked by isDigits
+func atoi(s string) int {
+	v := 0
+	for _, r := range s {
+		v = v*10 + int(r-'0')
+	}
+	return v
+}
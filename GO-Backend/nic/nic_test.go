@@ -0,0 +1,132 @@
+package nic
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		number   string
+		format   Format
+		birthday time.Time
+		gender   string
+		err      error
+	}{
+		{"old format", "853400937V", Old, date(1985, time.December, 5), Male, nil},
+		{"old format without voting rights", "853400937X", Old, date(1985, time.December, 5), Male, nil},
+		{"old format lower case and spaces", " 858400937v ", Old, date(1985, time.December, 5), Female, nil},
+		{"new format", "199034001234", New, date(1990, time.December, 5), Male, nil},
+		{"new format female", "199084001234", New, date(1990, time.December, 5), Female, nil},
+		{"first day of the year", "900010000V", Old, date(1990, time.January, 1), Male, nil},
+		{"last day of the year", "903660000V", Old, date(1990, time.December, 31), Male, nil},
+		{"day after 29 February in a common year", "900610000V", Old, date(1990, time.March, 1), Male, nil},
+		{"29 February in a leap year", "200006001234", New, date(2000, time.February, 29), Male, nil},
+		{"29 February in a common year", "199006001234", New, time.Time{}, "", ErrInvalidDay},
+		{"day zero", "850000937V", Old, time.Time{}, "", ErrInvalidDay},
+		{"day past the end of the year", "853670937V", Old, time.Time{}, "", ErrInvalidDay},
+		{"female day past the end of the year", "858670937V", Old, time.Time{}, "", ErrInvalidDay},
+		{"too short", "85340093V", Old, time.Time{}, "", ErrInvalidFormat},
+		{"wrong letter", "853400937A", Old, time.Time{}, "", ErrInvalidFormat},
+		{"letters in the digits", "85340O937V", Old, time.Time{}, "", ErrInvalidFormat},
+		{"eleven digits", "19903400123", New, time.Time{}, "", ErrInvalidFormat},
+		{"empty", "", Old, time.Time{}, "", ErrInvalidFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := Parse(tt.number)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Parse(%q) error = %v, want %v", tt.number, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.number, err)
+			}
+			if n.Format != tt.format {
+				t.Errorf("Format = %v, want %v", n.Format, tt.format)
+			}
+			if got := n.Birthday(); !got.Equal(tt.birthday) {
+				t.Errorf("Birthday() = %s, want %s", got.Format("2006-01-02"), tt.birthday.Format("2006-01-02"))
+			}
+			if n.Gender != tt.gender {
+				t.Errorf("Gender = %q, want %q", n.Gender, tt.gender)
+			}
+		})
+	}
+}
+
+func TestToNewFormat(t *testing.T) {
+	tests := []struct {
+		number string
+		want   string
+	}{
+		{"853400937V", "198534000937"},
+		{"858400937x", "198584000937"},
+		{"199034001234", "199034001234"},
+	}
+	for _, tt := range tests {
+		got, err := ToNewFormat(tt.number)
+		if err != nil {
+			t.Fatalf("ToNewFormat(%q) error = %v", tt.number, err)
+		}
+		if got != tt.want {
+			t.Errorf("ToNewFormat(%q) = %q, want %q", tt.number, got, tt.want)
+		}
+		// Both formats of the same card decode the same way
+		old, _ := Parse(tt.number)
+		converted, err := Parse(got)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", got, err)
+		}
+		if !old.Birthday().Equal(converted.Birthday()) || old.Gender != converted.Gender {
+			t.Errorf("%q and %q decode differently", tt.number, got)
+		}
+	}
+
+	if _, err := ToNewFormat("12345"); !errors.Is(err, ErrInvalidFormat) {
+		t.Errorf("ToNewFormat of an invalid number error = %v, want %v", err, ErrInvalidFormat)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	n, err := Parse("858400937V") // female, born 1985-12-05
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		birthday time.Time
+		gender   string
+		want     []error
+	}{
+		{"matching", date(1985, time.December, 5), "Female", nil},
+		{"time of day is ignored", time.Date(1985, time.December, 5, 18, 30, 0, 0, time.UTC), "female", nil},
+		{"short gender", date(1985, time.December, 5), "F", nil},
+		{"no birthday or gender", time.Time{}, "", nil},
+		{"other gender is not checked", date(1985, time.December, 5), "Other", nil},
+		{"wrong birthday", date(1985, time.December, 6), "Female", []error{ErrBirthdayMismatch}},
+		{"wrong gender", date(1985, time.December, 5), "Male", []error{ErrGenderMismatch}},
+		{"both wrong", date(1986, time.December, 5), "m", []error{ErrBirthdayMismatch, ErrGenderMismatch}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := n.Check(tt.birthday, tt.gender)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Check() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !errors.Is(got[i], tt.want[i]) {
+					t.Errorf("Check()[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"os"
+	"strings"
+)
+
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// BreachedList is a set of known-compromised passwords. Entries are stored as
+// SHA-1 hex digests so a downloaded hash list (e.g. from Have I Been Pwned) can
+// be loaded alongside plain-text word lists.
+type BreachedList struct {
+	hashes map[string]struct{}
+}
+
+// LoadBreachedList returns the built-in list of common passwords plus the
+// entries of the optional file at path. Each line holds either a plain password
+// or a 40 character SHA-1 digest, optionally followed by ":count".
+func LoadBreachedList(path string) (*BreachedList, error) {
+	list := &BreachedList{hashes: make(map[string]struct{})}
+	for _, line := range strings.Split(commonPasswords, "\n") {
+		list.add(line)
+	}
+	if path == "" {
+		return list, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		list.add(scanner.Text())
+	}
+	return list, scanner.Err()
+}
+
+func (l *BreachedList) add(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return
+	}
+	if digest, _, _ := strings.Cut(line, ":"); isSHA1Hex(digest) {
+		l.hashes[strings.ToLower(digest)] = struct{}{}
+		return
+	}
+	l.hashes[sha1Hex(line)] = struct{}{}
+}
+
+// Contains reports whether the password is on the list
+func (l *BreachedList) Contains(password string) bool {
+	if l == nil {
+		return false
+	}
+	_, found := l.hashes[sha1Hex(password)]
+	return found
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func isSHA1Hex(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,183 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// Algorithm is one way of hashing passwords
+type Algorithm interface {
+	Hash(password string) (string, error)
+	Verify(password, encoded string) (bool, error)
+	// Recognizes reports whether the encoded hash was produced by this algorithm
+	Recognizes(encoded string) bool
+	// Outdated reports whether a recognized hash uses weaker parameters than configured
+	Outdated(encoded string) bool
+}
+
+// Hasher hashes new passwords with the preferred algorithm and verifies hashes
+// made by any of the known ones, so existing users keep working after a switch
+type Hasher struct {
+	preferred Algorithm
+	known     []Algorithm
+}
+
+// NewHasher hashes with preferred and additionally verifies hashes of the legacy algorithms
+func NewHasher(preferred Algorithm, legacy ...Algorithm) *Hasher {
+	return &Hasher{preferred: preferred, known: append([]Algorithm{preferred}, legacy...)}
+}
+
+func (h *Hasher) Hash(password string) (string, error) {
+	return h.preferred.Hash(password)
+}
+
+// Verify checks a password against a hash made by any known algorithm
+func (h *Hasher) Verify(password, encoded string) (bool, error) {
+	for _, algorithm := range h.known {
+		if algorithm.Recognizes(encoded) {
+			return algorithm.Verify(password, encoded)
+		}
+	}
+	return false, ErrUnknownHashFormat
+}
+
+// MaxPasswordLength is the longest password, in bytes, that the preferred algorithm
+// hashes in full. Legacy bcrypt hashes do not limit it: they are only verified.
+func (h *Hasher) MaxPasswordLength() int {
+	if _, ok := h.preferred.(Bcrypt); ok {
+		return BcryptMaxLength
+	}
+	return DefaultMaxLength
+}
+
+// NeedsRehash reports whether the hash should be replaced the next time the
+// plain password is available
+func (h *Hasher) NeedsRehash(encoded string) bool {
+	return !h.preferred.Recognizes(encoded) || h.preferred.Outdated(encoded)
+}
+
+// Bcrypt is the algorithm the API used before argon2id
+type Bcrypt struct {
+	Cost int
+}
+
+func (b Bcrypt) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	if err != nil {
+		return "", fmt.Errorf("error hashing password: %w", err)
+	}
+	return string(hash), nil
+}
+
+func (b Bcrypt) Verify(password, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (b Bcrypt) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (b Bcrypt) Outdated(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost < b.Cost
+}
+
+// Argon2id hashes passwords into the PHC string format:
+// $argon2id$v=19$m=<memory KiB>,t=<iterations>,p=<parallelism>$<salt>$<key>
+type Argon2id struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// argon2idParams is a decoded PHC string
+type argon2idParams struct {
+	version     int
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func (a Argon2id) Hash(password string) (string, error) {
+	salt := make([]byte, a.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("error generating salt: %w", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, a.Iterations, a.Memory, a.Parallelism, a.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, a.Memory, a.Iterations, a.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (a Argon2id) Verify(password, encoded string) (bool, error) {
+	params, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	key := argon2.IDKey([]byte(password), params.salt, params.iterations, params.memory, params.parallelism, uint32(len(params.key)))
+	return subtle.ConstantTimeCompare(key, params.key) == 1, nil
+}
+
+func (a Argon2id) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (a Argon2id) Outdated(encoded string) bool {
+	params, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return params.version != argon2.Version ||
+		params.memory < a.Memory ||
+		params.iterations < a.Iterations ||
+		params.parallelism != a.Parallelism ||
+		uint32(len(params.salt)) < a.SaltLength ||
+		uint32(len(params.key)) < a.KeyLength
+}
+
+func decodeArgon2id(encoded string) (*argon2idParams, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, ErrUnknownHashFormat
+	}
+
+	var params argon2idParams
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &params.version); err != nil {
+		return nil, fmt.Errorf("invalid argon2id version: %w", err)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism); err != nil {
+		return nil, fmt.Errorf("invalid argon2id parameters: %w", err)
+	}
+
+	var err error
+	if params.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+	if params.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, fmt.Errorf("invalid argon2id key: %w", err)
+	}
+	if len(params.key) == 0 || params.iterations == 0 || params.parallelism == 0 {
+		return nil, ErrUnknownHashFormat
+	}
+	return &params, nil
+}
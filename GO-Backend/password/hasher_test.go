@@ -0,0 +1,106 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Small parameters keep the tests fast; production settings come from ARGON2_*
+var testArgon = Argon2id{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestHasherVerify(t *testing.T) {
+	legacy := Bcrypt{Cost: 4}
+	hasher := NewHasher(testArgon, legacy)
+
+	argonHash, err := hasher.Hash("Violet-Harbor-42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(argonHash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatalf("Hash() = %q, want an argon2id PHC string", argonHash)
+	}
+	bcryptHash, err := legacy.Hash("Violet-Harbor-42")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		encoded  string
+		want     bool
+		err      bool
+	}{
+		{"argon2id match", "Violet-Harbor-42", argonHash, true, false},
+		{"argon2id mismatch", "violet-harbor-42", argonHash, false, false},
+		{"legacy bcrypt match", "Violet-Harbor-42", bcryptHash, true, false},
+		{"legacy bcrypt mismatch", "Violet-Harbor-43", bcryptHash, false, false},
+		{"unknown format", "Violet-Harbor-42", "md5:0123456789abcdef", false, true},
+		{"corrupt argon2id", "Violet-Harbor-42", "$argon2id$v=19$m=1024,t=1,p=1$!!$!!", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := hasher.Verify(tt.password, tt.encoded)
+			if (err != nil) != tt.err {
+				t.Fatalf("Verify() error = %v, want error %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("Verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := hasher.Verify("x", "plain"); !errors.Is(err, ErrUnknownHashFormat) {
+		t.Errorf("Verify of an unknown hash error = %v, want %v", err, ErrUnknownHashFormat)
+	}
+}
+
+func TestHasherNeedsRehash(t *testing.T) {
+	hasher := NewHasher(testArgon, Bcrypt{Cost: 4})
+	current, _ := testArgon.Hash("pw")
+	weaker := testArgon
+	weaker.Memory = 512
+	weak, _ := weaker.Hash("pw")
+	legacy, _ := Bcrypt{Cost: 4}.Hash("pw")
+
+	tests := []struct {
+		name    string
+		encoded string
+		want    bool
+	}{
+		{"current parameters", current, false},
+		{"less memory", weak, true},
+		{"legacy bcrypt", legacy, true},
+	}
+	for _, tt := range tests {
+		if got := hasher.NeedsRehash(tt.encoded); got != tt.want {
+			t.Errorf("%s: NeedsRehash() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// A bcrypt-preferring hasher only rehashes bcrypt hashes below its cost
+	bcryptFirst := NewHasher(Bcrypt{Cost: 5}, testArgon)
+	if !bcryptFirst.NeedsRehash(legacy) {
+		t.Error("a cost 4 hash is not outdated for cost 5")
+	}
+	if !bcryptFirst.NeedsRehash(current) {
+		t.Error("an argon2id hash does not need rehashing when bcrypt is preferred")
+	}
+}
+
+func TestHasherMaxPasswordLength(t *testing.T) {
+	tests := []struct {
+		name   string
+		hasher *Hasher
+		want   int
+	}{
+		{"argon2id with legacy bcrypt", NewHasher(testArgon, Bcrypt{Cost: 4}), DefaultMaxLength},
+		{"bcrypt preferred", NewHasher(Bcrypt{Cost: 4}, testArgon), BcryptMaxLength},
+	}
+	for _, tt := range tests {
+		if got := tt.hasher.MaxPasswordLength(); got != tt.want {
+			t.Errorf("%s: MaxPasswordLength() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package password
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Rule names reported in violations
+const (
+	RuleMinLength = "min_length"
+	RuleMaxLength = "max_length"
+	RuleUppercase = "uppercase"
+	RuleLowercase = "lowercase"
+	RuleDigit     = "digit"
+	RuleSymbol    = "symbol"
+	RuleStrength  = "strength"
+	RuleBreached  = "breached"
+	RuleReuse     = "reuse"
+)
+
+// Longest passwords accepted, in bytes
+const (
+	// BcryptMaxLength applies while bcrypt hashes new passwords: it ignores everything
+	// past 72 bytes, so longer passwords would be silently truncated
+	BcryptMaxLength = 72
+	// DefaultMaxLength applies otherwise. argon2id hashes any length; the cap only
+	// bounds the work a single login or password change can cause.
+	DefaultMaxLength = 256
+)
+
+// Config holds the tunable password rules
+type Config struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	MinStrength   int // 0-4, see EstimateStrength
+	HistorySize   int // number of recent passwords that cannot be reused, including the current one
+	MaxLength     int // in bytes; DefaultMaxLength when zero, see Hasher.MaxPasswordLength
+}
+
+// Violation is one broken rule
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PolicyError lists every rule a password broke
+type PolicyError struct {
+	Violations []Violation
+}
+
+func (e *PolicyError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		messages = append(messages, v.Message)
+	}
+	return "password does not meet the policy: " + strings.Join(messages, "; ")
+}
+
+// Policy checks new passwords against the configured rules
+type Policy struct {
+	config   Config
+	breached *BreachedList
+}
+
+func NewPolicy(config Config, breached *BreachedList) *Policy {
+	if config.MaxLength <= 0 {
+		config.MaxLength = DefaultMaxLength
+	}
+	return &Policy{config: config, breached: breached}
+}
+
+// HistorySize is the number of recent passwords kept for the reuse check
+func (p *Policy) HistorySize() int {
+	return p.config.HistorySize
+}
+
+// Validate checks a new password. userInputs are values such as the user's name
+// and email that make a password easy to guess when it contains them.
+// It returns a *PolicyError listing every violated rule.
+func (p *Policy) Validate(password string, userInputs ...string) error {
+	var violations []Violation
+	add := func(rule, message string) {
+		violations = append(violations, Violation{Rule: rule, Message: message})
+	}
+
+	if len([]rune(password)) < p.config.MinLength {
+		add(RuleMinLength, fmt.Sprintf("Password must be at least %d characters long", p.config.MinLength))
+	}
+	if len(password) > p.config.MaxLength {
+		add(RuleMaxLength, fmt.Sprintf("Password must be at most %d bytes long", p.config.MaxLength))
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		default:
+			hasSymbol = true
+		}
+	}
+	if p.config.RequireUpper && !hasUpper {
+		add(RuleUppercase, "Password must contain an uppercase letter")
+	}
+	if p.config.RequireLower && !hasLower {
+		add(RuleLowercase, "Password must contain a lowercase letter")
+	}
+	if p.config.RequireDigit && !hasDigit {
+		add(RuleDigit, "Password must contain a digit")
+	}
+	if p.config.RequireSymbol && !hasSymbol {
+		add(RuleSymbol, "Password must contain a symbol")
+	}
+
+	breached := p.breached.Contains(password)
+	if breached {
+		add(RuleBreached, "Password appears in a list of breached passwords")
+	} else if score := EstimateStrength(password, userInputs...); score < p.config.MinStrength {
+		add(RuleStrength, fmt.Sprintf("Password is too easy to guess (strength %d of 4, need %d)", score, p.config.MinStrength))
+	}
+
+	if len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// CheckReuse rejects a password matching any of the given hashes, newest first.
+// Only the first HistorySize hashes are checked.
+func (p *Policy) CheckReuse(password string, hashes []string, hasher *Hasher) error {
+	if len(hashes) > p.config.HistorySize {
+		hashes = hashes[:p.config.HistorySize]
+	}
+	for _, hash := range hashes {
+		if matched, _ := hasher.Verify(password, hash); matched {
+			return &PolicyError{Violations: []Violation{{
+				Rule:    RuleReuse,
+				Message: fmt.Sprintf("Password must differ from your last %d passwords", p.config.HistorySize),
+			}}}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package password
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// rules lists the rules a PolicyError reports, in order
+func rules(err error) []string {
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) {
+		return nil
+	}
+	names := make([]string, 0, len(policyErr.Violations))
+	for _, v := range policyErr.Violations {
+		names = append(names, v.Rule)
+	}
+	return names
+}
+
+func TestPolicyValidate(t *testing.T) {
+	breached, err := LoadBreachedList("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := NewPolicy(Config{
+		MinLength:    8,
+		RequireUpper: true,
+		RequireLower: true,
+		RequireDigit: true,
+		MinStrength:  2,
+		HistorySize:  3,
+	}, breached)
+
+	tests := []struct {
+		name       string
+		password   string
+		userInputs []string
+		want       []string
+	}{
+		{"strong", "Violet-Harbor-42", nil, nil},
+		{"too short", "Vh4!", nil, []string{RuleMinLength, RuleStrength}},
+		{"no uppercase", "violet-harbor-42", nil, []string{RuleUppercase}},
+		{"no lowercase", "VIOLET-HARBOR-42", nil, []string{RuleLowercase}},
+		{"no digit", "Violet-Harbor-xy", nil, []string{RuleDigit}},
+		{"breached", "Password1", nil, []string{RuleBreached}},
+		{"sequences are weak", "Abcdefgh1234", nil, []string{RuleStrength}},
+		{"personal details are weak", "Nimal.Perera1", []string{"Nimal Perera", "nimal.perera@example.com"}, []string{RuleStrength}},
+		{"longer than the default cap", "Aa1" + strings.Repeat("x9-", DefaultMaxLength/3), nil, []string{RuleMaxLength}},
+		{"every rule at once", "", nil, []string{RuleMinLength, RuleUppercase, RuleLowercase, RuleDigit, RuleStrength}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rules(policy.Validate(tt.password, tt.userInputs...))
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Validate(%q) broke %v, want %v", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyMaxLength(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxLength int
+		length    int
+		wantError bool
+	}{
+		{"bcrypt limit", BcryptMaxLength, BcryptMaxLength, false},
+		{"past the bcrypt limit", BcryptMaxLength, BcryptMaxLength + 1, true},
+		{"default when unset", 0, DefaultMaxLength, false},
+		{"past the default", 0, DefaultMaxLength + 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := NewPolicy(Config{MaxLength: tt.maxLength}, nil)
+			got := rules(policy.Validate(strings.Repeat("a", tt.length)))
+			hasError := strings.Contains(strings.Join(got, ","), RuleMaxLength)
+			if hasError != tt.wantError {
+				t.Errorf("a %d byte password broke %v, want max_length %v", tt.length, got, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestEstimateStrength(t *testing.T) {
+	tests := []struct {
+		name       string
+		password   string
+		userInputs []string
+		min, max   int
+	}{
+		{"repeated character", "aaaaaaaaaa", nil, 0, 0},
+		{"alphabet run", "abcdefghij", nil, 0, 0},
+		{"keyboard run", "qwertyuiop", nil, 0, 0},
+		{"digits only", "4829", nil, 0, 0},
+		{"mixed classes", "Violet-Harbor-42", nil, 3, 4},
+		{"long passphrase", "correct horse battery staple, Quietly 1987!", nil, 4, 4},
+		{"name copied in", "Nimal.Perera1", []string{"Nimal Perera"}, 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := EstimateStrength(tt.password, tt.userInputs...)
+			if got < tt.min || got > tt.max {
+				t.Errorf("EstimateStrength(%q) = %d, want %d-%d", tt.password, got, tt.min, tt.max)
+			}
+		})
+	}
+
+	// Personal details only ever make a password weaker
+	if with, without := EstimateStrength("Nimal.Perera1", "Nimal Perera"), EstimateStrength("Nimal.Perera1"); with >= without {
+		t.Errorf("strength with the user's name = %d, without = %d; want lower", with, without)
+	}
+}
+
+func TestBreachedList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	content := "# comment\n" +
+		"hunter2\n" +
+		strings.ToUpper(sha1Hex("Summer2024!")) + ":3861\n" +
+		"\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	list, err := LoadBreachedList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{"123456", true},      // built in
+		{"hunter2", true},     // plain line
+		{"Summer2024!", true}, // SHA-1 digest with a count
+		{"# comment", false},
+		{"Violet-Harbor-42", false},
+	}
+	for _, tt := range tests {
+		if got := list.Contains(tt.password); got != tt.want {
+			t.Errorf("Contains(%q) = %v, want %v", tt.password, got, tt.want)
+		}
+	}
+
+	if _, err := LoadBreachedList(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("LoadBreachedList of a missing file succeeded")
+	}
+	var none *BreachedList
+	if none.Contains("123456") {
+		t.Error("a nil list contains a password")
+	}
+}
+
+func TestPolicyCheckReuse(t *testing.T) {
+	hasher := NewHasher(Bcrypt{Cost: 4})
+	var hashes []string // newest first
+	for _, pw := range []string{"Third-Pass-3", "Second-Pass-2", "First-Pass-1"} {
+		hash, err := hasher.Hash(pw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, hash)
+	}
+	policy := NewPolicy(Config{HistorySize: 2}, nil)
+
+	tests := []struct {
+		password string
+		want     []string
+	}{
+		{"Third-Pass-3", []string{RuleReuse}},
+		{"Second-Pass-2", []string{RuleReuse}},
+		{"First-Pass-1", nil}, // older than the history size
+		{"Fourth-Pass-4", nil},
+	}
+	for _, tt := range tests {
+		got := rules(policy.CheckReuse(tt.password, hashes, hasher))
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("CheckReuse(%q) broke %v, want %v", tt.password, got, tt.want)
+		}
+	}
+}
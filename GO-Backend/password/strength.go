@@ -0,0 +1,100 @@
+package password
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// keyboardRows are scanned for runs like "qwerty" or "asdf"
+var keyboardRows = []string{"1234567890", "qwertyuiop", "asdfghjkl", "zxcvbnm", "abcdefghijklmnopqrstuvwxyz"}
+
+// EstimateStrength scores a password from 0 (trivial) to 4 (strong). It starts
+// from the brute-force entropy of the character classes used and discounts
+// repeated characters, keyboard and alphabet sequences, and parts copied from
+// userInputs such as the user's name or email.
+func EstimateStrength(password string, userInputs ...string) int {
+	effective := strings.ToLower(password)
+
+	// Copying personal details adds almost nothing an attacker would not try first
+	for _, input := range userInputs {
+		for _, part := range strings.FieldsFunc(strings.ToLower(input), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			if len(part) >= 3 {
+				effective = strings.ReplaceAll(effective, part, "*")
+			}
+		}
+	}
+
+	length := 0.0
+	runes := []rune(effective)
+	for i, r := range runes {
+		weight := 1.0
+		if i > 0 && r == runes[i-1] {
+			weight = 0.25 // "aaaa"
+		} else if i > 0 && inSequence(runes[i-1], r) {
+			weight = 0.25 // "abcd", "1234", "qwer"
+		}
+		length += weight
+	}
+
+	bits := length * math.Log2(float64(charsetSize(password)))
+	switch {
+	case bits < 28:
+		return 0
+	case bits < 36:
+		return 1
+	case bits < 60:
+		return 2
+	case bits < 80:
+		return 3
+	default:
+		return 4
+	}
+}
+
+func charsetSize(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	size := 0
+	if lower {
+		size += 26
+	}
+	if upper {
+		size += 26
+	}
+	if digit {
+		size += 10
+	}
+	if symbol {
+		size += 33
+	}
+	if size < 2 {
+		size = 2
+	}
+	return size
+}
+
+// inSequence reports whether b follows or precedes a on a keyboard row or in the alphabet
+func inSequence(a, b rune) bool {
+	for _, row := range keyboardRows {
+		i := strings.IndexRune(row, a)
+		j := strings.IndexRune(row, b)
+		if i >= 0 && j >= 0 && (j-i == 1 || i-j == 1) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	model "go-fiber-app/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type APIKeyRepository struct {
+	collection *mongo.Collection
+}
+
+func NewAPIKeyRepository(db *mongo.Database) *APIKeyRepository {
+	return &APIKeyRepository{collection: db.Collection("api_keys")}
+}
+
+func (r *APIKeyRepository) CreateKey(ctx context.Context, key *model.APIKey) error {
+	key.ID = primitive.NewObjectID()
+	if _, err := r.collection.InsertOne(ctx, key); err != nil {
+		return fmt.Errorf("error creating API key: %w", err)
+	}
+	return nil
+}
+
+func (r *APIKeyRepository) FindByHash(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	var key model.APIKey
+	err := r.collection.FindOne(ctx, bson.M{"key_hash": keyHash}).Decode(&key)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// ListByUser returns the user's keys, newest first, including revoked and expired ones
+func (r *APIKeyRepository) ListByUser(ctx context.Context, userID primitive.ObjectID) ([]model.APIKey, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error finding API keys: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	keys := []model.APIKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, fmt.Errorf("error decoding API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// Revoke disables a key belonging to the user. Revoking twice is a no-op.
+func (r *APIKeyRepository) Revoke(ctx context.Context, userID, keyID primitive.ObjectID) error {
+	filter := bson.M{"_id": keyID, "user_id": userID}
+	update := []bson.M{{"$set": bson.M{"revoked_at": bson.M{"$ifNull": bson.A{"$revoked_at", time.Now()}}}}}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("error revoking API key: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *APIKeyRepository) TouchLastUsed(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	update := bson.M{"$set": bson.M{"last_used_at": at}}
+	if _, err := r.collection.UpdateByID(ctx, id, update); err != nil {
+		return fmt.Errorf("error updating API key usage: %w", err)
+	}
+	return nil
+}
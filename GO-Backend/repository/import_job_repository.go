@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	model "go-fiber-app/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type ImportJobRepository struct {
+	collection *mongo.Collection
+}
+
+func NewImportJobRepository(db *mongo.Database) *ImportJobRepository {
+	return &ImportJobRepository{collection: db.Collection("import_jobs")}
+}
+
+func (r *ImportJobRepository) CreateJob(ctx context.Context, job *model.ImportJob) error {
+	job.ID = primitive.NewObjectID()
+	if _, err := r.collection.InsertOne(ctx, job); err != nil {
+		return fmt.Errorf("error creating import job: %w", err)
+	}
+	return nil
+}
+
+// FindJob returns the job, or mongo.ErrNoDocuments
+func (r *ImportJobRepository) FindJob(ctx context.Context, id primitive.ObjectID) (*model.ImportJob, error) {
+	var job model.ImportJob
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// SaveProgress writes the job's status, counters and row errors
+func (r *ImportJobRepository) SaveProgress(ctx context.Context, job *model.ImportJob) error {
+	update := bson.M{"$set": bson.M{
+		"status":      job.Status,
+		"processed":   job.Processed,
+		"created":     job.Created,
+		"invited":     job.Invited,
+		"failed":      job.Failed,
+		"errors":      job.Errors,
+		"error":       job.Error,
+		"updated_at":  job.UpdatedAt,
+		"finished_at": job.FinishedAt,
+	}}
+	if _, err := r.collection.UpdateOne(ctx, bson.M{"_id": job.ID}, update); err != nil {
+		return fmt.Errorf("error saving import job: %w", err)
+	}
+	return nil
+}
+
+// FailStaleJobs marks unfinished jobs without progress since the cutoff as failed,
+// as the server running them stopped, and returns how many there were
+func (r *ImportJobRepository) FailStaleJobs(ctx context.Context, cutoff time.Time) (int64, error) {
+	filter := bson.M{
+		"status":     bson.M{"$in": bson.A{model.ImportQueued, model.ImportRunning}},
+		"updated_at": bson.M{"$lt": cutoff},
+	}
+	update := bson.M{"$set": bson.M{
+		"status":      model.ImportFailed,
+		"error":       "interrupted; the rows counted as processed were handled",
+		"finished_at": time.Now(),
+	}}
+	result, err := r.collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, fmt.Errorf("error failing stale import jobs: %w", err)
+	}
+	return result.ModifiedCount, nil
+}
@@ -0,0 +1,214 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// caseInsensitive compares strings ignoring case, for indexes and the queries that should use them
+var caseInsensitive = &options.Collation{Locale: "en", Strength: 2}
+
+// uniqueIndex is a unique index created at startup
+type uniqueIndex struct {
+	collection string
+	name       string
+	field      string      // field name reported to clients on a conflict
+	key        string      // field indexed, when it is not field itself
+	normalize  interface{} // aggregation expression giving the value compared for uniqueness
+	collation  *options.Collation
+}
+
+// indexedField is the document field the index is built on
+func (i uniqueIndex) indexedField() string {
+	if i.key != "" {
+		return i.key
+	}
+	return i.field
+}
+
+var uniqueIndexes = []uniqueIndex{
+	{
+		collection: "users",
+		name:       "email_unique",
+		field:      "email",
+		normalize:  bson.M{"$toLower": bson.M{"$trim": bson.M{"input": "$email"}}},
+		collation:  caseInsensitive,
+	},
+	{
+		// Old and new format NICs of the same person are compared in the 12-digit format
+		collection: "users",
+		name:       "nic_normalized_unique",
+		field:      "nic",
+		key:        "nic_normalized",
+		normalize:  "$nic_normalized",
+	},
+	{
+		collection: "phones",
+		name:       "phone_number_unique",
+		field:      "number",
+		normalize:  bson.M{"$trim": bson.M{"input": "$number"}},
+	},
+}
+
+// retiredIndexes were replaced and are dropped at startup, so they no longer
+// reject writes the indexes that replaced them allow
+var retiredIndexes = map[string][]string{
+	"users": {"nic_unique"}, // replaced by nic_normalized_unique
+}
+
+// queryIndexes speed up frequent queries or expire short-lived documents; they are
+// created at startup along with the unique indexes
+var queryIndexes = map[string][]mongo.IndexModel{
+	"security_events": {
+		// Failed logins per IP, checked on every failed login
+		{Keys: bson.D{{Key: "ip", Value: 1}, {Key: "type", Value: 1}, {Key: "created_at", Value: -1}}, Options: options.Index().SetName("ip_type_created_at")},
+		// The admin event list filtered by user or email
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}, Options: options.Index().SetName("user_id_created_at")},
+		{Keys: bson.D{{Key: "email", Value: 1}, {Key: "created_at", Value: -1}}, Options: options.Index().SetName("email_created_at")},
+	},
+	"api_keys": {
+		// Every API key request looks the key up by hash, and two keys must never share one
+		{Keys: bson.D{{Key: "key_hash", Value: 1}}, Options: options.Index().SetName("key_hash_unique").SetUnique(true)},
+	},
+	"refresh_tokens": {
+		// Every refresh looks its token up by hash, and two tokens must never share one
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetName("token_hash_unique").SetUnique(true)},
+		// An expired token can no longer be refreshed or reused, so it can go
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetName("expires_at_ttl").SetExpireAfterSeconds(0)},
+	},
+	"sessions": {
+		// expires_at moves forward while the session is used, so only sessions left idle expire
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetName("expires_at_ttl").SetExpireAfterSeconds(0)},
+	},
+	"used_two_factor_challenges": {
+		// Used challenges only matter until the token expires
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetName("expires_at_ttl").SetExpireAfterSeconds(0)},
+	},
+}
+
+// DuplicateKeyError reports a write that would break a unique index
+type DuplicateKeyError struct {
+	Field string
+}
+
+func (e *DuplicateKeyError) Error() string {
+	return fmt.Sprintf("%s is already in use", e.Field)
+}
+
+// DuplicateGroup lists documents that share a value a unique index is meant to prevent
+type DuplicateGroup struct {
+	Collection string               `json:"collection"`
+	Field      string               `json:"field"`
+	Value      string               `json:"value"`
+	IDs        []primitive.ObjectID `json:"ids"`
+}
+
+// IndexReport says which unique indexes are in place and which were held back by existing duplicates
+type IndexReport struct {
+	Enforced   []string
+	Duplicates []DuplicateGroup
+}
+
+// EnsureIndexes drops the retired indexes and creates the unique indexes and the query indexes. A unique index is only
+// created once its collection has no duplicates; the duplicates are returned so they can be fixed first.
+func EnsureIndexes(ctx context.Context, db *mongo.Database) (*IndexReport, error) {
+	report := &IndexReport{}
+	for collection, names := range retiredIndexes {
+		for _, name := range names {
+			if _, err := db.Collection(collection).Indexes().DropOne(ctx, name); err != nil && !isIndexNotFound(err) {
+				return nil, fmt.Errorf("error dropping index %s: %w", name, err)
+			}
+		}
+	}
+	for _, index := range uniqueIndexes {
+		duplicates, err := findDuplicates(ctx, db, index)
+		if err != nil {
+			return nil, err
+		}
+		if len(duplicates) > 0 {
+			report.Duplicates = append(report.Duplicates, duplicates...)
+			continue
+		}
+
+		opts := options.Index().
+			SetName(index.name).
+			SetUnique(true).
+			// Empty values (e.g. accounts created through OIDC without a NIC) are not unique
+			SetPartialFilterExpression(bson.M{index.indexedField(): bson.M{"$gt": ""}})
+		if index.collation != nil {
+			opts.SetCollation(index.collation)
+		}
+		model := mongo.IndexModel{Keys: bson.D{{Key: index.indexedField(), Value: 1}}, Options: opts}
+		if _, err := db.Collection(index.collection).Indexes().CreateOne(ctx, model); err != nil {
+			return nil, fmt.Errorf("error creating index %s: %w", index.name, err)
+		}
+		report.Enforced = append(report.Enforced, index.collection+"."+index.name)
+	}
+
+	for collection, indexes := range queryIndexes {
+		if _, err := db.Collection(collection).Indexes().CreateMany(ctx, indexes); err != nil {
+			return nil, fmt.Errorf("error creating %s indexes: %w", collection, err)
+		}
+	}
+	return report, nil
+}
+
+func findDuplicates(ctx context.Context, db *mongo.Database, index uniqueIndex) ([]DuplicateGroup, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{index.indexedField(): bson.M{"$gt": ""}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   index.normalize,
+			"ids":   bson.M{"$push": "$_id"},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	}
+	cursor, err := db.Collection(index.collection).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("error checking %s for duplicate %s: %w", index.collection, index.field, err)
+	}
+	defer cursor.Close(ctx)
+
+	var groups []struct {
+		Value string               `bson:"_id"`
+		IDs   []primitive.ObjectID `bson:"ids"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, fmt.Errorf("error decoding duplicates: %w", err)
+	}
+
+	duplicates := make([]DuplicateGroup, 0, len(groups))
+	for _, g := range groups {
+		duplicates = append(duplicates, DuplicateGroup{Collection: index.collection, Field: index.field, Value: g.Value, IDs: g.IDs})
+	}
+	return duplicates, nil
+}
+
+// duplicateKeyError turns a duplicate key error from one of the unique indexes
+// into a *DuplicateKeyError naming the field, and passes other errors through
+func duplicateKeyError(err error) error {
+	if err == nil || !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+	for _, index := range uniqueIndexes {
+		if strings.Contains(err.Error(), "index: "+index.name+" ") {
+			return &DuplicateKeyError{Field: index.field}
+		}
+	}
+	return err
+}
+
+// IsDuplicateKey reports whether err is a *DuplicateKeyError and returns it
+func IsDuplicateKey(err error) (*DuplicateKeyError, bool) {
+	var dup *DuplicateKeyError
+	ok := errors.As(err, &dup)
+	return dup, ok
+}
@@ -0,0 +1,35 @@
+package repository
+
+import "testing"
+
+func TestQueryIndexes(t *testing.T) {
+	tests := []struct {
+		collection string
+		name       string
+		unique     bool
+		ttl        bool
+	}{
+		{"api_keys", "key_hash_unique", true, false},
+		{"refresh_tokens", "token_hash_unique", true, false},
+		{"refresh_tokens", "expires_at_ttl", false, true},
+		{"sessions", "expires_at_ttl", false, true},
+		{"used_two_factor_challenges", "expires_at_ttl", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.collection+"."+tt.name, func(t *testing.T) {
+			for _, index := range queryIndexes[tt.collection] {
+				if index.Options.Name == nil || *index.Options.Name != tt.name {
+					continue
+				}
+				if unique := index.Options.Unique != nil && *index.Options.Unique; unique != tt.unique {
+					t.Errorf("unique = %v, want %v", unique, tt.unique)
+				}
+				if ttl := index.Options.ExpireAfterSeconds != nil; ttl != tt.ttl {
+					t.Errorf("expires documents = %v, want %v", ttl, tt.ttl)
+				}
+				return
+			}
+			t.Errorf("index %s.%s not created at startup", tt.collection, tt.name)
+		})
+	}
+}
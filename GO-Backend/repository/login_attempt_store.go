@@ -0,0 +1,200 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	model "go-fiber-app/models"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LoginAttemptStore keeps failed login counters. Use the in-memory store for a
+// single instance and the Mongo store when several replicas share the load.
+type LoginAttemptStore interface {
+	// Get returns the attempt for key, or nil if there is none
+	Get(ctx context.Context, key string) (*model.LoginAttempt, error)
+	// RecordFailure increments the failure counter and returns the updated attempt
+	RecordFailure(ctx context.Context, key string, at time.Time) (*model.LoginAttempt, error)
+	SetBlockedUntil(ctx context.Context, key string, until time.Time) error
+	Reset(ctx context.Context, key string) error
+}
+
+// MemoryLoginAttemptStore keeps counters in process memory. Counters that can no
+// longer affect a login are dropped, and the number kept is capped, so failures
+// for endless made-up emails cannot exhaust memory.
+type MemoryLoginAttemptStore struct {
+	mu         sync.Mutex
+	attempts   map[string]*model.LoginAttempt
+	window     time.Duration // failures older than this no longer count
+	maxEntries int
+	lastSweep  time.Time
+}
+
+// memorySweepInterval limits how often a full store is scanned for expired counters
+const memorySweepInterval = time.Minute
+
+// NewMemoryLoginAttemptStore keeps counters for failures within window, at most maxEntries of them
+func NewMemoryLoginAttemptStore(window time.Duration, maxEntries int) *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{attempts: make(map[string]*model.LoginAttempt), window: window, maxEntries: maxEntries}
+}
+
+// expired reports whether the counter is outside the failure window and no longer blocks anyone
+func (s *MemoryLoginAttemptStore) expired(attempt *model.LoginAttempt, now time.Time) bool {
+	return now.Sub(attempt.LastFailureAt) > s.window && !now.Before(attempt.BlockedUntil)
+}
+
+func (s *MemoryLoginAttemptStore) Get(ctx context.Context, key string) (*model.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attempt, ok := s.attempts[key]
+	if !ok {
+		return nil, nil
+	}
+	if s.expired(attempt, time.Now()) {
+		delete(s.attempts, key)
+		return nil, nil
+	}
+	copied := *attempt
+	return &copied, nil
+}
+
+func (s *MemoryLoginAttemptStore) RecordFailure(ctx context.Context, key string, at time.Time) (*model.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attempt, ok := s.attempts[key]
+	if !ok {
+		s.makeRoom(at)
+		attempt = &model.LoginAttempt{Key: key}
+		s.attempts[key] = attempt
+	}
+	attempt.Failures++
+	attempt.LastFailureAt = at
+	copied := *attempt
+	return &copied, nil
+}
+
+// makeRoom keeps the store under maxEntries: it drops expired counters, and when
+// there are none, evicts a counter that is not blocking anyone if it can find one
+func (s *MemoryLoginAttemptStore) makeRoom(now time.Time) {
+	if s.maxEntries <= 0 || len(s.attempts) < s.maxEntries {
+		return
+	}
+	if now.Sub(s.lastSweep) >= memorySweepInterval {
+		s.lastSweep = now
+		for key, attempt := range s.attempts {
+			if s.expired(attempt, now) {
+				delete(s.attempts, key)
+			}
+		}
+	}
+	// Map iteration order is random, so this evicts an arbitrary counter
+	checked := 0
+	for key, attempt := range s.attempts {
+		if len(s.attempts) < s.maxEntries {
+			return
+		}
+		checked++
+		if now.Before(attempt.BlockedUntil) && checked < 16 {
+			continue
+		}
+		delete(s.attempts, key)
+	}
+}
+
+func (s *MemoryLoginAttemptStore) SetBlockedUntil(ctx context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if attempt, ok := s.attempts[key]; ok {
+		attempt.BlockedUntil = until
+	}
+	return nil
+}
+
+func (s *MemoryLoginAttemptStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
+
+// MongoLoginAttemptStore keeps counters in the login_attempts collection
+type MongoLoginAttemptStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoLoginAttemptStore(db *mongo.Database) *MongoLoginAttemptStore {
+	return &MongoLoginAttemptStore{collection: db.Collection("login_attempts")}
+}
+
+// loginAttemptExpiryIndex expires counters some time after their last failure
+const loginAttemptExpiryIndex = "last_failure_at_ttl"
+
+// SetExpiry makes MongoDB delete counters once their last failure is older than
+// lifetime, which must cover both the failure window and the longest block
+func (s *MongoLoginAttemptStore) SetExpiry(ctx context.Context, lifetime time.Duration) error {
+	seconds := int32(lifetime / time.Second)
+	if seconds < 1 {
+		return fmt.Errorf("login attempt lifetime must be at least a second, got %s", lifetime)
+	}
+	index := mongo.IndexModel{
+		Keys:    bson.D{{Key: "last_failure_at", Value: 1}},
+		Options: options.Index().SetName(loginAttemptExpiryIndex).SetExpireAfterSeconds(seconds),
+	}
+	_, err := s.collection.Indexes().CreateOne(ctx, index)
+	if isIndexOptionsConflict(err) {
+		// The index exists with another lifetime; change it in place
+		err = s.collection.Database().RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: s.collection.Name()},
+			{Key: "index", Value: bson.M{"name": loginAttemptExpiryIndex, "expireAfterSeconds": seconds}},
+		}).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("error setting login attempt expiry: %w", err)
+	}
+	return nil
+}
+
+func (s *MongoLoginAttemptStore) Get(ctx context.Context, key string) (*model.LoginAttempt, error) {
+	var attempt model.LoginAttempt
+	err := s.collection.FindOne(ctx, bson.M{"_id": key}).Decode(&attempt)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error finding login attempt: %w", err)
+	}
+	return &attempt, nil
+}
+
+func (s *MongoLoginAttemptStore) RecordFailure(ctx context.Context, key string, at time.Time) (*model.LoginAttempt, error) {
+	update := bson.M{
+		"$inc": bson.M{"failures": 1},
+		"$set": bson.M{"last_failure_at": at},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var attempt model.LoginAttempt
+	if err := s.collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, update, opts).Decode(&attempt); err != nil {
+		return nil, fmt.Errorf("error recording login failure: %w", err)
+	}
+	return &attempt, nil
+}
+
+func (s *MongoLoginAttemptStore) SetBlockedUntil(ctx context.Context, key string, until time.Time) error {
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$set": bson.M{"blocked_until": until}})
+	if err != nil {
+		return fmt.Errorf("error updating login attempt: %w", err)
+	}
+	return nil
+}
+
+func (s *MongoLoginAttemptStore) Reset(ctx context.Context, key string) error {
+	if _, err := s.collection.DeleteOne(ctx, bson.M{"_id": key}); err != nil {
+		return fmt.Errorf("error resetting login attempt: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestMemoryLoginAttemptStoreExpiry(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryLoginAttemptStore(15*time.Minute, 100)
+	now := time.Now()
+
+	store.RecordFailure(ctx, "recent", now.Add(-time.Minute))
+	store.RecordFailure(ctx, "stale", now.Add(-20*time.Minute))
+	store.RecordFailure(ctx, "blocked", now.Add(-20*time.Minute))
+	store.SetBlockedUntil(ctx, "blocked", now.Add(time.Minute))
+
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"recent", true},
+		{"stale", false},   // outside the window
+		{"blocked", true},  // outside the window but still blocking
+		{"unknown", false}, // never failed
+	}
+	for _, tt := range tests {
+		attempt, err := store.Get(ctx, tt.key)
+		if err != nil {
+			t.Fatalf("Get(%q) error = %v", tt.key, err)
+		}
+		if (attempt != nil) != tt.want {
+			t.Errorf("Get(%q) = %+v, want found %v", tt.key, attempt, tt.want)
+		}
+	}
+	if _, kept := store.attempts["stale"]; kept {
+		t.Error("an expired counter was kept after it was read")
+	}
+}
+
+func TestMemoryLoginAttemptStoreCap(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryLoginAttemptStore(15*time.Minute, 10)
+	now := time.Now()
+
+	store.RecordFailure(ctx, "blocked", now)
+	store.SetBlockedUntil(ctx, "blocked", now.Add(time.Hour))
+	for i := 0; i < 50; i++ {
+		store.RecordFailure(ctx, fmt.Sprintf("made-up-%d@example.com", i), now)
+	}
+
+	if n := len(store.attempts); n > 10 {
+		t.Errorf("store holds %d counters, want at most 10", n)
+	}
+	// Counters that are blocking someone are evicted last
+	if attempt, _ := store.Get(ctx, "blocked"); attempt == nil {
+		t.Error("a blocking counter was evicted while others were not blocking anyone")
+	}
+	// A counter still being added to keeps its count
+	attempt, _ := store.RecordFailure(ctx, "made-up-49@example.com", now)
+	if attempt.Failures != 2 {
+		t.Errorf("failures = %d, want 2", attempt.Failures)
+	}
+}
+
+func TestMongoLoginAttemptStoreSetExpiry(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("creates the TTL index", func(mt *mtest.T) {
+		store := NewMongoLoginAttemptStore(mt.DB)
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		if err := store.SetExpiry(mt.Context(), 15*time.Minute); err != nil {
+			mt.Fatalf("SetExpiry() error = %v", err)
+		}
+		index := mt.GetStartedEvent().Command.Lookup("indexes").Array().Index(0).Value().Document()
+		if seconds := index.Lookup("expireAfterSeconds").Int32(); seconds != 900 {
+			mt.Errorf("expireAfterSeconds = %d, want 900", seconds)
+		}
+		if key := index.Lookup("key").Document().Index(0).Key(); key != "last_failure_at" {
+			mt.Errorf("index on %s, want last_failure_at", key)
+		}
+	})
+
+	mt.Run("changes an existing lifetime in place", func(mt *mtest.T) {
+		store := NewMongoLoginAttemptStore(mt.DB)
+		mt.AddMockResponses(
+			mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 85, Message: "IndexOptionsConflict"}),
+			mtest.CreateSuccessResponse(),
+		)
+
+		if err := store.SetExpiry(mt.Context(), time.Hour); err != nil {
+			mt.Fatalf("SetExpiry() error = %v", err)
+		}
+		mt.GetStartedEvent() // createIndexes
+		collMod := mt.GetStartedEvent()
+		if collMod.CommandName != "collMod" {
+			mt.Fatalf("second command = %s, want collMod", collMod.CommandName)
+		}
+		if seconds := collMod.Command.Lookup("index", "expireAfterSeconds").Int32(); seconds != 3600 {
+			mt.Errorf("collMod expireAfterSeconds = %d, want 3600", seconds)
+		}
+	})
+
+	mt.Run("rejects a lifetime under a second", func(mt *mtest.T) {
+		if err := NewMongoLoginAttemptStore(mt.DB).SetExpiry(mt.Context(), 0); err == nil {
+			mt.Error("SetExpiry(0) succeeded")
+		}
+	})
+}
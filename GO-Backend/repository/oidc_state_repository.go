@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	model "go-fiber-app/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type OIDCStateRepository struct {
+	collection *mongo.Collection
+}
+
+func NewOIDCStateRepository(db *mongo.Database) *OIDCStateRepository {
+	return &OIDCStateRepository{collection: db.Collection("oidc_login_states")}
+}
+
+// CreateState stores a pending login and clears out abandoned ones
+func (r *OIDCStateRepository) CreateState(ctx context.Context, state *model.OIDCLoginState) error {
+	if _, err := r.collection.DeleteMany(ctx, bson.M{"expires_at": bson.M{"$lte": time.Now()}}); err != nil {
+		return fmt.Errorf("error clearing expired login states: %w", err)
+	}
+	if _, err := r.collection.InsertOne(ctx, state); err != nil {
+		return fmt.Errorf("error creating login state: %w", err)
+	}
+	return nil
+}
+
+// ConsumeState removes and returns an unexpired login state, so each state works only once
+func (r *OIDCStateRepository) ConsumeState(ctx context.Context, stateHash string) (*model.OIDCLoginState, error) {
+	var state model.OIDCLoginState
+	filter := bson.M{"_id": stateHash, "expires_at": bson.M{"$gt": time.Now()}}
+	if err := r.collection.FindOneAndDelete(ctx, filter).Decode(&state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
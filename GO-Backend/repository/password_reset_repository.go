@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	model "go-fiber-app/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type PasswordResetRepository struct {
+	collection *mongo.Collection
+}
+
+func NewPasswordResetRepository(db *mongo.Database) *PasswordResetRepository {
+	return &PasswordResetRepository{collection: db.Collection("password_reset_tokens")}
+}
+
+func (r *PasswordResetRepository) CreateToken(ctx context.Context, token *model.PasswordResetToken) error {
+	token.ID = primitive.NewObjectID()
+	if _, err := r.collection.InsertOne(ctx, token); err != nil {
+		return fmt.Errorf("error creating password reset token: %w", err)
+	}
+	return nil
+}
+
+func (r *PasswordResetRepository) FindByHash(ctx context.Context, tokenHash string) (*model.PasswordResetToken, error) {
+	var token model.PasswordResetToken
+	err := r.collection.FindOne(ctx, bson.M{"token_hash": tokenHash}).Decode(&token)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// MarkUsed consumes an unused, unexpired token. It returns false if the token was already used.
+func (r *PasswordResetRepository) MarkUsed(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	now := time.Now()
+	filter := bson.M{"_id": id, "used_at": nil, "expires_at": bson.M{"$gt": now}}
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"used_at": now}})
+	if err != nil {
+		return false, fmt.Errorf("error consuming password reset token: %w", err)
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// HasRecentToken reports whether the user has an unused, unexpired token created after since
+func (r *PasswordResetRepository) HasRecentToken(ctx context.Context, userID primitive.ObjectID, since time.Time) (bool, error) {
+	filter := bson.M{"user_id": userID, "used_at": nil, "expires_at": bson.M{"$gt": time.Now()}, "created_at": bson.M{"$gt": since}}
+	count, err := r.collection.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("error checking for a recent password reset token: %w", err)
+	}
+	return count > 0, nil
+}
+
+// InvalidateForUser consumes every outstanding token for the user
+func (r *PasswordResetRepository) InvalidateForUser(ctx context.Context, userID primitive.ObjectID) error {
+	filter := bson.M{"user_id": userID, "used_at": nil}
+	if _, err := r.collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"used_at": time.Now()}}); err != nil {
+		return fmt.Errorf("error invalidating password reset tokens: %w", err)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	model "go-fiber-app/models"
 
@@ -10,6 +11,9 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// ErrPhoneNotFound is returned when the user has no phone number with the given ID
+var ErrPhoneNotFound = errors.New("phone not found")
+
 type PhoneRepository struct {
 	db *mongo.Database
 }
@@ -30,7 +34,7 @@ func (r *PhoneRepository) CreatePhone(ctx context.Context, phone *model.PhoneNum
 	result, err := collection.InsertOne(ctx, phone)
 	if err != nil {
 		fmt.Printf("MongoDB insert error: %v\n", err)
-		return fmt.Errorf("error creating phone: %w", err)
+		return fmt.Errorf("error creating phone: %w", duplicateKeyError(err))
 	}
 
 	fmt.Printf("Phone inserted successfully with ID: %v\n", result.InsertedID)
@@ -62,39 +66,110 @@ func (r *PhoneRepository) GetPhonesByUser(ctx context.Context, userID primitive.
 	return phones, nil
 }
 
+func (r *PhoneRepository) GetPhone(ctx context.Context, userID, phoneID primitive.ObjectID) (*model.PhoneNumber, error) {
+	collection := r.db.Collection("phones")
+
+	var phone model.PhoneNumber
+	err := collection.FindOne(ctx, bson.M{"_id": phoneID, "user_id": userID}).Decode(&phone)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrPhoneNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error finding phone: %w", err)
+	}
+	return &phone, nil
+}
+
+// UpdatePhone saves the number and type, as long as the phone is still at phone.Version
 func (r *PhoneRepository) UpdatePhone(ctx context.Context, phone *model.PhoneNumber) error {
 	collection := r.db.Collection("phones")
 
-	filter := bson.M{"_id": phone.ID, "user_id": phone.UserID}
+	filter := bson.M{"_id": phone.ID, "user_id": phone.UserID, "version": versionIs(phone.Version)}
 	update := bson.M{"$set": bson.M{
 		"number": phone.Number,
 		"type":   phone.Type,
 	}}
 
-	result, err := collection.UpdateOne(ctx, filter, update)
+	result, err := collection.UpdateOne(ctx, filter, bumpVersion(update))
 	if err != nil {
-		return fmt.Errorf("error updating phone: %w", err)
+		return fmt.Errorf("error updating phone: %w", duplicateKeyError(err))
 	}
 
 	if result.MatchedCount == 0 {
-		return fmt.Errorf("phone not found")
+		return r.missOrConflict(ctx, phone.UserID, phone.ID)
 	}
 
 	return nil
 }
 
-func (r *PhoneRepository) DeletePhone(ctx context.Context, userID, phoneID primitive.ObjectID) error {
+// DeletePhone removes the phone, as long as it is still at the given version
+func (r *PhoneRepository) DeletePhone(ctx context.Context, userID, phoneID primitive.ObjectID, version int64) error {
 	collection := r.db.Collection("phones")
 
-	filter := bson.M{"_id": phoneID, "user_id": userID}
+	filter := bson.M{"_id": phoneID, "user_id": userID, "version": versionIs(version)}
 	result, err := collection.DeleteOne(ctx, filter)
 	if err != nil {
 		return fmt.Errorf("error deleting phone: %w", err)
 	}
 
 	if result.DeletedCount == 0 {
-		return fmt.Errorf("phone not found")
+		return r.missOrConflict(ctx, userID, phoneID)
 	}
 
 	return nil
 }
+
+// missOrConflict explains why a conditional write matched nothing: the phone is gone, or at another version
+func (r *PhoneRepository) missOrConflict(ctx context.Context, userID, phoneID primitive.ObjectID) error {
+	if _, err := r.GetPhone(ctx, userID, phoneID); err != nil {
+		return err
+	}
+	return ErrVersionConflict
+}
+
+// DeletePhonesByUser removes every phone number of the user
+func (r *PhoneRepository) DeletePhonesByUser(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	collection := r.db.Collection("phones")
+
+	result, err := collection.DeleteMany(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return 0, fmt.Errorf("error deleting phones: %w", err)
+	}
+	return result.DeletedCount, nil
+}
+
+// DeleteOrphanedPhones removes phone numbers whose user no longer exists and returns how many
+func (r *PhoneRepository) DeleteOrphanedPhones(ctx context.Context) (int64, error) {
+	collection := r.db.Collection("phones")
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$lookup", Value: bson.M{"from": "users", "localField": "user_id", "foreignField": "_id", "as": "user"}}},
+		{{Key: "$match", Value: bson.M{"user": bson.M{"$size": 0}}}},
+		{{Key: "$project", Value: bson.M{"_id": 1}}},
+	}
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, fmt.Errorf("error finding orphaned phones: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var orphans []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &orphans); err != nil {
+		return 0, fmt.Errorf("error decoding orphaned phones: %w", err)
+	}
+	if len(orphans) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]primitive.ObjectID, len(orphans))
+	for i, o := range orphans {
+		ids[i] = o.ID
+	}
+	result, err := collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, fmt.Errorf("error deleting orphaned phones: %w", err)
+	}
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	model "go-fiber-app/models"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SecurityEventFilter narrows a security event query. Zero values match everything.
+type SecurityEventFilter struct {
+	Types  []string
+	UserID string
+	Email  string
+	IP     string
+	From   time.Time
+	To     time.Time
+	Before primitive.ObjectID // only events older than this one, for paging
+	Limit  int64
+}
+
+type SecurityEventRepository struct {
+	collection *mongo.Collection
+}
+
+func NewSecurityEventRepository(db *mongo.Database) *SecurityEventRepository {
+	return &SecurityEventRepository{collection: db.Collection("security_events")}
+}
+
+// retentionIndex expires events once they are older than the retention period
+const retentionIndex = "created_at_ttl"
+
+// SetRetention makes MongoDB delete events older than retention. Zero keeps events forever.
+func (r *SecurityEventRepository) SetRetention(ctx context.Context, retention time.Duration) error {
+	if retention <= 0 {
+		if _, err := r.collection.Indexes().DropOne(ctx, retentionIndex); err != nil && !isIndexNotFound(err) {
+			return fmt.Errorf("error removing security event retention: %w", err)
+		}
+		return nil
+	}
+
+	seconds := int32(retention / time.Second)
+	index := mongo.IndexModel{
+		Keys:    bson.D{{Key: "created_at", Value: 1}},
+		Options: options.Index().SetName(retentionIndex).SetExpireAfterSeconds(seconds),
+	}
+	_, err := r.collection.Indexes().CreateOne(ctx, index)
+	if isIndexOptionsConflict(err) {
+		// The index exists with another retention period; change it in place
+		err = r.collection.Database().RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: r.collection.Name()},
+			{Key: "index", Value: bson.M{"name": retentionIndex, "expireAfterSeconds": seconds}},
+		}).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("error setting security event retention: %w", err)
+	}
+	return nil
+}
+
+func isIndexNotFound(err error) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && (cmdErr.Code == 27 || cmdErr.Code == 26) // IndexNotFound, NamespaceNotFound
+}
+
+func isIndexOptionsConflict(err error) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && cmdErr.Code == 85 // IndexOptionsConflict
+}
+
+// CreateEvent stores the event. Emails are stored in lower case so they can be looked up exactly.
+func (r *SecurityEventRepository) CreateEvent(ctx context.Context, event *model.SecurityEvent) error {
+	event.ID = primitive.NewObjectID()
+	event.Email = strings.ToLower(event.Email)
+	if _, err := r.collection.InsertOne(ctx, event); err != nil {
+		return fmt.Errorf("error recording security event: %w", err)
+	}
+	return nil
+}
+
+// FindEvents returns the matching events, newest first
+func (r *SecurityEventRepository) FindEvents(ctx context.Context, f SecurityEventFilter) ([]model.SecurityEvent, error) {
+	filter := bson.M{}
+	if len(f.Types) > 0 {
+		filter["type"] = bson.M{"$in": f.Types}
+	}
+	if f.UserID != "" {
+		filter["user_id"] = f.UserID
+	}
+	if f.Email != "" {
+		filter["email"] = strings.ToLower(f.Email)
+	}
+	if f.IP != "" {
+		filter["ip"] = f.IP
+	}
+	createdAt := bson.M{}
+	if !f.From.IsZero() {
+		createdAt["$gte"] = f.From
+	}
+	if !f.To.IsZero() {
+		createdAt["$lt"] = f.To
+	}
+	if len(createdAt) > 0 {
+		filter["created_at"] = createdAt
+	}
+	if !f.Before.IsZero() {
+		filter["_id"] = bson.M{"$lt": f.Before}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(f.Limit)
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error finding security events: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	events := []model.SecurityEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, fmt.Errorf("error decoding security events: %w", err)
+	}
+	return events, nil
+}
+
+// CountAccountsFailedFromIP counts the distinct emails with a failed login from the IP since the given time
+func (r *SecurityEventRepository) CountAccountsFailedFromIP(ctx context.Context, ip string, since time.Time) (int, error) {
+	filter := bson.M{"type": model.EventLoginFailure, "ip": ip, "created_at": bson.M{"$gte": since}}
+	emails, err := r.collection.Distinct(ctx, "email", filter)
+	if err != nil {
+		return 0, fmt.Errorf("error counting failed logins: %w", err)
+	}
+	return len(emails), nil
+}
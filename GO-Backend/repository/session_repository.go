@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	model "go-fiber-app/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type SessionRepository struct {
+	collection *mongo.Collection
+}
+
+func NewSessionRepository(db *mongo.Database) *SessionRepository {
+	return &SessionRepository{collection: db.Collection("sessions")}
+}
+
+func (r *SessionRepository) CreateSession(ctx context.Context, session *model.Session) error {
+	session.ID = primitive.NewObjectID()
+	if _, err := r.collection.InsertOne(ctx, session); err != nil {
+		return fmt.Errorf("error creating session: %w", err)
+	}
+	return nil
+}
+
+func (r *SessionRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*model.Session, error) {
+	var session model.Session
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// ListActiveByUser returns the user's unrevoked, unexpired sessions, most recently used first
+func (r *SessionRepository) ListActiveByUser(ctx context.Context, userID primitive.ObjectID) ([]model.Session, error) {
+	filter := bson.M{"user_id": userID, "revoked_at": nil, "expires_at": bson.M{"$gt": time.Now()}}
+	opts := options.Find().SetSort(bson.D{{Key: "last_seen_at", Value: -1}})
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error finding sessions: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	sessions := []model.Session{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, fmt.Errorf("error decoding sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+func (r *SessionRepository) TouchLastSeen(ctx context.Context, id primitive.ObjectID, ip string, at time.Time) error {
+	update := bson.M{"$set": bson.M{"last_seen_at": at, "ip": ip}}
+	if _, err := r.collection.UpdateByID(ctx, id, update); err != nil {
+		return fmt.Errorf("error updating session: %w", err)
+	}
+	return nil
+}
+
+// Extend moves the expiry along with a rotated refresh token
+func (r *SessionRepository) Extend(ctx context.Context, id primitive.ObjectID, expiresAt time.Time) error {
+	update := bson.M{"$set": bson.M{"expires_at": expiresAt, "last_seen_at": time.Now()}}
+	if _, err := r.collection.UpdateByID(ctx, id, update); err != nil {
+		return fmt.Errorf("error extending session: %w", err)
+	}
+	return nil
+}
+
+// Revoke ends one of the user's sessions
+func (r *SessionRepository) Revoke(ctx context.Context, userID, id primitive.ObjectID) error {
+	filter := bson.M{"_id": id, "user_id": userID, "revoked_at": nil}
+	update := bson.M{"$set": bson.M{"revoked_at": time.Now()}}
+
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("error revoking session: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *SessionRepository) RevokeAllForUser(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	filter := bson.M{"user_id": userID, "revoked_at": nil}
+	update := bson.M{"$set": bson.M{"revoked_at": time.Now()}}
+
+	result, err := r.collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, fmt.Errorf("error revoking sessions: %w", err)
+	}
+	return result.ModifiedCount, nil
+}
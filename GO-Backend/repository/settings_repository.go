@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	model "go-fiber-app/models"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type SettingsRepository struct {
+	collection *mongo.Collection
+}
+
+func NewSettingsRepository(db *mongo.Database) *SettingsRepository {
+	return &SettingsRepository{collection: db.Collection("settings")}
+}
+
+// GetSecuritySettings returns the stored settings, or defaults if none were saved yet
+func (r *SettingsRepository) GetSecuritySettings(ctx context.Context) (*model.SecuritySettings, error) {
+	var settings model.SecuritySettings
+	err := r.collection.FindOne(ctx, bson.M{"_id": model.SecuritySettingsID}).Decode(&settings)
+	if err == mongo.ErrNoDocuments {
+		return &model.SecuritySettings{ID: model.SecuritySettingsID, TwoFactorRequiredRoles: []string{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading security settings: %w", err)
+	}
+	return &settings, nil
+}
+
+func (r *SettingsRepository) SaveSecuritySettings(ctx context.Context, settings *model.SecuritySettings) error {
+	settings.ID = model.SecuritySettingsID
+	opts := options.Replace().SetUpsert(true)
+	if _, err := r.collection.ReplaceOne(ctx, bson.M{"_id": settings.ID}, settings, opts); err != nil {
+		return fmt.Errorf("error saving security settings: %w", err)
+	}
+	return nil
+}
+
+// migrationID keeps migration records apart from the other settings documents
+func migrationID(name string) string {
+	return "migration:" + name
+}
+
+// MigrationApplied reports whether the one-time migration was recorded as applied
+func (r *SettingsRepository) MigrationApplied(ctx context.Context, name string) (bool, error) {
+	count, err := r.collection.CountDocuments(ctx, bson.M{"_id": migrationID(name)}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("error checking migration %s: %w", name, err)
+	}
+	return count > 0, nil
+}
+
+// MarkMigrationApplied records the one-time migration as applied
+func (r *SettingsRepository) MarkMigrationApplied(ctx context.Context, name string) error {
+	migration := &model.Migration{ID: migrationID(name), AppliedAt: time.Now()}
+	if _, err := r.collection.InsertOne(ctx, migration); err != nil && !mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("error recording migration %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestSettingsRepositoryMigrations(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	count := func(n int) bson.D {
+		return mtest.CreateCursorResponse(0, "test.settings", mtest.FirstBatch, bson.D{{Key: "n", Value: n}})
+	}
+
+	mt.Run("not applied yet", func(mt *mtest.T) {
+		mt.AddMockResponses(count(0))
+		applied, err := NewSettingsRepository(mt.DB).MigrationApplied(mt.Context(), "seed_admin_role")
+		if err != nil || applied {
+			mt.Errorf("MigrationApplied() = %v, %v, want false", applied, err)
+		}
+	})
+
+	mt.Run("applied", func(mt *mtest.T) {
+		mt.AddMockResponses(count(1))
+		applied, err := NewSettingsRepository(mt.DB).MigrationApplied(mt.Context(), "seed_admin_role")
+		if err != nil || !applied {
+			mt.Errorf("MigrationApplied() = %v, %v, want true", applied, err)
+		}
+		match := mt.GetStartedEvent().Command.Lookup("pipeline").Array().Index(0).Value().Document().Lookup("$match")
+		if id := match.Document().Lookup("_id").StringValue(); id != "migration:seed_admin_role" {
+			mt.Errorf("looked up %q, want migration:seed_admin_role", id)
+		}
+	})
+
+	mt.Run("recording it twice is not an error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key"}))
+		if err := NewSettingsRepository(mt.DB).MarkMigrationApplied(mt.Context(), "seed_admin_role"); err != nil {
+			mt.Errorf("MarkMigrationApplied() error = %v", err)
+		}
+	})
+}
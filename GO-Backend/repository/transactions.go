@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Transactions runs groups of writes as multi-document transactions when the
+// deployment supports them. A standalone server does not, so there the writes
+// simply run one after another.
+type Transactions struct {
+	client    *mongo.Client
+	supported bool
+}
+
+// NewTransactions asks the server whether it is a replica set member or mongos,
+// the deployments that support transactions
+func NewTransactions(ctx context.Context, db *mongo.Database) (*Transactions, error) {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := db.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return nil, fmt.Errorf("error checking transaction support: %w", err)
+	}
+	return &Transactions{
+		client:    db.Client(),
+		supported: hello.SetName != "" || hello.Msg == "isdbgrid",
+	}, nil
+}
+
+// Supported reports whether Run uses a transaction
+func (t *Transactions) Supported() bool {
+	return t != nil && t.supported
+}
+
+// Run calls fn inside a transaction, committing if it returns nil and aborting
+// otherwise. fn must pass the context it is given to every repository call.
+func (t *Transactions) Run(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !t.Supported() {
+		return fn(ctx)
+	}
+	session, err := t.client.StartSession()
+	if err != nil {
+		return fmt.Errorf("error starting session: %w", err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
@@ -0,0 +1,28 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	model "go-fiber-app/models"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type TwoFactorChallengeRepository struct {
+	collection *mongo.Collection
+}
+
+func NewTwoFactorChallengeRepository(db *mongo.Database) *TwoFactorChallengeRepository {
+	return &TwoFactorChallengeRepository{collection: db.Collection("used_two_factor_challenges")}
+}
+
+// MarkUsed records the challenge as used. It returns false if it already was.
+func (r *TwoFactorChallengeRepository) MarkUsed(ctx context.Context, used *model.UsedTwoFactorChallenge) (bool, error) {
+	if _, err := r.collection.InsertOne(ctx, used); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error recording two-factor challenge: %w", err)
+	}
+	return true, nil
+}
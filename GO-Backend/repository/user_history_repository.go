@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	model "go-fiber-app/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// revisionAttempts bounds the retries when two changes to one user race for the same revision number
+const revisionAttempts = 5
+
+type UserHistoryRepository struct {
+	collection *mongo.Collection
+}
+
+func NewUserHistoryRepository(db *mongo.Database) *UserHistoryRepository {
+	return &UserHistoryRepository{collection: db.Collection("user_history")}
+}
+
+// CreateIndexes makes revision numbers unique per user and keeps history lookups fast
+func (r *UserHistoryRepository) CreateIndexes(ctx context.Context) error {
+	index := mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "revision", Value: -1}},
+		Options: options.Index().SetName("user_revision_unique").SetUnique(true),
+	}
+	if _, err := r.collection.Indexes().CreateOne(ctx, index); err != nil {
+		return fmt.Errorf("error creating user history index: %w", err)
+	}
+	return nil
+}
+
+// AddChange stores the change as the user's next revision
+func (r *UserHistoryRepository) AddChange(ctx context.Context, change *model.UserChange) error {
+	for attempt := 0; ; attempt++ {
+		latest, err := r.latestRevision(ctx, change.UserID)
+		if err != nil {
+			return err
+		}
+		change.ID = primitive.NewObjectID()
+		change.Revision = latest + 1
+		_, err = r.collection.InsertOne(ctx, change)
+		if err == nil {
+			return nil
+		}
+		if !mongo.IsDuplicateKeyError(err) || attempt == revisionAttempts-1 {
+			return fmt.Errorf("error recording user change: %w", err)
+		}
+	}
+}
+
+func (r *UserHistoryRepository) latestRevision(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	var latest model.UserChange
+	opts := options.FindOne().SetSort(bson.D{{Key: "revision", Value: -1}}).SetProjection(bson.M{"revision": 1})
+	err := r.collection.FindOne(ctx, bson.M{"user_id": userID}, opts).Decode(&latest)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error finding latest revision: %w", err)
+	}
+	return latest.Revision, nil
+}
+
+// FindChanges returns up to limit of the user's changes, newest first. A
+// non-zero before only returns revisions older than it, for paging.
+func (r *UserHistoryRepository) FindChanges(ctx context.Context, userID primitive.ObjectID, before, limit int64) ([]model.UserChange, error) {
+	filter := bson.M{"user_id": userID}
+	if before > 0 {
+		filter["revision"] = bson.M{"$lt": before}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "revision", Value: -1}}).SetLimit(limit)
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error finding user changes: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	changes := []model.UserChange{}
+	if err := cursor.All(ctx, &changes); err != nil {
+		return nil, fmt.Errorf("error decoding user changes: %w", err)
+	}
+	return changes, nil
+}
+
+// FindRevision returns one revision of the user's history, or mongo.ErrNoDocuments
+func (r *UserHistoryRepository) FindRevision(ctx context.Context, userID primitive.ObjectID, revision int64) (*model.UserChange, error) {
+	var change model.UserChange
+	err := r.collection.FindOne(ctx, bson.M{"user_id": userID, "revision": revision}).Decode(&change)
+	if err != nil {
+		return nil, err
+	}
+	return &change, nil
+}
+
+// DeleteChanges removes the user's whole history
+func (r *UserHistoryRepository) DeleteChanges(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	result, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return 0, fmt.Errorf("error deleting user history: %w", err)
+	}
+	return result.DeletedCount, nil
+}
+
+// DeleteOrphanedChanges removes the history of users that no longer exist and returns how many entries went
+func (r *UserHistoryRepository) DeleteOrphanedChanges(ctx context.Context) (int64, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": "$user_id"}}},
+		{{Key: "$lookup", Value: bson.M{"from": "users", "localField": "_id", "foreignField": "_id", "as": "user"}}},
+		{{Key: "$match", Value: bson.M{"user": bson.M{"$size": 0}}}},
+		{{Key: "$project", Value: bson.M{"_id": 1}}},
+	}
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, fmt.Errorf("error finding orphaned user history: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var orphans []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &orphans); err != nil {
+		return 0, fmt.Errorf("error decoding orphaned user history: %w", err)
+	}
+	if len(orphans) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]primitive.ObjectID, len(orphans))
+	for i, o := range orphans {
+		ids[i] = o.ID
+	}
+	result, err := r.collection.DeleteMany(ctx, bson.M{"user_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, fmt.Errorf("error deleting orphaned user history: %w", err)
+	}
+	return result.DeletedCount, nil
+}
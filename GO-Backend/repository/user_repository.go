@@ -5,10 +5,14 @@ import (
 	"context"
 	"fmt"
 	model "go-fiber-app/models"
+	"regexp"
+	"strings"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type UserRepository struct {
@@ -20,11 +24,10 @@ func NewUserRepository(db *mongo.Database) *UserRepository {
 }
 
 func (r *UserRepository) CreateUser(ctx context.Context, user *model.User) error {
-	fmt.Printf("Repository: About to save user to database: %+v\n", user)
 	result, err := r.collection.InsertOne(ctx, user)
 	if err != nil {
 		fmt.Printf("Repository: Error saving user: %v\n", err)
-		return err
+		return duplicateKeyError(err)
 	}
 	user.ID = result.InsertedID.(primitive.ObjectID)
 	fmt.Printf("Repository: User saved successfully with ID: %v\n", user.ID)
@@ -33,35 +36,201 @@ func (r *UserRepository) CreateUser(ctx context.Context, user *model.User) error
 
 func (r *UserRepository) FindUserByID(ctx context.Context, id primitive.ObjectID) (*model.User, error) {
 	var user model.User
-	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&user)
+	err := r.collection.FindOne(ctx, live(bson.M{"_id": id})).Decode(&user)
 	if err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
+// FindUserByIDIncludingDeleted finds the user whether or not it was soft-deleted
+func (r *UserRepository) FindUserByIDIncludingDeleted(ctx context.Context, id primitive.ObjectID) (*model.User, error) {
+	var user model.User
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// IsTaken reports whether any user, deleted or not, has the value in a unique field
+// ("email" or "nic_normalized"), compared the way the unique indexes compare it
+func (r *UserRepository) IsTaken(ctx context.Context, field, value string) (bool, error) {
+	opts := options.Count().SetCollation(caseInsensitive).SetLimit(1)
+	count, err := r.collection.CountDocuments(ctx, bson.M{field: strings.TrimSpace(value)}, opts)
+	if err != nil {
+		return false, fmt.Errorf("error checking %s: %w", field, err)
+	}
+	return count > 0, nil
+}
+
 func (r *UserRepository) FindUserByEmail(ctx context.Context, email string) (*model.User, error) {
 	var user model.User
-	err := r.collection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	// Emails are unique regardless of case, so look them up the same way
+	opts := options.FindOne().SetCollation(caseInsensitive)
+	err := r.collection.FindOne(ctx, live(bson.M{"email": strings.TrimSpace(email)}), opts).Decode(&user)
 	if err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
+// UpdateUser writes the user's profile fields and email verification state, as long as
+// the stored user is still at user.Version. Passwords, roles, two-factor settings and
+// anything else are left alone; they have their own methods.
 func (r *UserRepository) UpdateUser(ctx context.Context, user *model.User) error {
-	_, err := r.collection.ReplaceOne(ctx, bson.M{"_id": user.ID}, user)
-	return err
+	set := bson.M{
+		"name":           user.Name,
+		"email":          user.Email,
+		"nic":            user.NIC,
+		"nic_normalized": user.NICNormalized,
+		"address":        user.Address,
+		"birthday":       user.Birthday,
+		"gender":         user.Gender,
+		"photo":          user.Photo,
+		"email_verified": user.EmailVerified,
+	}
+	var unset []string
+	if user.EmailVerifiedAt != nil {
+		set["email_verified_at"] = *user.EmailVerifiedAt
+	} else {
+		unset = append(unset, "email_verified_at")
+	}
+	if len(user.NICWarnings) > 0 {
+		set["nic_warnings"] = user.NICWarnings
+	} else {
+		unset = append(unset, "nic_warnings")
+	}
+	return r.UpdateUserFields(ctx, user.ID, user.Version, set, unset)
+}
+
+// UpdateUserFields sets and unsets the given fields, touching nothing else. It fails
+// with ErrVersionConflict unless the user is still at the given version.
+func (r *UserRepository) UpdateUserFields(ctx context.Context, id primitive.ObjectID, version int64, set bson.M, unset []string) error {
+	update := bson.M{}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(unset) > 0 {
+		fields := bson.M{}
+		for _, field := range unset {
+			fields[field] = ""
+		}
+		update["$unset"] = fields
+	}
+	if len(update) == 0 {
+		return nil
+	}
+
+	result, err := r.collection.UpdateOne(ctx, live(bson.M{"_id": id, "version": versionIs(version)}), bumpVersion(update))
+	if err != nil {
+		return duplicateKeyError(err)
+	}
+	if result.MatchedCount == 0 {
+		return r.missOrConflict(ctx, id)
+	}
+	return nil
+}
+
+// missOrConflict explains why a conditional write matched nothing: the user is gone, or at another version
+func (r *UserRepository) missOrConflict(ctx context.Context, id primitive.ObjectID) error {
+	count, err := r.collection.CountDocuments(ctx, live(bson.M{"_id": id}))
+	if err != nil {
+		return fmt.Errorf("error finding user: %w", err)
+	}
+	if count == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return ErrVersionConflict
+}
+
+// DeleteUser permanently removes the user, whether or not it was soft-deleted
+// first, and returns the removed document. It fails with ErrVersionConflict
+// unless the user is still at the given version.
+func (r *UserRepository) DeleteUser(ctx context.Context, id primitive.ObjectID, version int64) (*model.User, error) {
+	var user model.User
+	if err := r.collection.FindOneAndDelete(ctx, bson.M{"_id": id, "version": versionIs(version)}).Decode(&user); err != nil {
+		if err != mongo.ErrNoDocuments {
+			return nil, fmt.Errorf("error deleting user: %w", err)
+		}
+		count, err := r.collection.CountDocuments(ctx, bson.M{"_id": id})
+		if err != nil {
+			return nil, fmt.Errorf("error finding user: %w", err)
+		}
+		if count == 0 {
+			return nil, mongo.ErrNoDocuments
+		}
+		return nil, ErrVersionConflict
+	}
+	return &user, nil
+}
+
+// SoftDeleteUser marks the user as deleted by actor, hiding it from every other read.
+// It fails with ErrVersionConflict unless the user is still at the given version.
+func (r *UserRepository) SoftDeleteUser(ctx context.Context, id, actor primitive.ObjectID, at time.Time, version int64) error {
+	update := bson.M{"$set": bson.M{"deleted_at": at, "deleted_by": actor}}
+	result, err := r.collection.UpdateOne(ctx, live(bson.M{"_id": id, "version": versionIs(version)}), bumpVersion(update))
+	if err != nil {
+		return fmt.Errorf("error deleting user: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return r.missOrConflict(ctx, id)
+	}
+	return nil
+}
+
+// RestoreUser brings back a soft-deleted user
+func (r *UserRepository) RestoreUser(ctx context.Context, id primitive.ObjectID) error {
+	filter := bson.M{"_id": id, "deleted_at": bson.M{"$exists": true}}
+	update := bson.M{"$unset": bson.M{"deleted_at": "", "deleted_by": ""}}
+	result, err := r.collection.UpdateOne(ctx, filter, bumpVersion(update))
+	if err != nil {
+		return fmt.Errorf("error restoring user: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// FindUsersDeletedBefore returns the soft-deleted users deleted before the cutoff
+func (r *UserRepository) FindUsersDeletedBefore(ctx context.Context, cutoff time.Time) ([]*model.User, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"deleted_at": bson.M{"$lt": cutoff}})
+	if err != nil {
+		return nil, fmt.Errorf("error finding deleted users: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var users []*model.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, fmt.Errorf("error decoding users: %w", err)
+	}
+	return users, nil
+}
+
+// FindPhotos returns the photo of every user, deleted or not
+func (r *UserRepository) FindPhotos(ctx context.Context) ([]string, error) {
+	values, err := r.collection.Distinct(ctx, "photo", bson.M{"photo": bson.M{"$gt": ""}})
+	if err != nil {
+		return nil, fmt.Errorf("error finding photos: %w", err)
+	}
+	photos := make([]string, 0, len(values))
+	for _, v := range values {
+		if photo, ok := v.(string); ok {
+			photos = append(photos, photo)
+		}
+	}
+	return photos, nil
 }
 
-func (r *UserRepository) DeleteUser(ctx context.Context, id primitive.ObjectID) error {
-	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
-	return err
+// live restricts a filter to users that have not been soft-deleted
+func live(filter bson.M) bson.M {
+	filter["deleted_at"] = bson.M{"$exists": false}
+	return filter
 }
 
 func (r *UserRepository) GetAllUsers(ctx context.Context) ([]*model.User, error) {
 	var users []*model.User
-	cursor, err := r.collection.Find(ctx, bson.M{})
+	cursor, err := r.collection.Find(ctx, live(bson.M{}))
 	if err != nil {
 		return nil, err
 	}
@@ -76,3 +245,383 @@ func (r *UserRepository) GetAllUsers(ctx context.Context) ([]*model.User, error)
 	}
 	return users, nil
 }
+
+func (r *UserRepository) AddRole(ctx context.Context, id primitive.ObjectID, role string) error {
+	result, err := r.collection.UpdateOne(ctx, live(bson.M{"_id": id}), bumpVersion(bson.M{"$addToSet": bson.M{"roles": role}}))
+	if err != nil {
+		return fmt.Errorf("error adding role: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *UserRepository) RemoveRole(ctx context.Context, id primitive.ObjectID, role string) error {
+	result, err := r.collection.UpdateOne(ctx, live(bson.M{"_id": id}), bumpVersion(bson.M{"$pull": bson.M{"roles": role}}))
+	if err != nil {
+		return fmt.Errorf("error removing role: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *UserRepository) CountUsersWithRole(ctx context.Context, role string) (int64, error) {
+	return r.collection.CountDocuments(ctx, live(bson.M{"roles": role}))
+}
+
+// SetLockedUntil locks the account until the given time, or unlocks it when until is nil
+func (r *UserRepository) SetLockedUntil(ctx context.Context, id primitive.ObjectID, until *time.Time) error {
+	update := bson.M{"$unset": bson.M{"locked_until": ""}}
+	if until != nil {
+		update = bson.M{"$set": bson.M{"locked_until": *until}}
+	}
+	result, err := r.collection.UpdateOne(ctx, live(bson.M{"_id": id}), bumpVersion(update))
+	if err != nil {
+		return fmt.Errorf("error updating account lock: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// UpdatePassword sets a new password hash and moves the old one to the front of
+// the password history, keeping at most historySize previous hashes
+func (r *UserRepository) UpdatePassword(ctx context.Context, id primitive.ObjectID, version int64, hashedPassword string, historySize int) error {
+	history := bson.M{"$slice": bson.A{
+		bson.M{"$concatArrays": bson.A{bson.A{"$password"}, bson.M{"$ifNull": bson.A{"$password_history", bson.A{}}}}},
+		historySize,
+	}}
+	if historySize <= 0 {
+		history = bson.M{"$literal": bson.A{}}
+	}
+	// A pipeline update cannot use $inc, so the version is bumped in the $set
+	update := bson.A{bson.M{"$set": bson.M{
+		"password":         hashedPassword,
+		"password_history": history,
+		"version":          bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$version", 0}}, 1}},
+	}}}
+
+	result, err := r.collection.UpdateOne(ctx, live(bson.M{"_id": id, "version": versionIs(version)}), update)
+	if err != nil {
+		return fmt.Errorf("error updating password: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return r.missOrConflict(ctx, id)
+	}
+	return nil
+}
+
+// ReplacePasswordHash swaps the hash of an unchanged password for a stronger one.
+// It does nothing if the password was changed in the meantime.
+func (r *UserRepository) ReplacePasswordHash(ctx context.Context, id primitive.ObjectID, oldHash, newHash string) error {
+	filter := live(bson.M{"_id": id, "password": oldHash})
+	if _, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"password": newHash}}); err != nil {
+		return fmt.Errorf("error upgrading password hash: %w", err)
+	}
+	return nil
+}
+
+func (r *UserRepository) MarkEmailVerified(ctx context.Context, id primitive.ObjectID, email string) error {
+	// Match the email too so a link sent to an old address cannot verify a new one
+	filter := live(bson.M{"_id": id, "email": email})
+	update := bson.M{"$set": bson.M{"email_verified": true, "email_verified_at": time.Now()}}
+	result, err := r.collection.UpdateOne(ctx, filter, bumpVersion(update))
+	if err != nil {
+		return fmt.Errorf("error verifying email: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// MarkLegacyUsersVerified treats accounts created before email verification existed as verified
+func (r *UserRepository) MarkLegacyUsersVerified(ctx context.Context) (int64, error) {
+	filter := bson.M{"email_verified": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"email_verified": true}}
+	result, err := r.collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, fmt.Errorf("error migrating legacy users: %w", err)
+	}
+	return result.ModifiedCount, nil
+}
+
+// NormalizeLegacyNICs stores the normalized form of the NIC for users, deleted or not,
+// saved before it was kept, so the unique index covers them too. NICs normalize
+// rejects are left alone. It returns how many users were updated.
+func (r *UserRepository) NormalizeLegacyNICs(ctx context.Context, normalize func(string) (string, error)) (int64, error) {
+	filter := bson.M{"nic": bson.M{"$gt": ""}, "nic_normalized": bson.M{"$exists": false}}
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"nic": 1}))
+	if err != nil {
+		return 0, fmt.Errorf("error finding users to migrate: %w", err)
+	}
+	var users []model.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return 0, fmt.Errorf("error decoding users to migrate: %w", err)
+	}
+
+	var updated int64
+	for _, user := range users {
+		normalized, err := normalize(user.NIC)
+		if err != nil {
+			continue
+		}
+		// Derived from the NIC, so the version is left alone
+		if _, err := r.collection.UpdateByID(ctx, user.ID, bson.M{"$set": bson.M{"nic_normalized": normalized}}); err != nil {
+			return updated, fmt.Errorf("error normalizing NIC: %w", err)
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+func (r *UserRepository) SetTwoFactorPendingSecret(ctx context.Context, id primitive.ObjectID, secret string) error {
+	result, err := r.collection.UpdateOne(ctx, live(bson.M{"_id": id}), bson.M{"$set": bson.M{"two_factor_pending_secret": secret}})
+	if err != nil {
+		return fmt.Errorf("error saving two-factor secret: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *UserRepository) EnableTwoFactor(ctx context.Context, id primitive.ObjectID, secret string, backupCodeHashes []string, lastStep int64) error {
+	update := bson.M{
+		"$set": bson.M{
+			"two_factor_enabled":      true,
+			"two_factor_secret":       secret,
+			"two_factor_backup_codes": backupCodeHashes,
+			"two_factor_last_step":    lastStep,
+		},
+		"$unset": bson.M{"two_factor_pending_secret": ""},
+	}
+	result, err := r.collection.UpdateOne(ctx, live(bson.M{"_id": id}), bumpVersion(update))
+	if err != nil {
+		return fmt.Errorf("error enabling two-factor authentication: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *UserRepository) DisableTwoFactor(ctx context.Context, id primitive.ObjectID) error {
+	update := bson.M{
+		"$set": bson.M{"two_factor_enabled": false},
+		"$unset": bson.M{
+			"two_factor_secret":         "",
+			"two_factor_pending_secret": "",
+			"two_factor_backup_codes":   "",
+			"two_factor_last_step":      "",
+		},
+	}
+	result, err := r.collection.UpdateOne(ctx, live(bson.M{"_id": id}), bumpVersion(update))
+	if err != nil {
+		return fmt.Errorf("error disabling two-factor authentication: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// AdvanceTwoFactorStep records the time step of an accepted code. It returns false
+// if that step (or a later one) was already used, which means the code is being replayed.
+func (r *UserRepository) AdvanceTwoFactorStep(ctx context.Context, id primitive.ObjectID, step int64) (bool, error) {
+	filter := live(bson.M{
+		"_id": id,
+		"$or": bson.A{
+			bson.M{"two_factor_last_step": bson.M{"$exists": false}},
+			bson.M{"two_factor_last_step": bson.M{"$lt": step}},
+		},
+	})
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"two_factor_last_step": step}})
+	if err != nil {
+		return false, fmt.Errorf("error recording two-factor step: %w", err)
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// ConsumeBackupCode removes a backup code hash. It returns false if it was already used.
+func (r *UserRepository) ConsumeBackupCode(ctx context.Context, id primitive.ObjectID, codeHash string) (bool, error) {
+	filter := live(bson.M{"_id": id, "two_factor_backup_codes": codeHash})
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{"$pull": bson.M{"two_factor_backup_codes": codeHash}})
+	if err != nil {
+		return false, fmt.Errorf("error consuming backup code: %w", err)
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// FindUserByIdentity finds the user linked to an OpenID Connect account
+func (r *UserRepository) FindUserByIdentity(ctx context.Context, issuer, subject string) (*model.User, error) {
+	var user model.User
+	filter := live(bson.M{"identities": bson.M{"$elemMatch": bson.M{"issuer": issuer, "subject": subject}}})
+	if err := r.collection.FindOne(ctx, filter).Decode(&user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// AddIdentity links an OpenID Connect account to the user
+func (r *UserRepository) AddIdentity(ctx context.Context, id primitive.ObjectID, identity model.ExternalIdentity) error {
+	update := bson.M{"$push": bson.M{"identities": identity}}
+	result, err := r.collection.UpdateOne(ctx, live(bson.M{"_id": id}), bumpVersion(update))
+	if err != nil {
+		return fmt.Errorf("error linking identity: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// SetDeletionScheduledAt schedules the account for deletion, or cancels it when at is nil.
+// It fails with ErrVersionConflict unless the user is still at the given version.
+func (r *UserRepository) SetDeletionScheduledAt(ctx context.Context, id primitive.ObjectID, version int64, at *time.Time) error {
+	update := bson.M{"$unset": bson.M{"deletion_scheduled_at": ""}}
+	if at != nil {
+		update = bson.M{"$set": bson.M{"deletion_scheduled_at": *at}}
+	}
+	result, err := r.collection.UpdateOne(ctx, live(bson.M{"_id": id, "version": versionIs(version)}), bumpVersion(update))
+	if err != nil {
+		return fmt.Errorf("error scheduling account deletion: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		return r.missOrConflict(ctx, id)
+	}
+	return nil
+}
+
+// FindUsersDueForDeletion returns the users whose deletion grace period has ended
+func (r *UserRepository) FindUsersDueForDeletion(ctx context.Context, now time.Time) ([]*model.User, error) {
+	cursor, err := r.collection.Find(ctx, live(bson.M{"deletion_scheduled_at": bson.M{"$lte": now}}))
+	if err != nil {
+		return nil, fmt.Errorf("error finding users due for deletion: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var users []*model.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, fmt.Errorf("error decoding users: %w", err)
+	}
+	return users, nil
+}
+
+// UserListQuery selects one page of users. Results are ordered by SortField and
+// then _id, and After continues from the last user of the previous page.
+type UserListQuery struct {
+	SortField    string // a bson field name, or "_id"
+	Descending   bool
+	Limit        int64
+	Gender       string
+	BirthdayFrom time.Time // inclusive
+	BirthdayTo   time.Time // inclusive
+	EmailDomain  string
+	NICFlagged   bool // only users whose NIC contradicts their birthday or gender
+	Deleted      bool // list soft-deleted users instead of live ones
+	After        *UserListPosition
+}
+
+// UserListPosition is where a page ended: the sort value and _id of its last user
+type UserListPosition struct {
+	Value interface{}
+	ID    primitive.ObjectID
+}
+
+// ListUsers returns up to Limit users matching the query
+func (r *UserRepository) ListUsers(ctx context.Context, q UserListQuery) ([]*model.User, error) {
+	filter := userListFilter(q)
+	if q.After != nil {
+		op := "$gt"
+		if q.Descending {
+			op = "$lt"
+		}
+		var after bson.M
+		if q.SortField == "_id" {
+			after = bson.M{"_id": bson.M{op: q.After.ID}}
+		} else {
+			after = bson.M{"$or": bson.A{
+				bson.M{q.SortField: bson.M{op: q.After.Value}},
+				bson.M{q.SortField: q.After.Value, "_id": bson.M{op: q.After.ID}},
+			}}
+		}
+		filter = bson.M{"$and": bson.A{filter, after}}
+	}
+
+	direction := 1
+	if q.Descending {
+		direction = -1
+	}
+	sort := bson.D{{Key: q.SortField, Value: direction}}
+	if q.SortField != "_id" {
+		sort = append(sort, bson.E{Key: "_id", Value: direction})
+	}
+
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetSort(sort).SetLimit(q.Limit))
+	if err != nil {
+		return nil, fmt.Errorf("error listing users: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	users := []*model.User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, fmt.Errorf("error decoding users: %w", err)
+	}
+	return users, nil
+}
+
+// CountUsers counts the users matching the query's filters, ignoring paging
+func (r *UserRepository) CountUsers(ctx context.Context, q UserListQuery) (int64, error) {
+	count, err := r.collection.CountDocuments(ctx, userListFilter(q))
+	if err != nil {
+		return 0, fmt.Errorf("error counting users: %w", err)
+	}
+	return count, nil
+}
+
+func userListFilter(q UserListQuery) bson.M {
+	filter := live(bson.M{})
+	if q.Deleted {
+		filter["deleted_at"] = bson.M{"$exists": true}
+	}
+	if q.Gender != "" {
+		filter["gender"] = primitive.Regex{Pattern: "^" + regexp.QuoteMeta(q.Gender) + "$", Options: "i"}
+	}
+	if q.EmailDomain != "" {
+		filter["email"] = primitive.Regex{Pattern: "@" + regexp.QuoteMeta(q.EmailDomain) + "$", Options: "i"}
+	}
+	if q.NICFlagged {
+		filter["nic_warnings.0"] = bson.M{"$exists": true}
+	}
+	birthday := bson.M{}
+	if !q.BirthdayFrom.IsZero() {
+		birthday["$gte"] = q.BirthdayFrom
+	}
+	if !q.BirthdayTo.IsZero() {
+		birthday["$lte"] = q.BirthdayTo
+	}
+	if len(birthday) > 0 {
+		filter["birthday"] = birthday
+	}
+	return filter
+}
+
+// FindUsersByIDs returns the users with the given IDs, in no particular order
+func (r *UserRepository) FindUsersByIDs(ctx context.Context, ids []primitive.ObjectID) ([]*model.User, error) {
+	cursor, err := r.collection.Find(ctx, live(bson.M{"_id": bson.M{"$in": ids}}))
+	if err != nil {
+		return nil, fmt.Errorf("error finding users: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	users := []*model.User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, fmt.Errorf("error decoding users: %w", err)
+	}
+	return users, nil
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	model "go-fiber-app/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestUserRepositoryNormalizeLegacyNICs(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	valid := model.User{ID: primitive.NewObjectID(), NIC: "853400937V"}
+	invalid := model.User{ID: primitive.NewObjectID(), NIC: "12345"}
+
+	mt.Run("stores the normalized NIC where it parses", func(mt *mtest.T) {
+		repo := NewUserRepository(mt.DB)
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "test.users", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: valid.ID}, {Key: "nic", Value: valid.NIC}},
+				bson.D{{Key: "_id", Value: invalid.ID}, {Key: "nic", Value: invalid.NIC}},
+			),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+		)
+		normalize := func(nic string) (string, error) {
+			if nic != valid.NIC {
+				return "", errors.New("invalid NIC")
+			}
+			return "198534000937", nil
+		}
+
+		updated, err := repo.NormalizeLegacyNICs(mt.Context(), normalize)
+		if err != nil {
+			mt.Fatalf("NormalizeLegacyNICs() error = %v", err)
+		}
+		if updated != 1 {
+			mt.Errorf("NormalizeLegacyNICs() updated %d users, want 1", updated)
+		}
+		mt.GetStartedEvent() // find
+		update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+		if id := update.Lookup("q", "_id").ObjectID(); id != valid.ID {
+			mt.Errorf("updated user %s, want %s", id.Hex(), valid.ID.Hex())
+		}
+		if got := update.Lookup("u", "$set", "nic_normalized").StringValue(); got != "198534000937" {
+			mt.Errorf("nic_normalized = %q, want 198534000937", got)
+		}
+		if _, err := update.LookupErr("u", "$inc"); err == nil {
+			mt.Errorf("update bumps the version: %s", update)
+		}
+	})
+}
@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ErrVersionConflict is returned by a conditional write when the document
+// was changed since the version the caller expected
+var ErrVersionConflict = errors.New("the record was changed since it was read")
+
+// versionIs matches documents at the given version. Documents written before
+// versions existed have no version field and count as version 0.
+func versionIs(version int64) interface{} {
+	if version == 0 {
+		return bson.M{"$in": bson.A{0, nil}}
+	}
+	return version
+}
+
+// bumpVersion adds a version increment to an update
+func bumpVersion(update bson.M) bson.M {
+	update["$inc"] = bson.M{"version": 1}
+	return update
+}
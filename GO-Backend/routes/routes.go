@@ -2,37 +2,123 @@ package routes
 
 import (
 	"go-fiber-app/handler"
+	"go-fiber-app/middleware"
+	model "go-fiber-app/models"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func RegisterRoutes(app *fiber.App, userHandler *handler.UserHandler, phoneHandler *handler.PhoneHandler, authHandler *handler.AuthHandler) {
-	api := app.Group("/api") // Group everything under /api
+// Handlers groups every HTTP handler the routes are registered against
+type Handlers struct {
+	User          *handler.UserHandler
+	Phone         *handler.PhoneHandler
+	Auth          *handler.AuthHandler
+	Role          *handler.RoleHandler
+	PasswordReset *handler.PasswordResetHandler
+	Verification  *handler.EmailVerificationHandler
+	TwoFactor     *handler.TwoFactorHandler
+	JWKS          *handler.JWKSHandler
+	APIKey        *handler.APIKeyHandler
+	Session       *handler.SessionHandler
+	SecurityEvent *handler.SecurityEventHandler
+	UserImport    *handler.UserImportHandler
+}
+
+// Middleware groups the shared middleware that depends on services built in main
+type Middleware struct {
+	AuthRequired      fiber.Handler // valid access token
+	TwoFactorEnrolled fiber.Handler // 2FA set up when the caller's role requires it
+	Ownership         fiber.Handler // caller owns the :id user or is an admin
+	RecordDenials     fiber.Handler // logs 403 responses as security events
+	ResetRequestLimit fiber.Handler // limits password reset requests per client IP
+}
+
+func RegisterRoutes(app *fiber.App, h Handlers, m Middleware) {
+	app.Get("/.well-known/jwks.json", h.JWKS.GetJWKS)
+
+	api := app.Group("/api", m.RecordDenials) // Group everything under /api
 
 	// === Public Routes ===
-	api.Post("/auth/login", authHandler.Login)
-	api.Post("/auth/register", userHandler.CreateUser) // Allow public registration
-	api.Get("/users/list", userHandler.GetAllUsers)    // Temporary: List users for debugging
+	api.Post("/auth/login", h.Auth.Login)
+	api.Post("/auth/refresh", h.Auth.Refresh)
+	api.Post("/auth/logout", h.Auth.Logout)
+	api.Post("/auth/register", h.User.CreateUser) // Allow public registration
+	api.Post("/auth/forgot-password", m.ResetRequestLimit, h.PasswordReset.ForgotPassword)
+	api.Post("/auth/reset-password", h.PasswordReset.ResetPassword)
+	api.Get("/auth/verify-email", h.Verification.VerifyEmail)
+	api.Post("/auth/resend-verification", h.Verification.ResendVerification)
+	api.Post("/auth/2fa/verify", h.TwoFactor.Verify)
+	api.Get("/auth/oidc/login", h.Auth.OIDCLogin)
+	api.Get("/auth/oidc/callback", h.Auth.OIDCCallback)
+
+	// === Two-factor management ===
+	twoFactor := api.Group("/auth/2fa", m.AuthRequired, middleware.DenyAPIKeys())
+	twoFactor.Post("/enroll", h.TwoFactor.Enroll)
+	twoFactor.Post("/enroll/confirm", h.TwoFactor.ConfirmEnrollment)
+	twoFactor.Post("/disable", h.TwoFactor.Disable)
+	twoFactor.Get("/policy", middleware.RequirePermission(model.PermSecurityManage), h.TwoFactor.GetPolicy)
+	twoFactor.Put("/policy", middleware.RequirePermission(model.PermSecurityManage), h.TwoFactor.UpdatePolicy)
+
+	// === Sessions ===
+	sessions := api.Group("/auth/sessions", m.AuthRequired, middleware.DenyAPIKeys())
+	sessions.Get("/", h.Session.ListSessions)
+	sessions.Delete("/", h.Session.RevokeAllSessions)
+	sessions.Delete("/:id", h.Session.RevokeSession)
+
+	// === Current user ===
+	me := api.Group("/auth/me", m.AuthRequired)
+	meVerified := middleware.RequireVerifiedEmail()
+	me.Get("/", middleware.RequirePermission(model.PermUsersRead), h.User.GetMe)
+	me.Patch("/", middleware.RequirePermission(model.PermUsersUpdate), m.TwoFactorEnrolled, meVerified, h.User.UpdateMe)
+	me.Put("/password", middleware.DenyAPIKeys(), m.TwoFactorEnrolled, meVerified, h.User.ChangeMyPassword)
+	me.Put("/photo", middleware.RequirePermission(model.PermUsersUpdate), m.TwoFactorEnrolled, meVerified, h.User.ChangeMyPhoto)
+	me.Delete("/", middleware.DenyAPIKeys(), m.TwoFactorEnrolled, h.User.DeleteMe)
+	me.Delete("/deletion", middleware.DenyAPIKeys(), h.User.CancelMyDeletion)
+
+	// === Security events (admin only) ===
+	api.Get("/security/events", m.AuthRequired, m.TwoFactorEnrolled, middleware.RequirePermission(model.PermSecurityManage), h.SecurityEvent.ListSecurityEvents)
 
 	// === Protected Routes ===
-	userGroup := api.Group("/users")
+	userGroup := api.Group("/users", m.AuthRequired, m.TwoFactorEnrolled)
+	owner := m.Ownership                          // members may only touch their own records
+	verified := middleware.RequireVerifiedEmail() // unverified accounts are read-only
 
 	// User routes
-	userGroup.Get("/", userHandler.GetAllUsers)
-	userGroup.Get("/with-phones", userHandler.GetAllUsersWithPhones)
-	userGroup.Post("/", userHandler.CreateUser)
-	userGroup.Get("/:id", userHandler.GetUser)
-	userGroup.Get("/:id/details", userHandler.GetUser)
-	userGroup.Put("/:id", userHandler.UpdateUser)
-	userGroup.Put("/:id/password", userHandler.UpdateUserPassword)
-	userGroup.Delete("/:id", userHandler.DeleteUser)
-	userGroup.Get("/:id/with-phones", userHandler.GetUserWithPhones)
+	userGroup.Get("/", middleware.RequirePermission(model.PermUsersList), h.User.GetAllUsers)
+	userGroup.Get("/with-phones", middleware.RequirePermission(model.PermUsersList), h.User.GetAllUsersWithPhones)
+	userGroup.Get("/search", middleware.RequirePermission(model.PermUsersList), h.User.SearchUsers)
+	userGroup.Get("/deleted", middleware.RequirePermission(model.PermUsersRestore), h.User.GetDeletedUsers)
+	userGroup.Post("/", middleware.RequirePermission(model.PermUsersCreate), verified, h.User.CreateUser)
+	userGroup.Post("/import", middleware.RequirePermission(model.PermUsersCreate), verified, h.UserImport.ImportUsers)
+	userGroup.Get("/import/:jobId", middleware.RequirePermission(model.PermUsersCreate), h.UserImport.GetImportJob)
+	userGroup.Get("/:id", middleware.RequirePermission(model.PermUsersRead), owner, h.User.GetUser)
+	userGroup.Get("/:id/details", middleware.RequirePermission(model.PermUsersRead), owner, h.User.GetUser)
+	userGroup.Put("/:id", middleware.RequirePermission(model.PermUsersUpdate), owner, verified, h.User.UpdateUser)
+	userGroup.Patch("/:id", middleware.RequirePermission(model.PermUsersUpdate), owner, verified, h.User.PatchUser)
+	userGroup.Put("/:id/password", middleware.RequirePermission(model.PermUsersUpdate), owner, verified, h.User.UpdateUserPassword)
+	userGroup.Delete("/:id", middleware.RequirePermission(model.PermUsersDelete), owner, verified, h.User.DeleteUser)
+	userGroup.Delete("/:id/permanent", middleware.RequirePermission(model.PermUsersPurge), h.User.PurgeUser)
+	userGroup.Post("/:id/restore", middleware.RequirePermission(model.PermUsersRestore), h.User.RestoreUser)
+	userGroup.Get("/:id/with-phones", middleware.RequirePermission(model.PermUsersRead), owner, h.User.GetUserWithPhones)
+	userGroup.Get("/:id/history", middleware.RequirePermission(model.PermUsersHistory), h.User.GetUserHistory)
+	userGroup.Post("/:id/history/:revision/revert", middleware.RequirePermission(model.PermUsersRevert), h.User.RevertUser)
+
+	// Role management (admin only)
+	userGroup.Post("/:id/roles", middleware.RequirePermission(model.PermRolesManage), h.Role.AssignRole)
+	userGroup.Delete("/:id/roles/:role", middleware.RequirePermission(model.PermRolesManage), h.Role.RevokeRole)
+	api.Get("/roles", m.AuthRequired, m.TwoFactorEnrolled, middleware.RequirePermission(model.PermRolesManage), h.Role.ListRoles)
+	userGroup.Post("/:id/unlock", middleware.RequirePermission(model.PermUsersUnlock), h.Auth.UnlockAccount)
+
+	// API keys
+	userGroup.Get("/:id/api-keys", middleware.RequirePermission(model.PermAPIKeysManage), owner, h.APIKey.ListAPIKeys)
+	userGroup.Post("/:id/api-keys", middleware.RequirePermission(model.PermAPIKeysManage), owner, verified, h.APIKey.CreateAPIKey)
+	userGroup.Delete("/:id/api-keys/:keyId", middleware.RequirePermission(model.PermAPIKeysManage), owner, h.APIKey.RevokeAPIKey)
 
 	// Phone routes
-	userGroup.Get("/:id/phones", phoneHandler.GetPhonesByUser)
-	userGroup.Post("/:id/phones", phoneHandler.CreatePhone)
-	userGroup.Put("/:id/phones/:phoneId", phoneHandler.UpdatePhone)
-	userGroup.Delete("/:id/phones/:phoneId", phoneHandler.DeletePhone)
+	userGroup.Get("/:id/phones", middleware.RequirePermission(model.PermPhonesRead), owner, h.Phone.GetPhonesByUser)
+	userGroup.Post("/:id/phones", middleware.RequirePermission(model.PermPhonesWrite), owner, verified, h.Phone.CreatePhone)
+	userGroup.Put("/:id/phones/:phoneId", middleware.RequirePermission(model.PermPhonesWrite), owner, verified, h.Phone.UpdatePhone)
+	userGroup.Delete("/:id/phones/:phoneId", middleware.RequirePermission(model.PermPhonesWrite), owner, verified, h.Phone.DeletePhone)
 
 	// Test route for file upload debugging
 	api.Post("/test-upload", func(c *fiber.Ctx) error {
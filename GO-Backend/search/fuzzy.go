@@ -0,0 +1,55 @@
+package search
+
+import (
+	"html"
+	"sort"
+	"strings"
+)
+
+// editDistance is the Damerau-Levenshtein distance (optimal string alignment),
+// so a swapped pair of letters counts as one typo
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				curr[j] = min(curr[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+	return prev[len(rb)]
+}
+
+// highlight HTML-escapes the text and wraps the given words in <mark> tags
+func highlight(text string, tokens []token) string {
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].start < tokens[j].start })
+
+	var b strings.Builder
+	pos := 0
+	for _, t := range tokens {
+		if t.start < pos {
+			continue // the same word matched two query terms
+		}
+		b.WriteString(html.EscapeString(text[pos:t.start]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(text[t.start:t.end]))
+		b.WriteString("</mark>")
+		pos = t.end
+	}
+	b.WriteString(html.EscapeString(text[pos:]))
+	return b.String()
+}
@@ -0,0 +1,277 @@
+// Package search is an in-process n-gram index for finding records by partial,
+// prefix or slightly misspelled words.
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Document is one indexed record: named text fields under an ID
+type Document struct {
+	ID     string
+	Fields map[string]string
+}
+
+// Result is a matching document, its score and its fields with the matches highlighted
+type Result struct {
+	ID         string            `json:"id"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+// Index finds documents whose fields contain every word of a query, allowing
+// prefixes and small typos. It is safe for concurrent use.
+type Index struct {
+	weights map[string]float64 // how much a match in each field counts; unknown fields count 1
+
+	mu       sync.RWMutex
+	docs     map[string]*indexedDoc
+	postings map[string]map[string]struct{} // n-gram -> document IDs
+}
+
+type indexedDoc struct {
+	fields map[string]string
+	tokens map[string][]token
+	grams  map[string]struct{}
+}
+
+// token is a word of a field and where it sits in the original text
+type token struct {
+	text       string // lower case
+	start, end int    // byte offsets
+}
+
+func NewIndex(weights map[string]float64) *Index {
+	return &Index{weights: weights, docs: map[string]*indexedDoc{}, postings: map[string]map[string]struct{}{}}
+}
+
+// Put adds or replaces a document
+func (ix *Index) Put(doc Document) {
+	indexed := &indexedDoc{fields: doc.Fields, tokens: map[string][]token{}, grams: map[string]struct{}{}}
+	for field, text := range doc.Fields {
+		tokens := tokenize(text)
+		indexed.tokens[field] = tokens
+		for _, t := range tokens {
+			for _, g := range ngrams(t.text) {
+				indexed.grams[g] = struct{}{}
+			}
+		}
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.remove(doc.ID)
+	ix.docs[doc.ID] = indexed
+	for g := range indexed.grams {
+		if ix.postings[g] == nil {
+			ix.postings[g] = map[string]struct{}{}
+		}
+		ix.postings[g][doc.ID] = struct{}{}
+	}
+}
+
+// Delete removes a document if it is indexed
+func (ix *Index) Delete(id string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.remove(id)
+}
+
+// Replace swaps the whole index content for the given documents
+func (ix *Index) Replace(docs []Document) {
+	fresh := NewIndex(ix.weights)
+	for _, doc := range docs {
+		fresh.Put(doc)
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.docs = fresh.docs
+	ix.postings = fresh.postings
+}
+
+// Len returns the number of indexed documents
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.docs)
+}
+
+func (ix *Index) remove(id string) {
+	old, ok := ix.docs[id]
+	if !ok {
+		return
+	}
+	for g := range old.grams {
+		delete(ix.postings[g], id)
+		if len(ix.postings[g]) == 0 {
+			delete(ix.postings, g)
+		}
+	}
+	delete(ix.docs, id)
+}
+
+// Search returns up to limit documents matching every word of the query, best first
+func (ix *Index) Search(query string, limit int) []Result {
+	terms := tokenize(query)
+	if len(terms) == 0 || limit <= 0 {
+		return []Result{}
+	}
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	results := []Result{}
+	for id := range ix.candidates(terms) {
+		doc := ix.docs[id]
+		if result, ok := ix.score(doc, terms); ok {
+			result.ID = id
+			results = append(results, result)
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ID < results[j].ID
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// candidates returns the documents sharing at least one n-gram with every query term
+func (ix *Index) candidates(terms []token) map[string]struct{} {
+	var found map[string]struct{}
+	for _, term := range terms {
+		termDocs := map[string]struct{}{}
+		for _, g := range ngrams(term.text) {
+			for id := range ix.postings[g] {
+				termDocs[id] = struct{}{}
+			}
+		}
+		if found == nil {
+			found = termDocs
+			continue
+		}
+		for id := range found {
+			if _, ok := termDocs[id]; !ok {
+				delete(found, id)
+			}
+		}
+	}
+	return found
+}
+
+// score adds up the best match of each query term. Every term has to match somewhere.
+func (ix *Index) score(doc *indexedDoc, terms []token) (Result, bool) {
+	result := Result{Highlights: map[string]string{}}
+	marked := map[string][]token{}
+
+	for _, term := range terms {
+		best, bestField := 0.0, ""
+		var bestToken token
+		for field, tokens := range doc.tokens {
+			weight, ok := ix.weights[field]
+			if !ok {
+				weight = 1
+			}
+			for _, t := range tokens {
+				if s := matchScore(term.text, t.text) * weight; s > best {
+					best, bestField, bestToken = s, field, t
+				}
+			}
+		}
+		if best == 0 {
+			return Result{}, false
+		}
+		result.Score += best
+		marked[bestField] = append(marked[bestField], bestToken)
+	}
+
+	for field, tokens := range marked {
+		result.Highlights[field] = highlight(doc.fields[field], tokens)
+	}
+	result.Score = math.Round(result.Score*100) / 100
+	return result, true
+}
+
+// matchScore rates how well a query term matches a word: exactly, as a prefix,
+// within the word or with a small typo
+func matchScore(term, word string) float64 {
+	switch {
+	case term == word:
+		return 1
+	case strings.HasPrefix(word, term):
+		return 0.8
+	case len(term) >= 3 && strings.Contains(word, term):
+		return 0.5
+	}
+
+	// Allow one typo in short words and two in long ones, also against the
+	// start of a longer word so a misspelled prefix still matches
+	allowed := 1
+	if len([]rune(term)) >= 8 {
+		allowed = 2
+	}
+	if len([]rune(term)) < 4 {
+		return 0
+	}
+	distance := editDistance(term, word)
+	if prefix := runePrefix(word, len([]rune(term))); prefix != word {
+		if d := editDistance(term, prefix) + 1; d < distance {
+			distance = d
+		}
+	}
+	if distance > allowed {
+		return 0
+	}
+	return 0.6 - 0.15*float64(distance)
+}
+
+// tokenize splits text into lower-case words of letters and digits. Combining
+// marks stay part of the word they follow, as Sinhala and Tamil vowel signs do.
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		wordRune := unicode.IsLetter(r) || unicode.IsDigit(r) || (start >= 0 && unicode.IsMark(r))
+		if wordRune && start < 0 {
+			start = i
+		}
+		if !wordRune && start >= 0 {
+			tokens = append(tokens, token{text: strings.ToLower(text[start:i]), start: start, end: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{text: strings.ToLower(text[start:]), start: start, end: len(text)})
+	}
+	return tokens
+}
+
+// ngrams returns the two-letter pieces of a word padded with start and end
+// markers. Bigrams rather than trigrams keep a misspelled word sharing grams
+// with the word it was meant to be.
+func ngrams(word string) []string {
+	runes := []rune("^" + word + "$")
+	grams := make([]string, 0, len(runes)-1)
+	for i := 0; i+2 <= len(runes); i++ {
+		grams = append(grams, string(runes[i:i+2]))
+	}
+	return grams
+}
+
+func runePrefix(s string, n int) string {
+	runes := []rune(s)
+	if n >= len(runes) {
+		return s
+	}
+	return string(runes[:n])
+}
@@ -0,0 +1,191 @@
+package search
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []token
+	}{
+		{"empty", "", nil},
+		{"only separators", " -,. ", nil},
+		{"single word", "Nimal", []token{{"nimal", 0, 5}}},
+		{"email", "nimal.perera@example.com", []token{
+			{"nimal", 0, 5}, {"perera", 6, 12}, {"example", 13, 20}, {"com", 21, 24},
+		}},
+		{"digits and surrounding spaces", "  Flat 12B ", []token{{"flat", 2, 6}, {"12b", 7, 10}}},
+		{"non-ASCII letters keep byte offsets", "Zoë Ōta", []token{{"zoë", 0, 4}, {"ōta", 5, 9}}},
+		{"Sinhala script", "නිමල් පෙරේරා", []token{{"නිමල්", 0, 15}, {"පෙරේරා", 16, 34}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tokenize(tt.text)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("tokenize(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+			for _, tok := range got {
+				if strings.ToLower(tt.text[tok.start:tok.end]) != tok.text {
+					t.Errorf("offsets %d-%d of %q do not hold %q", tok.start, tok.end, tt.text, tok.text)
+				}
+			}
+		})
+	}
+}
+
+func TestNgrams(t *testing.T) {
+	tests := []struct {
+		word string
+		want []string
+	}{
+		{"a", []string{"^a", "a$"}},
+		{"ann", []string{"^a", "an", "nn", "n$"}},
+		{"zoë", []string{"^z", "zo", "oë", "ë$"}},
+	}
+	for _, tt := range tests {
+		if got := ngrams(tt.word); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ngrams(%q) = %v, want %v", tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"perera", "perera", 0},
+		{"perera", "pereira", 1}, // insertion
+		{"perera", "perara", 1},  // substitution
+		{"perera", "prera", 1},   // deletion
+		{"perera", "preera", 1},  // transposition
+		{"kumara", "kumaar", 1},
+		{"silva", "sliva", 1},
+		{"fernando", "frenadno", 2},
+		{"zoë", "zoe", 1},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestMatchScore(t *testing.T) {
+	tests := []struct {
+		name       string
+		term, word string
+		want       float64
+	}{
+		{"exact", "perera", "perera", 1},
+		{"prefix", "per", "perera", 0.8},
+		{"infix", "rer", "perera", 0.5},
+		{"short infix is ignored", "er", "perera", 0},
+		{"one typo", "pereira", "perera", 0.45},
+		{"transposed letters", "preera", "perera", 0.45},
+		{"misspelled prefix", "fernandp", "fernandopulle", 0.3},
+		{"short terms allow no typos", "sil", "sul", 0},
+		{"two typos in a short word", "parora", "perera", 0},
+		{"two typos in a long word", "frenadno", "fernando", 0.3},
+		{"unrelated", "kumara", "perera", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchScore(tt.term, tt.word); !floatEqual(got, tt.want) {
+				t.Errorf("matchScore(%q, %q) = %v, want %v", tt.term, tt.word, got, tt.want)
+			}
+		})
+	}
+}
+
+func floatEqual(a, b float64) bool {
+	d := a - b
+	return d < 1e-9 && d > -1e-9
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		words []string
+		want  string
+	}{
+		{"nothing marked", "Nimal Perera", nil, "Nimal Perera"},
+		{"one word", "Nimal Perera", []string{"perera"}, "Nimal <mark>Perera</mark>"},
+		{"words in any order", "Nimal Perera", []string{"perera", "nimal"}, "<mark>Nimal</mark> <mark>Perera</mark>"},
+		{"same word twice", "Nimal Perera", []string{"nimal", "nimal"}, "<mark>Nimal</mark> Perera"},
+		{"HTML is escaped", "<b>Ann</b> & co", []string{"ann"}, "&lt;b&gt;<mark>Ann</mark>&lt;/b&gt; &amp; co"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var marked []token
+			for _, w := range tt.words {
+				for _, tok := range tokenize(tt.text) {
+					if tok.text == w {
+						marked = append(marked, tok)
+					}
+				}
+			}
+			if got := highlight(tt.text, marked); got != tt.want {
+				t.Errorf("highlight() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexSearch(t *testing.T) {
+	ix := NewIndex(map[string]float64{"name": 2})
+	ix.Replace([]Document{
+		{ID: "1", Fields: map[string]string{"name": "Nimal Perera", "email": "nimal@example.com"}},
+		{ID: "2", Fields: map[string]string{"name": "Kamala Fernando", "email": "kamala@example.com"}},
+		{ID: "3", Fields: map[string]string{"name": "Sunil Silva", "email": "perera.sunil@example.com"}},
+	})
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"empty query", "  ", []string{}},
+		{"name outranks email", "perera", []string{"1", "3"}},
+		{"every word has to match", "nimal perera", []string{"1"}},
+		{"prefix", "kam", []string{"2"}},
+		{"typo", "fernadno", []string{"2"}},
+		{"case insensitive", "SILVA", []string{"3"}},
+		{"no match", "jayasuriya", []string{}},
+		{"shared domain", "example", []string{"1", "2", "3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := []string{}
+			for _, r := range ix.Search(tt.query, 10) {
+				ids = append(ids, r.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("Search(%q) = %v, want %v", tt.query, ids, tt.want)
+			}
+		})
+	}
+
+	if got := ix.Search("example", 2); len(got) != 2 {
+		t.Errorf("Search with limit 2 returned %d results", len(got))
+	}
+	if got := ix.Search("perera", 1)[0].Highlights["name"]; got != "Nimal <mark>Perera</mark>" {
+		t.Errorf("highlight = %q", got)
+	}
+
+	ix.Put(Document{ID: "1", Fields: map[string]string{"name": "Nimal Jayasuriya"}})
+	ix.Delete("3")
+	if got := ix.Search("perera", 10); len(got) != 0 {
+		t.Errorf("Search after replacing and deleting = %v, want none", got)
+	}
+	if ix.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", ix.Len())
+	}
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	model "go-fiber-app/models"
+	"go-fiber-app/repository"
+	"go-fiber-app/utils"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// APIKeyPrefix marks raw API keys so they can be told apart from JWTs in the Authorization header
+const APIKeyPrefix = "pk_"
+
+// lastUsedResolution limits how often a busy key writes its last-used timestamp
+const lastUsedResolution = time.Minute
+
+var (
+	ErrInvalidAPIKey     = errors.New("invalid, expired or revoked API key")
+	ErrAPIKeyNameMissing = errors.New("API key name is required")
+	ErrInvalidScope      = errors.New("invalid scope")
+	ErrInvalidExpiry     = errors.New("invalid expiry")
+)
+
+type APIKeyService struct {
+	apiKeyRepo *repository.APIKeyRepository
+	userRepo   *repository.UserRepository
+	defaultTTL time.Duration
+	maxTTL     time.Duration
+}
+
+func NewAPIKeyService(apiKeyRepo *repository.APIKeyRepository, userRepo *repository.UserRepository, defaultTTL, maxTTL time.Duration) *APIKeyService {
+	return &APIKeyService{
+		apiKeyRepo: apiKeyRepo,
+		userRepo:   userRepo,
+		defaultTTL: defaultTTL,
+		maxTTL:     maxTTL,
+	}
+}
+
+// CreateKey issues a key for the owner and returns it with the raw key, which
+// is not stored and cannot be shown again. Scopes must be permissions the owner's
+// roles grant; managing API keys is never grantable so a leaked key cannot mint more.
+// A zero ttl uses the default lifetime.
+func (s *APIKeyService) CreateKey(ownerID, creatorID primitive.ObjectID, name string, scopes []string, ttl time.Duration) (*model.APIKey, string, error) {
+	ctx := context.Background()
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", ErrAPIKeyNameMissing
+	}
+	if ttl == 0 {
+		ttl = s.defaultTTL
+	}
+	if ttl < 0 || ttl > s.maxTTL {
+		return nil, "", fmt.Errorf("%w: keys must expire within %s", ErrInvalidExpiry, s.maxTTL)
+	}
+
+	owner, err := s.userRepo.FindUserByID(ctx, ownerID)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(scopes) == 0 {
+		return nil, "", fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	for _, scope := range scopes {
+		if scope == model.PermAPIKeysManage || !model.RolesHavePermission(owner.EffectiveRoles(), scope) {
+			return nil, "", fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+	}
+
+	secret, err := utils.GenerateToken(32)
+	if err != nil {
+		return nil, "", fmt.Errorf("error generating API key: %w", err)
+	}
+	raw := APIKeyPrefix + secret
+
+	now := time.Now()
+	key := &model.APIKey{
+		UserID:    ownerID,
+		Name:      name,
+		Prefix:    raw[:len(APIKeyPrefix)+6],
+		KeyHash:   utils.HashToken(raw),
+		Scopes:    scopes,
+		CreatedBy: creatorID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := s.apiKeyRepo.CreateKey(ctx, key); err != nil {
+		return nil, "", err
+	}
+	return key, raw, nil
+}
+
+// ListKeys returns the user's keys without their hashes
+func (s *APIKeyService) ListKeys(userID primitive.ObjectID) ([]model.APIKey, error) {
+	return s.apiKeyRepo.ListByUser(context.Background(), userID)
+}
+
+// RevokeKey disables one of the user's keys
+func (s *APIKeyService) RevokeKey(userID, keyID primitive.ObjectID) error {
+	return s.apiKeyRepo.Revoke(context.Background(), userID, keyID)
+}
+
+// Authenticate resolves a raw key to the key and its owner and records the use
+func (s *APIKeyService) Authenticate(raw string) (*model.APIKey, *model.User, error) {
+	ctx := context.Background()
+	if !strings.HasPrefix(raw, APIKeyPrefix) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	key, err := s.apiKeyRepo.FindByHash(ctx, utils.HashToken(raw))
+	if err != nil {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	now := time.Now()
+	if !key.IsActive(now) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	user, err := s.userRepo.FindUserByID(ctx, key.UserID)
+	if err != nil {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	if user.LockedUntil != nil && now.Before(*user.LockedUntil) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedResolution {
+		if err := s.apiKeyRepo.TouchLastUsed(ctx, key.ID, now); err != nil {
+			fmt.Printf("Error recording API key usage %s: %v\n", key.ID.Hex(), err)
+		}
+		key.LastUsedAt = &now
+	}
+	return key, user, nil
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	model "go-fiber-app/models"
+	"go-fiber-app/repository"
+	"go-fiber-app/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func newTestAPIKeyService(mt *mtest.T) *APIKeyService {
+	return NewAPIKeyService(repository.NewAPIKeyRepository(mt.DB), repository.NewUserRepository(mt.DB), 30*24*time.Hour, 365*24*time.Hour)
+}
+
+func TestAPIKeyServiceCreateKeyScopes(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	member := model.User{ID: primitive.NewObjectID(), Roles: []string{model.RoleMember}}
+
+	tests := []struct {
+		name    string
+		scopes  []string
+		ttl     time.Duration
+		wantErr error
+	}{
+		{"scopes the owner's roles grant", []string{model.PermUsersRead, model.PermPhonesRead}, 0, nil},
+		{"no scopes", nil, 0, ErrInvalidScope},
+		{"permission the owner lacks", []string{model.PermUsersRead, model.PermUsersList}, 0, ErrInvalidScope},
+		{"managing keys is never grantable", []string{model.PermAPIKeysManage}, 0, ErrInvalidScope},
+		{"unknown permission", []string{"users:*"}, 0, ErrInvalidScope},
+		{"lifetime past the maximum", []string{model.PermUsersRead}, 366 * 24 * time.Hour, ErrInvalidExpiry},
+		{"negative lifetime", []string{model.PermUsersRead}, -time.Hour, ErrInvalidExpiry},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			s := newTestAPIKeyService(mt)
+			mt.AddMockResponses(findResponse("users", toDoc(mt.T, member)), mtest.CreateSuccessResponse())
+
+			key, raw, err := s.CreateKey(member.ID, member.ID, "deploy bot", tt.scopes, tt.ttl)
+			if !errors.Is(err, tt.wantErr) {
+				mt.Fatalf("CreateKey() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if !strings.HasPrefix(raw, APIKeyPrefix) || key.KeyHash != utils.HashToken(raw) || key.Prefix != raw[:len(APIKeyPrefix)+6] {
+				mt.Errorf("CreateKey() = %+v with raw key %q", key, raw)
+			}
+			if got := key.ExpiresAt.Sub(key.CreatedAt); got != 30*24*time.Hour {
+				mt.Errorf("default lifetime = %s, want 720h", got)
+			}
+		})
+	}
+}
+
+func TestAPIKeyServiceAuthenticate(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	raw := APIKeyPrefix + "secret"
+	now := time.Now()
+	earlier := now.Add(-time.Hour)
+	later := now.Add(time.Hour)
+	owner := model.User{ID: primitive.NewObjectID(), Roles: []string{model.RoleMember}}
+	locked := owner
+	locked.LockedUntil = &later
+
+	key := func(change func(*model.APIKey)) *model.APIKey {
+		k := &model.APIKey{ID: primitive.NewObjectID(), UserID: owner.ID, KeyHash: utils.HashToken(raw), Scopes: []string{model.PermUsersRead}, ExpiresAt: later, LastUsedAt: &now}
+		change(k)
+		return k
+	}
+
+	tests := []struct {
+		name    string
+		raw     string
+		key     *model.APIKey // nil when the hash is unknown
+		owner   *model.User
+		wantErr error
+	}{
+		{"active key", raw, key(func(*model.APIKey) {}), &owner, nil},
+		{"missing prefix", "secret", nil, nil, ErrInvalidAPIKey},
+		{"unknown key", raw, nil, nil, ErrInvalidAPIKey},
+		{"expired key", raw, key(func(k *model.APIKey) { k.ExpiresAt = earlier }), nil, ErrInvalidAPIKey},
+		{"revoked key", raw, key(func(k *model.APIKey) { k.RevokedAt = &earlier }), nil, ErrInvalidAPIKey},
+		{"locked owner", raw, key(func(*model.APIKey) {}), &locked, ErrInvalidAPIKey},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			s := newTestAPIKeyService(mt)
+			if tt.key == nil {
+				mt.AddMockResponses(findResponse("api_keys"))
+			} else {
+				mt.AddMockResponses(findResponse("api_keys", toDoc(mt.T, tt.key)))
+			}
+			if tt.owner != nil {
+				mt.AddMockResponses(findResponse("users", toDoc(mt.T, tt.owner)))
+			}
+
+			gotKey, gotUser, err := s.Authenticate(tt.raw)
+			if !errors.Is(err, tt.wantErr) {
+				mt.Fatalf("Authenticate() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && (gotKey.ID != tt.key.ID || gotUser.ID != owner.ID) {
+				mt.Errorf("Authenticate() = %+v, %+v", gotKey, gotUser)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-fiber-app/mailer"
+	model "go-fiber-app/models"
+	"go-fiber-app/repository"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// VerificationPolicy decides what unverified accounts may do
+type VerificationPolicy string
+
+const (
+	// VerificationBlock refuses to log unverified accounts in
+	VerificationBlock VerificationPolicy = "block"
+	// VerificationRestrict lets unverified accounts log in but keeps them read-only
+	VerificationRestrict VerificationPolicy = "restrict"
+)
+
+const emailVerificationPurpose = "email_verification"
+
+var ErrInvalidVerificationToken = errors.New("invalid or expired verification link")
+
+type EmailVerificationService struct {
+	userRepo  *repository.UserRepository
+	mailer    mailer.Mailer
+	secret    []byte
+	ttl       time.Duration
+	verifyURL string
+	policy    VerificationPolicy
+}
+
+func NewEmailVerificationService(userRepo *repository.UserRepository, m mailer.Mailer, secret string, ttl time.Duration, verifyURL string, policy VerificationPolicy) *EmailVerificationService {
+	if policy != VerificationBlock {
+		policy = VerificationRestrict
+	}
+	return &EmailVerificationService{
+		userRepo:  userRepo,
+		mailer:    m,
+		secret:    []byte(secret),
+		ttl:       ttl,
+		verifyURL: verifyURL,
+		policy:    policy,
+	}
+}
+
+// Policy returns the configured policy for unverified accounts
+func (s *EmailVerificationService) Policy() VerificationPolicy {
+	return s.policy
+}
+
+// SendVerification emails a signed link bound to the user's current address
+func (s *EmailVerificationService) SendVerification(user *model.User) error {
+	claims := jwt.MapClaims{
+		"purpose": emailVerificationPurpose,
+		"sub":     user.ID.Hex(),
+		"email":   user.Email,
+		"exp":     time.Now().Add(s.ttl).Unix(),
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+	if err != nil {
+		return fmt.Errorf("error signing verification link: %w", err)
+	}
+
+	link := s.verifyURL + "?token=" + url.QueryEscape(signed)
+	return s.mailer.Send(context.Background(), mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\nThe link expires in %s.\n",
+			user.Name, link, s.ttl),
+	})
+}
+
+// Verify checks the signed link and marks the address as verified
+func (s *EmailVerificationService) Verify(rawToken string) (*model.User, error) {
+	token, err := jwt.Parse(rawToken, func(t *jwt.Token) (interface{}, error) {
+		return s.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != emailVerificationPurpose {
+		return nil, ErrInvalidVerificationToken
+	}
+	subject, _ := claims["sub"].(string)
+	email, _ := claims["email"].(string)
+	userID, err := primitive.ObjectIDFromHex(subject)
+	if err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	ctx := context.Background()
+	if err := s.userRepo.MarkEmailVerified(ctx, userID, email); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrInvalidVerificationToken
+		}
+		return nil, err
+	}
+	return s.userRepo.FindUserByID(ctx, userID)
+}
+
+// Resend sends a fresh link to an unverified account. Unknown or already
+// verified addresses are ignored so the endpoint does not reveal accounts.
+func (s *EmailVerificationService) Resend(email string) error {
+	user, err := s.userRepo.FindUserByEmail(context.Background(), email)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return nil
+	}
+	return s.SendVerification(user)
+}
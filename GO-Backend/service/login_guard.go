@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	model "go-fiber-app/models"
+	"go-fiber-app/repository"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LoginGuardConfig controls brute-force protection on the login endpoint
+type LoginGuardConfig struct {
+	FreeAttempts     int           // failures allowed before backoff kicks in
+	BaseDelay        time.Duration // first backoff delay, doubled on every further failure
+	MaxDelay         time.Duration
+	MaxEmailFailures int           // failures before the account is locked
+	MaxIPFailures    int           // failures from one IP before it is blocked for MaxDelay
+	LockoutDuration  time.Duration // how long a locked account stays locked
+	Window           time.Duration // counters older than this start over
+}
+
+// CounterLifetime is how long a failure counter can still affect a login after its
+// last failure: while it counts towards the window, or while it blocks for up to MaxDelay
+func (c LoginGuardConfig) CounterLifetime() time.Duration {
+	return max(c.Window, c.MaxDelay)
+}
+
+// LockoutError is returned when a login attempt must be rejected without checking the password
+type LockoutError struct {
+	AccountLocked bool
+	RetryAfter    time.Duration
+}
+
+func (e *LockoutError) Error() string {
+	if e.AccountLocked {
+		return "account is temporarily locked"
+	}
+	return "too many failed login attempts"
+}
+
+// RetryAfterSeconds rounds the wait time up for the Retry-After header
+func (e *LockoutError) RetryAfterSeconds() int {
+	seconds := int((e.RetryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
+
+type LoginGuard struct {
+	store    repository.LoginAttemptStore
+	userRepo *repository.UserRepository
+	config   LoginGuardConfig
+}
+
+func NewLoginGuard(store repository.LoginAttemptStore, userRepo *repository.UserRepository, config LoginGuardConfig) *LoginGuard {
+	return &LoginGuard{store: store, userRepo: userRepo, config: config}
+}
+
+// Check returns a *LockoutError if the email or IP is currently blocked or the account is locked
+func (g *LoginGuard) Check(email, ip string, user *model.User) error {
+	ctx := context.Background()
+	now := time.Now()
+
+	if user != nil && user.LockedUntil != nil && now.Before(*user.LockedUntil) {
+		return &LockoutError{AccountLocked: true, RetryAfter: user.LockedUntil.Sub(now)}
+	}
+
+	for _, key := range []string{emailKey(email), ipKey(ip)} {
+		attempt, err := g.store.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		if attempt != nil && now.Before(attempt.BlockedUntil) {
+			return &LockoutError{RetryAfter: attempt.BlockedUntil.Sub(now)}
+		}
+	}
+	return nil
+}
+
+// RecordFailure counts a failed attempt against the email and the IP. It returns a
+// *LockoutError when this failure caused the account to be locked.
+func (g *LoginGuard) RecordFailure(email, ip string, user *model.User) error {
+	ctx := context.Background()
+	now := time.Now()
+
+	emailAttempt, err := g.recordFailure(ctx, emailKey(email), now)
+	if err != nil {
+		return err
+	}
+	if delay := g.backoff(emailAttempt.Failures); delay > 0 {
+		if err := g.store.SetBlockedUntil(ctx, emailKey(email), now.Add(delay)); err != nil {
+			return err
+		}
+	}
+
+	ipAttempt, err := g.recordFailure(ctx, ipKey(ip), now)
+	if err != nil {
+		return err
+	}
+	ipDelay := g.backoff(ipAttempt.Failures)
+	if ipAttempt.Failures >= g.config.MaxIPFailures {
+		ipDelay = g.config.MaxDelay
+	}
+	if ipDelay > 0 {
+		if err := g.store.SetBlockedUntil(ctx, ipKey(ip), now.Add(ipDelay)); err != nil {
+			return err
+		}
+	}
+
+	if user != nil && emailAttempt.Failures >= g.config.MaxEmailFailures {
+		lockedUntil := now.Add(g.config.LockoutDuration)
+		if err := g.userRepo.SetLockedUntil(ctx, user.ID, &lockedUntil); err != nil {
+			return err
+		}
+		fmt.Printf("Account %s locked until %s after %d failed logins\n", user.Email, lockedUntil.Format(time.RFC3339), emailAttempt.Failures)
+		return &LockoutError{AccountLocked: true, RetryAfter: g.config.LockoutDuration}
+	}
+	return nil
+}
+
+// RecordSuccess clears the failure counter for the email
+func (g *LoginGuard) RecordSuccess(email string) error {
+	return g.store.Reset(context.Background(), emailKey(email))
+}
+
+// Unlock lifts an account lock before it expires
+func (g *LoginGuard) Unlock(userID primitive.ObjectID) (*model.User, error) {
+	ctx := context.Background()
+	user, err := g.userRepo.FindUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.userRepo.SetLockedUntil(ctx, userID, nil); err != nil {
+		return nil, err
+	}
+	if err := g.store.Reset(ctx, emailKey(user.Email)); err != nil {
+		return nil, err
+	}
+	user.LockedUntil = nil
+	return user, nil
+}
+
+// recordFailure starts the counter over when the previous failure is outside the window
+func (g *LoginGuard) recordFailure(ctx context.Context, key string, now time.Time) (*model.LoginAttempt, error) {
+	existing, err := g.store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && now.Sub(existing.LastFailureAt) > g.config.Window {
+		if err := g.store.Reset(ctx, key); err != nil {
+			return nil, err
+		}
+	}
+	return g.store.RecordFailure(ctx, key, now)
+}
+
+// backoff doubles the delay for every failure past the free attempts
+func (g *LoginGuard) backoff(failures int) time.Duration {
+	extra := failures - g.config.FreeAttempts
+	if extra <= 0 {
+		return 0
+	}
+	delay := g.config.BaseDelay
+	for i := 1; i < extra; i++ {
+		delay *= 2
+		if delay >= g.config.MaxDelay {
+			return g.config.MaxDelay
+		}
+	}
+	return delay
+}
+
+func emailKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
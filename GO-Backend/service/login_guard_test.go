@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	model "go-fiber-app/models"
+	"go-fiber-app/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+var testGuardConfig = LoginGuardConfig{
+	FreeAttempts:     3,
+	BaseDelay:        time.Second,
+	MaxDelay:         8 * time.Second,
+	MaxEmailFailures: 10,
+	MaxIPFailures:    20,
+	LockoutDuration:  15 * time.Minute,
+	Window:           15 * time.Minute,
+}
+
+func TestLoginGuardBackoff(t *testing.T) {
+	g := &LoginGuard{config: testGuardConfig}
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{6, 4 * time.Second},
+		{7, 8 * time.Second},
+		{8, 8 * time.Second},
+		{50, 8 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := g.backoff(tt.failures); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLoginGuardConfigCounterLifetime(t *testing.T) {
+	if got := testGuardConfig.CounterLifetime(); got != testGuardConfig.Window {
+		t.Errorf("CounterLifetime() = %s, want the window %s", got, testGuardConfig.Window)
+	}
+	config := testGuardConfig
+	config.MaxDelay = time.Hour
+	if got := config.CounterLifetime(); got != time.Hour {
+		t.Errorf("CounterLifetime() = %s, want the longest block %s", got, time.Hour)
+	}
+}
+
+func TestLockoutErrorRetryAfterSeconds(t *testing.T) {
+	tests := []struct {
+		retryAfter time.Duration
+		want       int
+	}{
+		{0, 1},
+		{time.Millisecond, 1},
+		{time.Second, 1},
+		{1500 * time.Millisecond, 2},
+		{15 * time.Minute, 900},
+	}
+	for _, tt := range tests {
+		if got := (&LockoutError{RetryAfter: tt.retryAfter}).RetryAfterSeconds(); got != tt.want {
+			t.Errorf("RetryAfterSeconds() for %s = %d, want %d", tt.retryAfter, got, tt.want)
+		}
+	}
+}
+
+// failLogins records n failed logins for the email from the IP
+func failLogins(t *testing.T, g *LoginGuard, email, ip string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := g.RecordFailure(email, ip, nil); err != nil {
+			t.Fatalf("RecordFailure() error = %v", err)
+		}
+	}
+}
+
+func TestLoginGuardCheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		email, ip string // what the next login uses
+		wantBlock bool
+	}{
+		{"free attempts", 3, "nimal@example.com", "10.0.0.1", false},
+		{"backoff after the free attempts", 4, "nimal@example.com", "10.0.0.2", true},
+		{"email is matched case-insensitively", 4, " Nimal@Example.com ", "10.0.0.2", true},
+		{"backoff follows the IP", 4, "kamala@example.com", "10.0.0.1", true},
+		{"other email and IP are not blocked", 4, "kamala@example.com", "10.0.0.2", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewLoginGuard(repository.NewMemoryLoginAttemptStore(testGuardConfig.Window, 1000), nil, testGuardConfig)
+			failLogins(t, g, "nimal@example.com", "10.0.0.1", tt.failures)
+
+			err := g.Check(tt.email, tt.ip, nil)
+			var lockout *LockoutError
+			if blocked := errors.As(err, &lockout); blocked != tt.wantBlock {
+				t.Fatalf("Check() error = %v, want blocked %v", err, tt.wantBlock)
+			}
+			if tt.wantBlock && (lockout.AccountLocked || lockout.RetryAfter <= 0 || lockout.RetryAfter > time.Second) {
+				t.Errorf("Check() = %+v, want a backoff of up to a second", lockout)
+			}
+		})
+	}
+}
+
+func TestLoginGuardIPBlock(t *testing.T) {
+	g := NewLoginGuard(repository.NewMemoryLoginAttemptStore(testGuardConfig.Window, 1000), nil, testGuardConfig)
+	// Spray one password over many accounts from the same IP
+	for i := 0; i < testGuardConfig.MaxIPFailures; i++ {
+		failLogins(t, g, primitive.NewObjectID().Hex()+"@example.com", "10.0.0.9", 1)
+	}
+
+	var lockout *LockoutError
+	if err := g.Check("new@example.com", "10.0.0.9", nil); !errors.As(err, &lockout) {
+		t.Fatalf("Check() error = %v, want the IP blocked", err)
+	}
+	if lockout.RetryAfter <= testGuardConfig.MaxDelay-time.Second {
+		t.Errorf("IP blocked for %s, want %s", lockout.RetryAfter, testGuardConfig.MaxDelay)
+	}
+}
+
+func TestLoginGuardWindowAndReset(t *testing.T) {
+	store := repository.NewMemoryLoginAttemptStore(testGuardConfig.Window, 1000)
+	g := NewLoginGuard(store, nil, testGuardConfig)
+	ctx := context.Background()
+
+	// Failures from long ago start over instead of adding up
+	long := time.Now().Add(-2 * testGuardConfig.Window)
+	for i := 0; i < 5; i++ {
+		store.RecordFailure(ctx, emailKey("nimal@example.com"), long)
+	}
+	failLogins(t, g, "nimal@example.com", "10.0.0.1", 1)
+	attempt, _ := store.Get(ctx, emailKey("nimal@example.com"))
+	if attempt.Failures != 1 {
+		t.Errorf("failures after the window = %d, want 1", attempt.Failures)
+	}
+
+	// A successful login clears the email counter but not the IP counter
+	failLogins(t, g, "nimal@example.com", "10.0.0.1", 4)
+	if err := g.RecordSuccess("NIMAL@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if attempt, _ := store.Get(ctx, emailKey("nimal@example.com")); attempt != nil {
+		t.Errorf("email counter after success = %+v, want none", attempt)
+	}
+	if attempt, _ := store.Get(ctx, ipKey("10.0.0.1")); attempt == nil || attempt.Failures != 5 {
+		t.Errorf("IP counter after success = %+v, want 5 failures", attempt)
+	}
+}
+
+func TestLoginGuardLockout(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("locks the account at the failure limit", func(mt *mtest.T) {
+		g := NewLoginGuard(repository.NewMemoryLoginAttemptStore(testGuardConfig.Window, 1000), repository.NewUserRepository(mt.DB), testGuardConfig)
+		user := &model.User{ID: primitive.NewObjectID(), Email: "nimal@example.com"}
+
+		failLogins(mt.T, g, user.Email, "10.0.0.1", testGuardConfig.MaxEmailFailures-1)
+		if names := commandNames(mt); len(names) != 0 {
+			mt.Fatalf("commands before the limit = %v, want none", names)
+		}
+
+		mt.AddMockResponses(updateResponse(1))
+		err := g.RecordFailure(user.Email, "10.0.0.1", user)
+		var lockout *LockoutError
+		if !errors.As(err, &lockout) || !lockout.AccountLocked || lockout.RetryAfter != testGuardConfig.LockoutDuration {
+			mt.Fatalf("RecordFailure() error = %v, want the account locked for %s", err, testGuardConfig.LockoutDuration)
+		}
+		set := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("u", "$set").Document()
+		if _, err := set.LookupErr("locked_until"); err != nil {
+			mt.Errorf("update %s does not set locked_until", set)
+		}
+	})
+
+	mt.Run("locked account is rejected before the password is checked", func(mt *mtest.T) {
+		g := NewLoginGuard(repository.NewMemoryLoginAttemptStore(testGuardConfig.Window, 1000), repository.NewUserRepository(mt.DB), testGuardConfig)
+		until := time.Now().Add(10 * time.Minute)
+		user := &model.User{ID: primitive.NewObjectID(), LockedUntil: &until}
+
+		var lockout *LockoutError
+		if err := g.Check("nimal@example.com", "10.0.0.1", user); !errors.As(err, &lockout) || !lockout.AccountLocked {
+			mt.Fatalf("Check() error = %v, want the account locked", err)
+		}
+		expired := time.Now().Add(-time.Second)
+		user.LockedUntil = &expired
+		if err := g.Check("nimal@example.com", "10.0.0.1", user); err != nil {
+			mt.Errorf("Check() after the lock expired error = %v", err)
+		}
+	})
+
+	mt.Run("unlock clears the lock and the counter", func(mt *mtest.T) {
+		store := repository.NewMemoryLoginAttemptStore(testGuardConfig.Window, 1000)
+		g := NewLoginGuard(store, repository.NewUserRepository(mt.DB), testGuardConfig)
+		user := model.User{ID: primitive.NewObjectID(), Email: "nimal@example.com"}
+		failLogins(mt.T, g, user.Email, "10.0.0.1", 5)
+
+		until := time.Now().Add(time.Hour)
+		user.LockedUntil = &until
+		mt.AddMockResponses(findResponse("users", toDoc(mt.T, user)), updateResponse(1))
+		unlocked, err := g.Unlock(user.ID)
+		if err != nil {
+			mt.Fatalf("Unlock() error = %v", err)
+		}
+		if unlocked.LockedUntil != nil {
+			mt.Errorf("LockedUntil = %v, want nil", unlocked.LockedUntil)
+		}
+		if err := g.Check(user.Email, "10.0.0.2", unlocked); err != nil {
+			mt.Errorf("Check() after unlock error = %v", err)
+		}
+	})
+}
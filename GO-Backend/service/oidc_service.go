@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	model "go-fiber-app/models"
+	"go-fiber-app/repository"
+	"go-fiber-app/utils"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrOIDCInvalidState     = errors.New("invalid or expired login state")
+	ErrOIDCProvider         = errors.New("identity provider error")
+	ErrOIDCEmailNotVerified = errors.New("the identity provider did not confirm this email address")
+	ErrOIDCNoAccount        = errors.New("no account exists for this email address")
+	ErrOIDCIdentityConflict = errors.New("this email address belongs to an account linked to a different identity")
+)
+
+// OIDCConfig describes the OpenID Connect provider and how unknown identities are handled
+type OIDCConfig struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	AutoCreate   bool          // create an account on first login instead of rejecting unknown emails
+	StateTTL     time.Duration // how long the user has to finish logging in at the provider
+}
+
+type OIDCService struct {
+	stateRepo *repository.OIDCStateRepository
+	userRepo  *repository.UserRepository
+	users     *UserService // creates and links accounts, keeping history and search up to date
+	config    OIDCConfig
+
+	// The provider is discovered on first use so the API starts even when the issuer is down
+	mu       sync.Mutex
+	provider *oidc.Provider
+	verifier *oidc.IDTokenVerifier
+	oauth    *oauth2.Config
+}
+
+// oidcClaims are the ID token claims used to find or create the account
+type oidcClaims struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	Nonce         string `json:"nonce"`
+}
+
+func NewOIDCService(stateRepo *repository.OIDCStateRepository, userRepo *repository.UserRepository, users *UserService, config OIDCConfig) *OIDCService {
+	return &OIDCService{stateRepo: stateRepo, userRepo: userRepo, users: users, config: config}
+}
+
+// AuthURL starts a login and returns the provider URL to redirect the browser to.
+// The request carries a one-time state, a nonce and a PKCE S256 challenge.
+// binding ties the login to the browser that started it: keep it in that browser
+// (a cookie) and pass it back to Callback.
+func (s *OIDCService) AuthURL() (authURL, binding string, err error) {
+	ctx := context.Background()
+	oauth, _, err := s.client(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := utils.GenerateToken(32)
+	if err != nil {
+		return "", "", fmt.Errorf("error generating login state: %w", err)
+	}
+	nonce, err := utils.GenerateToken(32)
+	if err != nil {
+		return "", "", fmt.Errorf("error generating nonce: %w", err)
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	now := time.Now()
+	if err := s.stateRepo.CreateState(ctx, &model.OIDCLoginState{
+		StateHash:    utils.HashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(s.config.StateTTL),
+	}); err != nil {
+		return "", "", err
+	}
+
+	return oauth.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier), oidc.Nonce(nonce)), utils.HashToken(state), nil
+}
+
+// StateTTL is how long a started login stays valid
+func (s *OIDCService) StateTTL() time.Duration {
+	return s.config.StateTTL
+}
+
+// Callback finishes a login: it exchanges the code, verifies the ID token and
+// returns the linked account, linking or creating one if needed. binding is the
+// value AuthURL returned to the browser that started the login; a callback opened
+// in any other browser is rejected, so nobody can be signed into someone else's account.
+func (s *OIDCService) Callback(code, state, binding string) (*model.User, error) {
+	ctx := context.Background()
+	if subtle.ConstantTimeCompare([]byte(binding), []byte(utils.HashToken(state))) != 1 {
+		return nil, ErrOIDCInvalidState
+	}
+	oauth, verifier, err := s.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pending, err := s.stateRepo.ConsumeState(ctx, utils.HashToken(state))
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrOIDCInvalidState
+		}
+		return nil, err
+	}
+
+	token, err := oauth.Exchange(ctx, code, oauth2.VerifierOption(pending.CodeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("%w: code exchange failed: %v", ErrOIDCProvider, err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: no id_token in token response", ErrOIDCProvider)
+	}
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid id_token: %v", ErrOIDCProvider, err)
+	}
+
+	var claims oidcClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("%w: unreadable id_token claims: %v", ErrOIDCProvider, err)
+	}
+	if claims.Nonce != pending.Nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrOIDCProvider)
+	}
+
+	return s.resolveUser(ctx, idToken.Issuer, claims)
+}
+
+// resolveUser finds the account for the identity. Unknown identities are linked by
+// verified email, or get a new account when auto-create is on.
+func (s *OIDCService) resolveUser(ctx context.Context, issuer string, claims oidcClaims) (*model.User, error) {
+	user, err := s.userRepo.FindUserByIdentity(ctx, issuer, claims.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	email := strings.TrimSpace(claims.Email)
+	if email == "" || !claims.EmailVerified {
+		return nil, ErrOIDCEmailNotVerified
+	}
+	identity := model.ExternalIdentity{Issuer: issuer, Subject: claims.Subject, LinkedAt: time.Now()}
+
+	user, err = s.userRepo.FindUserByEmail(ctx, email)
+	switch {
+	case err == nil:
+		for _, linked := range user.Identities {
+			if linked.Issuer == issuer {
+				return nil, ErrOIDCIdentityConflict
+			}
+		}
+		if err := s.users.LinkIdentity(user, identity); err != nil {
+			return nil, err
+		}
+		return user, nil
+	case !errors.Is(err, mongo.ErrNoDocuments):
+		return nil, err
+	case !s.config.AutoCreate:
+		return nil, ErrOIDCNoAccount
+	}
+
+	return s.createUser(email, claims.Name, identity)
+}
+
+// createUser makes an account for a first-time provider login. It gets a random
+// password, so signing in with a password needs a reset first.
+func (s *OIDCService) createUser(email, name string, identity model.ExternalIdentity) (*model.User, error) {
+	randomPassword, err := utils.GenerateToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("error generating password: %w", err)
+	}
+	hash, err := s.users.HashPassword(randomPassword)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = email
+	}
+
+	user := &model.User{
+		Name:       name,
+		Email:      email,
+		Password:   hash,
+		Identities: []model.ExternalIdentity{identity},
+	}
+	if err := s.users.CreateExternalUser(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// client discovers the provider on first use and caches the result
+func (s *OIDCService) client(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.provider != nil {
+		return s.oauth, s.verifier, nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, s.config.IssuerURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: discovery failed: %v", ErrOIDCProvider, err)
+	}
+
+	scopes := s.config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "email", "profile"}
+	}
+	s.provider = provider
+	s.verifier = provider.Verifier(&oidc.Config{ClientID: s.config.ClientID})
+	s.oauth = &oauth2.Config{
+		ClientID:     s.config.ClientID,
+		ClientSecret: s.config.ClientSecret,
+		RedirectURL:  s.config.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       scopes,
+	}
+	return s.oauth, s.verifier, nil
+}
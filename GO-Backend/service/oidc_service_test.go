@@ -0,0 +1,256 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-fiber-app/keyring"
+	model "go-fiber-app/models"
+	"go-fiber-app/repository"
+	"go-fiber-app/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+const testOIDCClientID = "user-api"
+
+// fakeProvider is a minimal OpenID provider: discovery, JWKS and a token
+// endpoint that answers every code with the configured ID token claims
+type fakeProvider struct {
+	*httptest.Server
+	keys     *keyring.KeyRing
+	claims   jwt.MapClaims // ID token claims; iss, aud and exp are filled in
+	verifier string        // PKCE verifier received by the token endpoint
+	tokenHit bool
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+	if err := os.WriteFile(filepath.Join(dir, "idp.pem"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := keyring.Load(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &fakeProvider{keys: keys}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                p.URL,
+			"authorization_endpoint":                p.URL + "/authorize",
+			"token_endpoint":                        p.URL + "/token",
+			"jwks_uri":                              p.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(p.keys.JWKS())
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		p.tokenHit = true
+		r.ParseForm()
+		p.verifier = r.PostForm.Get("code_verifier")
+		claims := jwt.MapClaims{"iss": p.URL, "aud": testOIDCClientID, "exp": time.Now().Add(time.Minute).Unix(), "iat": time.Now().Unix()}
+		for k, v := range p.claims {
+			claims[k] = v
+		}
+		idToken, err := p.keys.Sign(claims)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "at", "token_type": "Bearer", "id_token": idToken})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func newTestOIDCService(mt *mtest.T, issuer string) *OIDCService {
+	userRepo := repository.NewUserRepository(mt.DB)
+	return NewOIDCService(repository.NewOIDCStateRepository(mt.DB), userRepo, NewUserService(userRepo), OIDCConfig{
+		IssuerURL:   issuer,
+		ClientID:    testOIDCClientID,
+		RedirectURL: "http://localhost:8080/api/auth/oidc/callback",
+		StateTTL:    10 * time.Minute,
+	})
+}
+
+func TestOIDCServiceAuthURL(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	provider := newFakeProvider(t)
+
+	mt.Run("stores the state hash, nonce and PKCE verifier", func(mt *mtest.T) {
+		s := newTestOIDCService(mt, provider.URL)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+
+		authURL, binding, err := s.AuthURL()
+		if err != nil {
+			mt.Fatalf("AuthURL() error = %v", err)
+		}
+		parsed, err := url.Parse(authURL)
+		if err != nil {
+			mt.Fatal(err)
+		}
+		query := parsed.Query()
+		if !strings.HasPrefix(authURL, provider.URL+"/authorize?") || query.Get("client_id") != testOIDCClientID || query.Get("code_challenge_method") != "S256" {
+			mt.Fatalf("AuthURL() = %s", authURL)
+		}
+
+		mt.GetStartedEvent() // clearing abandoned states
+		stored := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		if got := stored.Lookup("_id").StringValue(); got != utils.HashToken(query.Get("state")) {
+			mt.Errorf("stored state %q, want the hash of %q", got, query.Get("state"))
+		}
+		if got := stored.Lookup("nonce").StringValue(); got == "" || got != query.Get("nonce") {
+			mt.Errorf("stored nonce %q, URL nonce %q", got, query.Get("nonce"))
+		}
+		challenge := sha256.Sum256([]byte(stored.Lookup("code_verifier").StringValue()))
+		if got := base64.RawURLEncoding.EncodeToString(challenge[:]); got != query.Get("code_challenge") {
+			mt.Errorf("code_challenge %q does not match the stored verifier", query.Get("code_challenge"))
+		}
+		if strings.Contains(authURL, stored.Lookup("code_verifier").StringValue()) {
+			mt.Error("the PKCE verifier leaked into the authorization URL")
+		}
+		// The browser keeps a binding to the state it was sent, not the state itself
+		if binding != utils.HashToken(query.Get("state")) {
+			mt.Errorf("binding %q does not match the state", binding)
+		}
+	})
+}
+
+func TestOIDCServiceCallback(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	provider := newFakeProvider(t)
+	linked := model.User{ID: primitive.NewObjectID(), Email: "nimal@example.com", EmailVerified: true}
+	pending := model.OIDCLoginState{
+		StateHash:    utils.HashToken("state-1"),
+		Nonce:        "nonce-1",
+		CodeVerifier: "verifier-1",
+		ExpiresAt:    time.Now().Add(time.Minute),
+	}
+
+	tests := []struct {
+		name      string
+		binding   string                // binding cookie the browser sends back
+		state     *model.OIDCLoginState // what consuming the state finds; nil when it is unknown or expired
+		claims    jwt.MapClaims
+		wantErr   error
+		wantToken bool // whether the code is exchanged at the provider
+	}{
+		{
+			name:      "matching state and nonce",
+			binding:   utils.HashToken("state-1"),
+			state:     &pending,
+			claims:    jwt.MapClaims{"sub": "abc", "nonce": "nonce-1"},
+			wantToken: true,
+		},
+		{
+			name:    "unknown or expired state",
+			binding: utils.HashToken("state-1"),
+			claims:  jwt.MapClaims{"sub": "abc", "nonce": "nonce-1"},
+			wantErr: ErrOIDCInvalidState,
+		},
+		{
+			name:    "state started in another browser",
+			binding: utils.HashToken("state-2"),
+			state:   &pending,
+			claims:  jwt.MapClaims{"sub": "abc", "nonce": "nonce-1"},
+			wantErr: ErrOIDCInvalidState,
+		},
+		{
+			name:    "no binding cookie",
+			state:   &pending,
+			claims:  jwt.MapClaims{"sub": "abc", "nonce": "nonce-1"},
+			wantErr: ErrOIDCInvalidState,
+		},
+		{
+			name:      "nonce from another login",
+			binding:   utils.HashToken("state-1"),
+			state:     &pending,
+			claims:    jwt.MapClaims{"sub": "abc", "nonce": "nonce-2"},
+			wantErr:   ErrOIDCProvider,
+			wantToken: true,
+		},
+		{
+			name:      "missing nonce",
+			binding:   utils.HashToken("state-1"),
+			state:     &pending,
+			claims:    jwt.MapClaims{"sub": "abc"},
+			wantErr:   ErrOIDCProvider,
+			wantToken: true,
+		},
+		{
+			name:      "ID token for another client",
+			binding:   utils.HashToken("state-1"),
+			state:     &pending,
+			claims:    jwt.MapClaims{"sub": "abc", "nonce": "nonce-1", "aud": "other-client"},
+			wantErr:   ErrOIDCProvider,
+			wantToken: true,
+		},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			s := newTestOIDCService(mt, provider.URL)
+			provider.claims, provider.tokenHit, provider.verifier = tt.claims, false, ""
+			if tt.state == nil {
+				mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: nil}))
+			} else {
+				mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: toDoc(mt.T, tt.state)}))
+			}
+			mt.AddMockResponses(findResponse("users", toDoc(mt.T, linked)))
+
+			user, err := s.Callback("code-1", "state-1", tt.binding)
+			if !errors.Is(err, tt.wantErr) {
+				mt.Fatalf("Callback() error = %v, want %v", err, tt.wantErr)
+			}
+			if provider.tokenHit != tt.wantToken {
+				mt.Errorf("code exchanged = %v, want %v", provider.tokenHit, tt.wantToken)
+			}
+			if tt.wantToken && provider.verifier != pending.CodeVerifier {
+				mt.Errorf("token endpoint got verifier %q, want %q", provider.verifier, pending.CodeVerifier)
+			}
+			if tt.binding != utils.HashToken("state-1") {
+				// A login from another browser is refused before its state is touched
+				if names := commandNames(mt); len(names) != 0 {
+					mt.Errorf("commands = %v, want none", names)
+				}
+				return
+			}
+			// The state is consumed by the hash of the value the browser returned
+			consume := mt.GetStartedEvent().Command.Lookup("query").Document()
+			if got := consume.Lookup("_id").StringValue(); got != utils.HashToken("state-1") {
+				mt.Errorf("consumed state %q, want the hash of state-1", got)
+			}
+			if tt.wantErr == nil && user.ID != linked.ID {
+				mt.Errorf("Callback() user = %s, want %s", user.ID.Hex(), linked.ID.Hex())
+			}
+		})
+	}
+}
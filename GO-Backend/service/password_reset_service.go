@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-fiber-app/mailer"
+	model "go-fiber-app/models"
+	"go-fiber-app/repository"
+	"go-fiber-app/utils"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+)
+
+type PasswordResetService struct {
+	resetRepo   *repository.PasswordResetRepository
+	userService *UserService
+	sessions    *SessionService
+	mailer      mailer.Mailer
+	ttl         time.Duration
+	inviteTTL   time.Duration
+	resendAfter time.Duration // a newer reset request within this time keeps the link already sent
+	resetURL    string        // frontend page that receives ?token=
+}
+
+func NewPasswordResetService(resetRepo *repository.PasswordResetRepository, userService *UserService, sessions *SessionService, m mailer.Mailer, ttl time.Duration, resetURL string) *PasswordResetService {
+	return &PasswordResetService{
+		resetRepo:   resetRepo,
+		userService: userService,
+		sessions:    sessions,
+		mailer:      m,
+		ttl:         ttl,
+		inviteTTL:   7 * 24 * time.Hour,
+		resendAfter: 5 * time.Minute,
+		resetURL:    resetURL,
+	}
+}
+
+// SetInviteTTL sets how long the link in an invite stays valid
+func (s *PasswordResetService) SetInviteTTL(ttl time.Duration) {
+	s.inviteTTL = ttl
+}
+
+// SetResendInterval sets how old the last reset link must be before another request sends a new one
+func (s *PasswordResetService) SetResendInterval(interval time.Duration) {
+	s.resendAfter = interval
+}
+
+// RequestReset emails a reset link if the address belongs to a user.
+// Unknown addresses are silently ignored so the endpoint cannot be used to probe for accounts.
+// The token and email are handled in the background so that the response takes
+// as long for a registered address as for an unknown one.
+func (s *PasswordResetService) RequestReset(email string) error {
+	user, err := s.userService.GetUserByEmail(email)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		if err := s.sendReset(user); err != nil {
+			fmt.Printf("Error sending password reset email to %s: %v\n", user.Email, err)
+		}
+	}()
+	return nil
+}
+
+// sendReset emails a new reset link, unless one was sent within the resend interval.
+// Repeated requests would otherwise flood the inbox and keep invalidating the link
+// the user is about to open.
+func (s *PasswordResetService) sendReset(user *model.User) error {
+	ctx := context.Background()
+	recent, err := s.resetRepo.HasRecentToken(ctx, user.ID, time.Now().Add(-s.resendAfter))
+	if err != nil {
+		return err
+	}
+	if recent {
+		return nil
+	}
+	rawToken, err := s.issueToken(ctx, user, s.ttl)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nWe received a request to reset your password. Open the link below to choose a new one:\n\n%s?token=%s\n\nThe link expires in %s and can only be used once. If you did not request this, you can ignore this email.\n",
+			user.Name, s.resetURL, rawToken, s.ttl),
+	})
+}
+
+// SendInvite emails a new user, created without a password they know, a link to choose one.
+// It is a password reset link that stays valid for the invite TTL.
+func (s *PasswordResetService) SendInvite(user *model.User) error {
+	ctx := context.Background()
+	rawToken, err := s.issueToken(ctx, user, s.inviteTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your account is ready",
+		Body: fmt.Sprintf("Hi %s,\n\nAn account has been created for you. Open the link below to choose your password:\n\n%s?token=%s\n\nThe link expires in %s and can only be used once.\n",
+			user.Name, s.resetURL, rawToken, s.inviteTTL),
+	})
+}
+
+// issueToken stores a reset token for the user, valid for ttl, and returns it.
+// Only the newest token works; earlier ones are invalidated.
+func (s *PasswordResetService) issueToken(ctx context.Context, user *model.User, ttl time.Duration) (string, error) {
+	if err := s.resetRepo.InvalidateForUser(ctx, user.ID); err != nil {
+		return "", err
+	}
+
+	rawToken, err := utils.GenerateToken(32)
+	if err != nil {
+		return "", fmt.Errorf("error generating reset token: %w", err)
+	}
+	now := time.Now()
+	token := &model.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(rawToken),
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+	if err := s.resetRepo.CreateToken(ctx, token); err != nil {
+		return "", err
+	}
+	return rawToken, nil
+}
+
+// ResetPassword consumes the token, sets the new password and signs the user out everywhere.
+// A password rejected by the policy leaves the token usable for another try.
+func (s *PasswordResetService) ResetPassword(rawToken, newPassword string) (*model.User, error) {
+	ctx := context.Background()
+
+	token, err := s.resetRepo.FindByHash(ctx, utils.HashToken(rawToken))
+	if err != nil || token.UsedAt != nil || !time.Now().Before(token.ExpiresAt) {
+		return nil, ErrInvalidResetToken
+	}
+	user, err := s.userService.GetUser(token.UserID)
+	if err != nil {
+		return nil, ErrInvalidResetToken
+	}
+	if err := s.userService.CheckNewPassword(user, newPassword); err != nil {
+		return nil, err
+	}
+
+	consumed, err := s.resetRepo.MarkUsed(ctx, token.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !consumed {
+		return nil, ErrInvalidResetToken
+	}
+	// Whoever holds the emailed token acts as the user. The token is spent, so a
+	// concurrent change to the profile is re-read rather than failing the reset.
+	for attempt := 0; ; attempt++ {
+		err = s.userService.ChangePassword(user, newPassword, user.ID)
+		if !errors.Is(err, repository.ErrVersionConflict) || attempt == 2 {
+			break
+		}
+		if user, err = s.userService.GetUser(token.UserID); err != nil {
+			return nil, err
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Existing sessions may belong to whoever knew the old password
+	if _, err := s.sessions.RevokeAll(token.UserID); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-fiber-app/mailer"
+	model "go-fiber-app/models"
+	"go-fiber-app/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// recordingMailer keeps the messages it was asked to send
+type recordingMailer struct {
+	sent []mailer.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func TestPasswordResetServiceSendReset(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	user := &model.User{ID: primitive.NewObjectID(), Name: "Nimal", Email: "nimal@example.com"}
+	newService := func(mt *mtest.T, m mailer.Mailer) *PasswordResetService {
+		return NewPasswordResetService(repository.NewPasswordResetRepository(mt.DB), nil, nil, m, time.Hour, "http://localhost/reset")
+	}
+
+	mt.Run("keeps a link sent within the resend interval", func(mt *mtest.T) {
+		m := &recordingMailer{}
+		mt.AddMockResponses(countResponse(1))
+
+		if err := newService(mt, m).sendReset(user); err != nil {
+			mt.Fatalf("sendReset() error = %v", err)
+		}
+		if len(m.sent) != 0 {
+			mt.Errorf("%d emails sent, want none", len(m.sent))
+		}
+		if updates := commandsNamed(mt, "update"); len(updates) != 0 {
+			mt.Errorf("the earlier link was invalidated")
+		}
+	})
+
+	mt.Run("sends a new link once the last one is older", func(mt *mtest.T) {
+		m := &recordingMailer{}
+		mt.AddMockResponses(countResponse(0), updateResponse(1), mtest.CreateSuccessResponse())
+
+		if err := newService(mt, m).sendReset(user); err != nil {
+			mt.Fatalf("sendReset() error = %v", err)
+		}
+		if len(m.sent) != 1 || m.sent[0].To != user.Email {
+			mt.Errorf("sent %+v, want one email to %s", m.sent, user.Email)
+		}
+		if inserts := commandsNamed(mt, "insert"); len(inserts) != 1 {
+			mt.Errorf("%d tokens stored, want 1", len(inserts))
+		}
+	})
+}
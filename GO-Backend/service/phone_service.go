@@ -10,14 +10,46 @@ import (
 )
 
 type PhoneService struct {
-	phoneRepo *repository.PhoneRepository
+	phoneRepo   *repository.PhoneRepository
+	userService *UserService
 }
 
 func NewPhoneService(phoneRepo *repository.PhoneRepository) *PhoneService {
 	return &PhoneService{phoneRepo: phoneRepo}
 }
 
-func (s *PhoneService) CreatePhone(phone *model.PhoneNumber) error {
+// SetUserService keeps the user search index in step with phone number changes
+// and hides the phone numbers of deleted users
+func (s *PhoneService) SetUserService(userService *UserService) {
+	s.userService = userService
+}
+
+// checkUser makes sure the phone's owner exists and has not been deleted
+func (s *PhoneService) checkUser(userID primitive.ObjectID) error {
+	if s.userService == nil {
+		return nil
+	}
+	_, err := s.userService.GetUser(userID)
+	return err
+}
+
+// track reads the owner before a phone change by actor; the returned function
+// records the change in the owner's history once it has been made
+func (s *PhoneService) track(ctx context.Context, userID, actor primitive.ObjectID) func(change model.UserChange) {
+	if s.userService == nil {
+		return func(model.UserChange) {}
+	}
+	return s.userService.track(ctx, userID, actor)
+}
+
+func (s *PhoneService) reindexUser(userID primitive.ObjectID) {
+	if s.userService != nil {
+		s.userService.ReindexUser(userID)
+	}
+}
+
+// CreatePhone adds a phone number on behalf of actor
+func (s *PhoneService) CreatePhone(phone *model.PhoneNumber, actor primitive.ObjectID) error {
 	fmt.Printf("PhoneService.CreatePhone called with: %+v\n", phone)
 
 	if !phone.Validate() {
@@ -26,36 +58,76 @@ func (s *PhoneService) CreatePhone(phone *model.PhoneNumber) error {
 	}
 
 	fmt.Printf("Phone validation passed, calling repository...\n")
+	if err := s.checkUser(phone.UserID); err != nil {
+		return err
+	}
 	ctx := context.Background()
+	record := s.track(ctx, phone.UserID, actor)
 	if err := s.phoneRepo.CreatePhone(ctx, phone); err != nil {
 		fmt.Printf("Repository error: %v\n", err)
 		return err
 	}
+	record(model.UserChange{Action: model.ChangePhoneAdded})
 
 	fmt.Printf("Phone successfully created in repository\n")
+	s.reindexUser(phone.UserID)
 	return nil
 }
 
 func (s *PhoneService) GetPhonesByUser(userID primitive.ObjectID) ([]*model.PhoneNumber, error) {
+	if err := s.checkUser(userID); err != nil {
+		return nil, err
+	}
 	ctx := context.Background()
 	return s.phoneRepo.GetPhonesByUser(ctx, userID)
 }
 
-func (s *PhoneService) UpdatePhone(phone *model.PhoneNumber) error {
+func (s *PhoneService) GetPhone(userID, phoneID primitive.ObjectID) (*model.PhoneNumber, error) {
+	if err := s.checkUser(userID); err != nil {
+		return nil, err
+	}
+	return s.phoneRepo.GetPhone(context.Background(), userID, phoneID)
+}
+
+// UpdatePhone saves the phone on behalf of actor if its stored version is one ifMatch allows
+func (s *PhoneService) UpdatePhone(phone *model.PhoneNumber, actor primitive.ObjectID, ifMatch IfMatch) error {
 	if !phone.Validate() {
 		return fmt.Errorf("phone validation failed")
 	}
+	existing, err := s.GetPhone(phone.UserID, phone.ID)
+	if err != nil {
+		return err
+	}
+	if !ifMatch.Allows(existing.Version) {
+		return repository.ErrVersionConflict
+	}
+	phone.Version = existing.Version
 	ctx := context.Background()
+	record := s.track(ctx, phone.UserID, actor)
 	if err := s.phoneRepo.UpdatePhone(ctx, phone); err != nil {
 		return err
 	}
+	phone.Version++
+	record(model.UserChange{Action: model.ChangePhoneUpdated})
+	s.reindexUser(phone.UserID)
 	return nil
 }
 
-func (s *PhoneService) DeletePhone(userID, phoneID primitive.ObjectID) error {
+// DeletePhone removes the phone on behalf of actor if its stored version is one ifMatch allows
+func (s *PhoneService) DeletePhone(userID, phoneID, actor primitive.ObjectID, ifMatch IfMatch) error {
+	existing, err := s.GetPhone(userID, phoneID)
+	if err != nil {
+		return err
+	}
+	if !ifMatch.Allows(existing.Version) {
+		return repository.ErrVersionConflict
+	}
 	ctx := context.Background()
-	if err := s.phoneRepo.DeletePhone(ctx, userID, phoneID); err != nil {
+	record := s.track(ctx, userID, actor)
+	if err := s.phoneRepo.DeletePhone(ctx, userID, phoneID, existing.Version); err != nil {
 		return err
 	}
+	record(model.UserChange{Action: model.ChangePhoneRemoved})
+	s.reindexUser(userID)
 	return nil
 }
@@ -0,0 +1,24 @@
+package service
+
+import (
+	model "go-fiber-app/models"
+)
+
+// PolicyService decides whether a caller may act on a user's records.
+// Members may only act on their own records; admins may act on any record.
+// Denials are recorded as security events by middleware.RecordDenials.
+type PolicyService struct{}
+
+func NewPolicyService() *PolicyService {
+	return &PolicyService{}
+}
+
+// CanActOnUser reports whether the actor may read or modify the target user's records
+func (s *PolicyService) CanActOnUser(actorID string, actorRoles []string, targetUserID string) bool {
+	for _, role := range actorRoles {
+		if role == model.RoleAdmin {
+			return true
+		}
+	}
+	return actorID != "" && actorID == targetUserID
+}
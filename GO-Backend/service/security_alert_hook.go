@@ -0,0 +1,50 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// LogAlertHook prints alerts to the server log
+type LogAlertHook struct{}
+
+func (LogAlertHook) Alert(ctx context.Context, alert SecurityAlert) error {
+	fmt.Printf("SECURITY ALERT [%s] %s\n", alert.Rule, alert.Message)
+	return nil
+}
+
+// WebhookAlertHook posts alerts as JSON to a URL, e.g. a chat or incident tool
+type WebhookAlertHook struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewWebhookAlertHook(url string) *WebhookAlertHook {
+	return &WebhookAlertHook{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (h *WebhookAlertHook) Alert(ctx context.Context, alert SecurityAlert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("error encoding alert: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error building alert request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting alert: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("alert webhook responded with %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	model "go-fiber-app/models"
+	"go-fiber-app/repository"
+	"sync"
+	"time"
+)
+
+// Alert rules raised by the security event service
+const (
+	AlertFailuresAcrossAccounts = "failures_across_accounts"
+	AlertAccountLocked          = "account_locked"
+)
+
+// SecurityAlert describes a suspicious pattern spotted in the security events
+type SecurityAlert struct {
+	Rule     string               `json:"rule"`
+	Message  string               `json:"message"`
+	IP       string               `json:"ip,omitempty"`
+	Email    string               `json:"email,omitempty"`
+	Count    int                  `json:"count,omitempty"`
+	Event    *model.SecurityEvent `json:"event"`
+	RaisedAt time.Time            `json:"raised_at"`
+}
+
+// AlertHook is told about suspicious patterns, e.g. to page someone
+type AlertHook interface {
+	Alert(ctx context.Context, alert SecurityAlert) error
+}
+
+// SecurityAlertConfig controls when alerts are raised
+type SecurityAlertConfig struct {
+	FailedAccountsPerIP int           // distinct accounts failing from one IP before alerting
+	Window              time.Duration // how far back failures are counted; also the cooldown per IP
+}
+
+type SecurityEventService struct {
+	eventRepo *repository.SecurityEventRepository
+	hook      AlertHook
+	config    SecurityAlertConfig
+
+	mu      sync.Mutex
+	alerted map[string]time.Time // rule and IP -> last alert, so one attack raises one alert
+}
+
+func NewSecurityEventService(eventRepo *repository.SecurityEventRepository) *SecurityEventService {
+	return &SecurityEventService{eventRepo: eventRepo, alerted: map[string]time.Time{}}
+}
+
+// SetAlertHook turns on alerting for suspicious patterns
+func (s *SecurityEventService) SetAlertHook(hook AlertHook, config SecurityAlertConfig) {
+	s.hook = hook
+	s.config = config
+}
+
+// Record stores the event and checks it against the alert rules.
+// Failures are logged rather than returned so auditing never fails the request.
+func (s *SecurityEventService) Record(event *model.SecurityEvent) {
+	event.CreatedAt = time.Now()
+	if err := s.eventRepo.CreateEvent(context.Background(), event); err != nil {
+		fmt.Printf("Error recording security event: %v\n", err)
+		return
+	}
+	if s.hook != nil {
+		go s.checkAlerts(event)
+	}
+}
+
+// List returns the events matching the filter, newest first
+func (s *SecurityEventService) List(filter repository.SecurityEventFilter) ([]model.SecurityEvent, error) {
+	return s.eventRepo.FindEvents(context.Background(), filter)
+}
+
+func (s *SecurityEventService) checkAlerts(event *model.SecurityEvent) {
+	ctx := context.Background()
+
+	switch event.Type {
+	case model.EventAccountLocked:
+		s.raise(ctx, SecurityAlert{
+			Rule:    AlertAccountLocked,
+			Message: fmt.Sprintf("Account %s was locked after repeated failed logins", event.Email),
+			IP:      event.IP,
+			Email:   event.Email,
+			Event:   event,
+		})
+	case model.EventLoginFailure:
+		if event.IP == "" || s.config.FailedAccountsPerIP <= 0 {
+			return
+		}
+		if s.recentlyAlerted(AlertFailuresAcrossAccounts + ":" + event.IP) {
+			return
+		}
+		count, err := s.eventRepo.CountAccountsFailedFromIP(ctx, event.IP, event.CreatedAt.Add(-s.config.Window))
+		if err != nil {
+			fmt.Printf("Error checking security alerts: %v\n", err)
+			return
+		}
+		if count < s.config.FailedAccountsPerIP {
+			return
+		}
+		s.markAlerted(AlertFailuresAcrossAccounts + ":" + event.IP)
+		s.raise(ctx, SecurityAlert{
+			Rule:    AlertFailuresAcrossAccounts,
+			Message: fmt.Sprintf("%d accounts failed to log in from %s within %s", count, event.IP, s.config.Window),
+			IP:      event.IP,
+			Count:   count,
+			Event:   event,
+		})
+	}
+}
+
+func (s *SecurityEventService) raise(ctx context.Context, alert SecurityAlert) {
+	alert.RaisedAt = time.Now()
+	if err := s.hook.Alert(ctx, alert); err != nil {
+		fmt.Printf("Error sending security alert %s: %v\n", alert.Rule, err)
+	}
+}
+
+func (s *SecurityEventService) recentlyAlerted(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	last, ok := s.alerted[key]
+	return ok && time.Since(last) < s.config.Window
+}
+
+func (s *SecurityEventService) markAlerted(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for k, at := range s.alerted {
+		if now.Sub(at) >= s.config.Window {
+			delete(s.alerted, k)
+		}
+	}
+	s.alerted[key] = now
+}
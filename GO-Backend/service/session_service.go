@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	model "go-fiber-app/models"
+	"go-fiber-app/repository"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// lastSeenResolution limits how often an active session writes its last-seen time
+const lastSeenResolution = time.Minute
+
+var ErrSessionRevoked = errors.New("session has been revoked or has expired")
+
+// ClientInfo describes the device a login came from
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+// SessionService tracks where users are signed in. A session and its refresh
+// token family share the same ID, so ending one ends the other.
+type SessionService struct {
+	sessionRepo *repository.SessionRepository
+	refreshRepo *repository.RefreshTokenRepository
+}
+
+func NewSessionService(sessionRepo *repository.SessionRepository, refreshRepo *repository.RefreshTokenRepository) *SessionService {
+	return &SessionService{sessionRepo: sessionRepo, refreshRepo: refreshRepo}
+}
+
+// Start records a new login
+func (s *SessionService) Start(userID primitive.ObjectID, client ClientInfo, expiresAt time.Time) (*model.Session, error) {
+	now := time.Now()
+	session := &model.Session{
+		UserID:     userID,
+		UserAgent:  client.UserAgent,
+		IP:         client.IP,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  expiresAt,
+	}
+	if err := s.sessionRepo.CreateSession(context.Background(), session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Authorize checks the session behind an access token and records the activity
+func (s *SessionService) Authorize(sessionID, ip string) error {
+	ctx := context.Background()
+	id, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return ErrSessionRevoked
+	}
+
+	session, err := s.sessionRepo.FindByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrSessionRevoked
+		}
+		return err
+	}
+	now := time.Now()
+	if !session.IsActive(now) {
+		return ErrSessionRevoked
+	}
+
+	if now.Sub(session.LastSeenAt) >= lastSeenResolution || session.IP != ip {
+		if err := s.sessionRepo.TouchLastSeen(ctx, id, ip, now); err != nil {
+			fmt.Printf("Error recording session activity %s: %v\n", sessionID, err)
+		}
+	}
+	return nil
+}
+
+// List returns the user's active sessions and flags the one making the request
+func (s *SessionService) List(userID primitive.ObjectID, currentSessionID string) ([]model.Session, error) {
+	sessions, err := s.sessionRepo.ListActiveByUser(context.Background(), userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID.Hex() == currentSessionID
+	}
+	return sessions, nil
+}
+
+// Revoke signs one device out
+func (s *SessionService) Revoke(userID, sessionID primitive.ObjectID) error {
+	ctx := context.Background()
+	if err := s.sessionRepo.Revoke(ctx, userID, sessionID); err != nil {
+		return err
+	}
+	return s.refreshRepo.RevokeFamily(ctx, sessionID.Hex())
+}
+
+// RevokeAll signs the user out everywhere and returns how many sessions ended
+func (s *SessionService) RevokeAll(userID primitive.ObjectID) (int64, error) {
+	ctx := context.Background()
+	count, err := s.sessionRepo.RevokeAllForUser(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.refreshRepo.RevokeAllForUser(ctx, userID); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// active returns the session if it can still be used
+func (s *SessionService) active(ctx context.Context, sessionID string) (*model.Session, error) {
+	id, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return nil, ErrSessionRevoked
+	}
+	session, err := s.sessionRepo.FindByID(ctx, id)
+	if err != nil || !session.IsActive(time.Now()) {
+		return nil, ErrSessionRevoked
+	}
+	return session, nil
+}
+
+// extend keeps the session alive as long as its newest refresh token
+func (s *SessionService) extend(ctx context.Context, session *model.Session, expiresAt time.Time) error {
+	return s.sessionRepo.Extend(ctx, session.ID, expiresAt)
+}
+
+// end revokes a session after its refresh token family was revoked
+func (s *SessionService) end(ctx context.Context, userID primitive.ObjectID, sessionID string) error {
+	id, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return nil
+	}
+	if err := s.sessionRepo.Revoke(ctx, userID, id); err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-fiber-app/keyring"
+	model "go-fiber-app/models"
+	"go-fiber-app/repository"
+	"go-fiber-app/utils"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+// TokenPair is returned to clients after a successful login or refresh
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // access token lifetime in seconds
+}
+
+type TokenService struct {
+	refreshRepo *repository.RefreshTokenRepository
+	userRepo    *repository.UserRepository
+	sessions    *SessionService
+	keys        *keyring.KeyRing
+	accessTTL   time.Duration
+	refreshTTL  time.Duration
+}
+
+func NewTokenService(refreshRepo *repository.RefreshTokenRepository, userRepo *repository.UserRepository, sessions *SessionService, keys *keyring.KeyRing, accessTTL, refreshTTL time.Duration) *TokenService {
+	return &TokenService{
+		refreshRepo: refreshRepo,
+		userRepo:    userRepo,
+		sessions:    sessions,
+		keys:        keys,
+		accessTTL:   accessTTL,
+		refreshTTL:  refreshTTL,
+	}
+}
+
+// IssueTokens records a new session for the user and starts its refresh token family
+func (s *TokenService) IssueTokens(user *model.User, client ClientInfo) (*TokenPair, error) {
+	session, err := s.sessions.Start(user.ID, client, time.Now().Add(s.refreshTTL))
+	if err != nil {
+		return nil, err
+	}
+	return s.issue(context.Background(), user, session.ID.Hex())
+}
+
+// Refresh exchanges a refresh token for a new token pair. The presented token is
+// rotated; presenting it again revokes every token in its family.
+func (s *TokenService) Refresh(rawToken string) (*TokenPair, *model.User, error) {
+	ctx := context.Background()
+
+	stored, err := s.refreshRepo.FindByHash(ctx, utils.HashToken(rawToken))
+	if err != nil {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	if stored.RotatedAt != nil || stored.RevokedAt != nil {
+		// Someone is replaying an old token - assume it leaked and kill the whole chain
+		if err := s.revokeFamily(ctx, stored); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrRefreshTokenReused
+	}
+	if !stored.IsActive(time.Now()) {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	session, err := s.sessions.active(ctx, stored.FamilyID)
+	if err != nil {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	rotated, err := s.refreshRepo.MarkRotated(ctx, stored.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !rotated {
+		// Lost a race against another request using the same token
+		if err := s.revokeFamily(ctx, stored); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrRefreshTokenReused
+	}
+
+	user, err := s.userRepo.FindUserByID(ctx, stored.UserID)
+	if err != nil {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	pair, err := s.issue(ctx, user, stored.FamilyID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.sessions.extend(ctx, session, time.Now().Add(s.refreshTTL)); err != nil {
+		return nil, nil, err
+	}
+	return pair, user, nil
+}
+
+// Revoke ends the session the given refresh token belongs to and returns its user
+func (s *TokenService) Revoke(rawToken string) (primitive.ObjectID, error) {
+	ctx := context.Background()
+	stored, err := s.refreshRepo.FindByHash(ctx, utils.HashToken(rawToken))
+	if err != nil {
+		return primitive.NilObjectID, ErrInvalidRefreshToken
+	}
+	return stored.UserID, s.revokeFamily(ctx, stored)
+}
+
+func (s *TokenService) revokeFamily(ctx context.Context, stored *model.RefreshToken) error {
+	if err := s.refreshRepo.RevokeFamily(ctx, stored.FamilyID); err != nil {
+		return err
+	}
+	return s.sessions.end(ctx, stored.UserID, stored.FamilyID)
+}
+
+func (s *TokenService) issue(ctx context.Context, user *model.User, familyID string) (*TokenPair, error) {
+	accessToken, err := s.signAccessToken(user, familyID)
+	if err != nil {
+		return nil, fmt.Errorf("error signing access token: %w", err)
+	}
+
+	rawRefresh, err := utils.GenerateToken(32)
+	if err != nil {
+		return nil, fmt.Errorf("error generating refresh token: %w", err)
+	}
+
+	now := time.Now()
+	refresh := &model.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: utils.HashToken(rawRefresh),
+		ExpiresAt: now.Add(s.refreshTTL),
+		CreatedAt: now,
+	}
+	if err := s.refreshRepo.CreateToken(ctx, refresh); err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: rawRefresh,
+		ExpiresIn:    int64(s.accessTTL.Seconds()),
+	}, nil
+}
+
+func (s *TokenService) signAccessToken(user *model.User, sessionID string) (string, error) {
+	claims := jwt.MapClaims{
+		"user_id":            user.ID.Hex(),
+		"sid":                sessionID,
+		"email":              user.Email,
+		"roles":              user.EffectiveRoles(),
+		"email_verified":     user.EmailVerified,
+		"two_factor_enabled": user.TwoFactorEnabled,
+		"exp":                time.Now().Add(s.accessTTL).Unix(),
+	}
+	return s.keys.Sign(claims)
+}
@@ -0,0 +1,272 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go-fiber-app/keyring"
+	model "go-fiber-app/models"
+	"go-fiber-app/repository"
+	"go-fiber-app/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// testKeyRing returns a key ring with one fresh Ed25519 signing key
+func testKeyRing(t *testing.T) *keyring.KeyRing {
+	t.Helper()
+	dir := t.TempDir()
+	if err := keyring.GenerateEd25519(dir, "test"); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := keyring.Load(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+// toDoc converts a model to the document a mocked find returns
+func toDoc(t *testing.T, v interface{}) bson.D {
+	t.Helper()
+	data, err := bson.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc bson.D
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func findResponse(collection string, docs ...bson.D) bson.D {
+	return mtest.CreateCursorResponse(0, "test."+collection, mtest.FirstBatch, docs...)
+}
+
+func updateResponse(modified int) bson.D {
+	return mtest.CreateSuccessResponse(bson.E{Key: "n", Value: modified}, bson.E{Key: "nModified", Value: modified})
+}
+
+// updateFilter returns the filter of the first statement of an update command
+func updateFilter(command bson.Raw) bson.Raw {
+	return command.Lookup("updates").Array().Index(0).Value().Document().Lookup("q").Document()
+}
+
+// commandNames lists the commands the mocked client sent, in order
+func commandNames(mt *mtest.T) []string {
+	var names []string
+	for _, event := range mt.GetAllStartedEvents() {
+		names = append(names, event.CommandName)
+	}
+	return names
+}
+
+// commandsNamed returns the commands with the given name, in the order they were sent
+func commandsNamed(mt *mtest.T, name string) []bson.Raw {
+	var commands []bson.Raw
+	for _, event := range mt.GetAllStartedEvents() {
+		if event.CommandName == name {
+			commands = append(commands, event.Command)
+		}
+	}
+	return commands
+}
+
+func newTestTokenService(mt *mtest.T, keys *keyring.KeyRing) *TokenService {
+	refreshRepo := repository.NewRefreshTokenRepository(mt.DB)
+	sessions := NewSessionService(repository.NewSessionRepository(mt.DB), refreshRepo)
+	return NewTokenService(refreshRepo, repository.NewUserRepository(mt.DB), sessions, keys, time.Minute, time.Hour)
+}
+
+func TestTokenServiceRefresh(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	keys := testKeyRing(t)
+
+	user := model.User{ID: primitive.NewObjectID(), Email: "nimal@example.com"}
+	now := time.Now()
+	earlier := now.Add(-time.Minute)
+	session := model.Session{ID: primitive.NewObjectID(), UserID: user.ID, CreatedAt: earlier, ExpiresAt: now.Add(time.Hour)}
+	family := session.ID.Hex()
+	revokedSession := session
+	revokedSession.RevokedAt = &earlier
+
+	token := func(change func(*model.RefreshToken)) bson.D {
+		stored := &model.RefreshToken{
+			ID:        primitive.NewObjectID(),
+			UserID:    user.ID,
+			FamilyID:  family,
+			TokenHash: utils.HashToken("raw-token"),
+			ExpiresAt: now.Add(time.Hour),
+			CreatedAt: earlier,
+		}
+		change(stored)
+		return findResponse("refresh_tokens", toDoc(mt.T, stored))
+	}
+	unchanged := func(*model.RefreshToken) {}
+
+	tests := []struct {
+		name      string
+		responses []bson.D
+		wantErr   error
+		commands  []string
+	}{
+		{
+			name: "active token is rotated within its session",
+			responses: []bson.D{
+				token(unchanged),
+				findResponse("sessions", toDoc(mt.T, session)),
+				updateResponse(1),
+				findResponse("users", toDoc(mt.T, user)),
+				mtest.CreateSuccessResponse(),
+				updateResponse(1),
+			},
+			commands: []string{"find", "find", "update", "find", "insert", "update"},
+		},
+		{
+			name:      "unknown token",
+			responses: []bson.D{findResponse("refresh_tokens")},
+			wantErr:   ErrInvalidRefreshToken,
+			commands:  []string{"find"},
+		},
+		{
+			name:      "expired token",
+			responses: []bson.D{token(func(r *model.RefreshToken) { r.ExpiresAt = earlier })},
+			wantErr:   ErrInvalidRefreshToken,
+			commands:  []string{"find"},
+		},
+		{
+			name:      "token of a revoked session",
+			responses: []bson.D{token(unchanged), findResponse("sessions", toDoc(mt.T, revokedSession))},
+			wantErr:   ErrInvalidRefreshToken,
+			commands:  []string{"find", "find"},
+		},
+		{
+			name:      "token without a session",
+			responses: []bson.D{token(func(r *model.RefreshToken) { r.FamilyID = "family-1" })},
+			wantErr:   ErrInvalidRefreshToken,
+			commands:  []string{"find"},
+		},
+		{
+			name:      "replayed rotated token revokes the family and its session",
+			responses: []bson.D{token(func(r *model.RefreshToken) { r.RotatedAt = &earlier }), updateResponse(1), updateResponse(1)},
+			wantErr:   ErrRefreshTokenReused,
+			commands:  []string{"find", "update", "update"},
+		},
+		{
+			name:      "revoked token revokes the family and its session",
+			responses: []bson.D{token(func(r *model.RefreshToken) { r.RevokedAt = &earlier }), updateResponse(1), updateResponse(0)},
+			wantErr:   ErrRefreshTokenReused,
+			commands:  []string{"find", "update", "update"},
+		},
+		{
+			name: "losing a rotation race revokes the family and its session",
+			responses: []bson.D{
+				token(unchanged),
+				findResponse("sessions", toDoc(mt.T, session)),
+				updateResponse(0),
+				updateResponse(1),
+				updateResponse(1),
+			},
+			wantErr:  ErrRefreshTokenReused,
+			commands: []string{"find", "find", "update", "update", "update"},
+		},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			s := newTestTokenService(mt, keys)
+			mt.AddMockResponses(tt.responses...)
+
+			pair, got, err := s.Refresh("raw-token")
+			if !errors.Is(err, tt.wantErr) {
+				mt.Fatalf("Refresh() error = %v, want %v", err, tt.wantErr)
+			}
+			if names := commandNames(mt); !reflect.DeepEqual(names, tt.commands) {
+				mt.Fatalf("commands = %v, want %v", names, tt.commands)
+			}
+			updates := commandsNamed(mt, "update")
+
+			if tt.wantErr == ErrRefreshTokenReused {
+				// The last two updates revoke every live token of the family, then its session
+				revoke := updateFilter(updates[len(updates)-2])
+				if got := revoke.Lookup("family_id").StringValue(); got != family {
+					mt.Errorf("revoked family %q, want %q", got, family)
+				}
+				end := updates[len(updates)-1]
+				if coll := end.Lookup("update").StringValue(); coll != "sessions" {
+					mt.Errorf("last update went to %q, want sessions", coll)
+				}
+				if got := updateFilter(end).Lookup("_id").ObjectID(); got != session.ID {
+					mt.Errorf("ended session %s, want %s", got.Hex(), session.ID.Hex())
+				}
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			if got.ID != user.ID || pair.AccessToken == "" || pair.RefreshToken == "" || pair.RefreshToken == "raw-token" {
+				mt.Fatalf("Refresh() = %+v, %+v", pair, got)
+			}
+			parsed, err := keys.Parse(pair.AccessToken)
+			if err != nil {
+				mt.Fatalf("access token does not verify against the key ring: %v", err)
+			}
+			if sid := parsed.Claims.(jwt.MapClaims)["sid"]; sid != family {
+				mt.Errorf("access token sid = %v, want %s", sid, family)
+			}
+			// Rotation only matches a token nobody has used yet
+			rotate := updateFilter(updates[0])
+			if rotate.Lookup("rotated_at").Type != bson.TypeNull || rotate.Lookup("revoked_at").Type != bson.TypeNull {
+				mt.Errorf("rotation filter %s does not require an unused token", rotate)
+			}
+			// The new token continues the family and only its hash is stored
+			inserted := commandsNamed(mt, "insert")[0].Lookup("documents").Array().Index(0).Value().Document()
+			if got := inserted.Lookup("family_id").StringValue(); got != family {
+				mt.Errorf("new token family = %q, want %q", got, family)
+			}
+			if hash := inserted.Lookup("token_hash").StringValue(); hash != utils.HashToken(pair.RefreshToken) {
+				mt.Errorf("stored hash %q is not the hash of the returned token", hash)
+			}
+			// The session lives as long as its newest refresh token
+			if coll := updates[1].Lookup("update").StringValue(); coll != "sessions" {
+				mt.Errorf("session extended in %q, want sessions", coll)
+			}
+		})
+	}
+}
+
+func TestTokenServiceRevoke(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	keys := testKeyRing(t)
+
+	mt.Run("known token ends its session", func(mt *mtest.T) {
+		s := newTestTokenService(mt, keys)
+		stored := model.RefreshToken{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID(), FamilyID: primitive.NewObjectID().Hex(), TokenHash: utils.HashToken("raw"), ExpiresAt: time.Now().Add(time.Hour)}
+		mt.AddMockResponses(findResponse("refresh_tokens", toDoc(mt.T, stored)), updateResponse(2), updateResponse(1))
+
+		userID, err := s.Revoke("raw")
+		if err != nil {
+			mt.Fatalf("Revoke() error = %v", err)
+		}
+		if userID != stored.UserID {
+			mt.Errorf("Revoke() user = %s, want %s", userID.Hex(), stored.UserID.Hex())
+		}
+		if names := commandNames(mt); !reflect.DeepEqual(names, []string{"find", "update", "update"}) {
+			mt.Errorf("commands = %v, want [find update update]", names)
+		}
+	})
+
+	mt.Run("unknown token", func(mt *mtest.T) {
+		s := newTestTokenService(mt, keys)
+		mt.AddMockResponses(findResponse("refresh_tokens"))
+
+		if _, err := s.Revoke("raw"); !errors.Is(err, ErrInvalidRefreshToken) {
+			mt.Errorf("Revoke() error = %v, want %v", err, ErrInvalidRefreshToken)
+		}
+	})
+}
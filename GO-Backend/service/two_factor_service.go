@@ -0,0 +1,375 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	model "go-fiber-app/models"
+	"go-fiber-app/repository"
+	"go-fiber-app/utils"
+	"image/png"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	twoFactorChallengePurpose = "2fa_challenge"
+	totpPeriod                = 30
+	totpSkew                  = 1 // accept codes one period either side of now
+	backupCodeCount           = 10
+	settingsCacheTTL          = time.Minute
+)
+
+var (
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrNoPendingEnrollment     = errors.New("no two-factor enrollment in progress")
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+	ErrInvalidChallenge        = errors.New("invalid or expired two-factor challenge")
+)
+
+// TwoFactorEnrollment is returned when a user starts setting up an authenticator app
+type TwoFactorEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+	QRCodePNG  []byte `json:"qr_code_png"` // base64 encoded in JSON
+}
+
+type TwoFactorService struct {
+	userRepo      *repository.UserRepository
+	settingsRepo  *repository.SettingsRepository
+	challengeRepo *repository.TwoFactorChallengeRepository
+	issuer        string
+	secret        []byte // signs challenge tokens
+	challengeTTL  time.Duration
+
+	mu             sync.Mutex
+	settings       *model.SecuritySettings
+	settingsLoaded time.Time
+}
+
+func NewTwoFactorService(userRepo *repository.UserRepository, settingsRepo *repository.SettingsRepository, challengeRepo *repository.TwoFactorChallengeRepository, issuer, secret string, challengeTTL time.Duration) *TwoFactorService {
+	return &TwoFactorService{
+		userRepo:      userRepo,
+		settingsRepo:  settingsRepo,
+		challengeRepo: challengeRepo,
+		issuer:        issuer,
+		secret:        []byte(secret),
+		challengeTTL:  challengeTTL,
+	}
+}
+
+// BeginEnrollment creates a new secret for the user. It only becomes active
+// once ConfirmEnrollment receives a valid code generated from it.
+func (s *TwoFactorService) BeginEnrollment(userID primitive.ObjectID) (*TwoFactorEnrollment, error) {
+	ctx := context.Background()
+	user, err := s.userRepo.FindUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      s.issuer,
+		AccountName: user.Email,
+		Period:      totpPeriod,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error generating two-factor secret: %w", err)
+	}
+
+	img, err := key.Image(256, 256)
+	if err != nil {
+		return nil, fmt.Errorf("error generating QR code: %w", err)
+	}
+	var qr bytes.Buffer
+	if err := png.Encode(&qr, img); err != nil {
+		return nil, fmt.Errorf("error encoding QR code: %w", err)
+	}
+
+	if err := s.userRepo.SetTwoFactorPendingSecret(ctx, userID, key.Secret()); err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorEnrollment{
+		Secret:     key.Secret(),
+		OTPAuthURI: key.URL(),
+		QRCodePNG:  qr.Bytes(),
+	}, nil
+}
+
+// ConfirmEnrollment turns 2FA on after the first valid code and returns the
+// plain backup codes. They are shown once; only bcrypt hashes are stored.
+func (s *TwoFactorService) ConfirmEnrollment(userID primitive.ObjectID, code string) ([]string, error) {
+	ctx := context.Background()
+	user, err := s.userRepo.FindUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	if user.TwoFactorPendingSecret == "" {
+		return nil, ErrNoPendingEnrollment
+	}
+
+	step, ok := matchTOTP(user.TwoFactorPendingSecret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes, hashes, err := generateBackupCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.userRepo.EnableTwoFactor(ctx, userID, user.TwoFactorPendingSecret, hashes, step); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable turns 2FA off after checking a current code or a backup code
+func (s *TwoFactorService) Disable(userID primitive.ObjectID, code string) error {
+	ctx := context.Background()
+	user, err := s.userRepo.FindUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !user.TwoFactorEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+	if err := s.VerifyCode(user, code); err != nil {
+		return err
+	}
+	return s.userRepo.DisableTwoFactor(ctx, userID)
+}
+
+// VerifyCode accepts either a TOTP code (each time step only once) or an unused backup code
+func (s *TwoFactorService) VerifyCode(user *model.User, code string) error {
+	ctx := context.Background()
+	code = strings.TrimSpace(code)
+
+	if step, ok := matchTOTP(user.TwoFactorSecret, code, time.Now()); ok {
+		fresh, err := s.userRepo.AdvanceTwoFactorStep(ctx, user.ID, step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+
+	normalized := normalizeBackupCode(code)
+	for _, hash := range user.TwoFactorBackupCodes {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(normalized)) == nil {
+			consumed, err := s.userRepo.ConsumeBackupCode(ctx, user.ID, hash)
+			if err != nil {
+				return err
+			}
+			if consumed {
+				return nil
+			}
+		}
+	}
+	return ErrInvalidTwoFactorCode
+}
+
+// CreateChallenge issues a short-lived token proving the password step succeeded.
+// Its jti lets ConsumeChallenge make it single-use.
+func (s *TwoFactorService) CreateChallenge(user *model.User) (string, error) {
+	id, err := utils.GenerateToken(16)
+	if err != nil {
+		return "", fmt.Errorf("error generating challenge ID: %w", err)
+	}
+	claims := jwt.MapClaims{
+		"purpose": twoFactorChallengePurpose,
+		"sub":     user.ID.Hex(),
+		"jti":     id,
+		"exp":     time.Now().Add(s.challengeTTL).Unix(),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+}
+
+// ChallengeTTL is the lifetime of challenge tokens
+func (s *TwoFactorService) ChallengeTTL() time.Duration {
+	return s.challengeTTL
+}
+
+// ResolveChallenge returns the user a challenge token was issued for
+func (s *TwoFactorService) ResolveChallenge(challenge string) (*model.User, error) {
+	claims, err := s.parseChallenge(challenge)
+	if err != nil {
+		return nil, err
+	}
+	subject, _ := claims["sub"].(string)
+	userID, err := primitive.ObjectIDFromHex(subject)
+	if err != nil {
+		return nil, ErrInvalidChallenge
+	}
+
+	user, err := s.userRepo.FindUserByID(context.Background(), userID)
+	if err != nil || !user.TwoFactorEnabled {
+		return nil, ErrInvalidChallenge
+	}
+	return user, nil
+}
+
+// ConsumeChallenge marks a challenge token as used once its code was accepted.
+// A token that was already used returns ErrInvalidChallenge, so a captured
+// challenge and code cannot complete a second login.
+func (s *TwoFactorService) ConsumeChallenge(challenge string) error {
+	claims, err := s.parseChallenge(challenge)
+	if err != nil {
+		return err
+	}
+	id, _ := claims["jti"].(string)
+	expiresAt, err := claims.GetExpirationTime()
+	if id == "" || err != nil || expiresAt == nil {
+		return ErrInvalidChallenge
+	}
+
+	fresh, err := s.challengeRepo.MarkUsed(context.Background(), &model.UsedTwoFactorChallenge{
+		ID:        id,
+		UsedAt:    time.Now(),
+		ExpiresAt: expiresAt.Time,
+	})
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrInvalidChallenge
+	}
+	return nil
+}
+
+// parseChallenge checks a challenge token's signature, expiry and purpose
+func (s *TwoFactorService) parseChallenge(challenge string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(challenge, func(t *jwt.Token) (interface{}, error) {
+		return s.secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidChallenge
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != twoFactorChallengePurpose {
+		return nil, ErrInvalidChallenge
+	}
+	return claims, nil
+}
+
+// GetPolicy returns the roles that must use two-factor authentication
+func (s *TwoFactorService) GetPolicy() (*model.SecuritySettings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.settings != nil && time.Since(s.settingsLoaded) < settingsCacheTTL {
+		return s.settings, nil
+	}
+	settings, err := s.settingsRepo.GetSecuritySettings(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	s.settings = settings
+	s.settingsLoaded = time.Now()
+	return settings, nil
+}
+
+// SetRequiredRoles changes which roles must use two-factor authentication
+func (s *TwoFactorService) SetRequiredRoles(roles []string) (*model.SecuritySettings, error) {
+	for _, role := range roles {
+		if !model.IsValidRole(role) {
+			return nil, ErrInvalidRole
+		}
+	}
+
+	settings, err := s.settingsRepo.GetSecuritySettings(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	settings.TwoFactorRequiredRoles = roles
+	settings.UpdatedAt = time.Now()
+	if err := s.settingsRepo.SaveSecuritySettings(context.Background(), settings); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.settings = settings
+	s.settingsLoaded = time.Now()
+	s.mu.Unlock()
+	return settings, nil
+}
+
+// IsRequiredForRoles reports whether any of the roles must use two-factor authentication
+func (s *TwoFactorService) IsRequiredForRoles(roles []string) (bool, error) {
+	settings, err := s.GetPolicy()
+	if err != nil {
+		return false, err
+	}
+	for _, required := range settings.TwoFactorRequiredRoles {
+		for _, role := range roles {
+			if role == required {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// matchTOTP checks the code against the current period and its neighbours and
+// returns the matching time step
+func matchTOTP(secret, code string, now time.Time) (int64, bool) {
+	if secret == "" || len(code) != 6 {
+		return 0, false
+	}
+	opts := totp.ValidateOpts{Period: totpPeriod, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1}
+	for offset := -totpSkew; offset <= totpSkew; offset++ {
+		at := now.Add(time.Duration(offset*totpPeriod) * time.Second)
+		expected, err := totp.GenerateCodeCustom(secret, at, opts)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return at.Unix() / totpPeriod, true
+		}
+	}
+	return 0, false
+}
+
+// generateBackupCodes returns plain codes formatted as xxxxx-xxxxx and their hashes
+func generateBackupCodes() ([]string, []string, error) {
+	codes := make([]string, 0, backupCodeCount)
+	hashes := make([]string, 0, backupCodeCount)
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	for i := 0; i < backupCodeCount; i++ {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, fmt.Errorf("error generating backup code: %w", err)
+		}
+		raw := strings.ToLower(encoding.EncodeToString(b))[:10]
+		hash, err := bcrypt.GenerateFromPassword([]byte(raw), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error hashing backup code: %w", err)
+		}
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, string(hash))
+	}
+	return codes, hashes, nil
+}
+
+func normalizeBackupCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(code, "-", ""))
+}
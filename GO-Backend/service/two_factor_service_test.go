@@ -0,0 +1,184 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	model "go-fiber-app/models"
+	"go-fiber-app/repository"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors, base32 encoded
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestMatchTOTP(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		now      int64 // Unix seconds
+		wantStep int64
+		wantOK   bool
+	}{
+		// Codes are the last six digits of the RFC 6238 SHA-1 vectors
+		{"RFC 6238 at 59", "287082", 59, 1, true},
+		{"RFC 6238 at 1111111109", "081804", 1111111109, 37037036, true},
+		{"RFC 6238 at 1234567890", "005924", 1234567890, 41152263, true},
+		{"RFC 6238 at 2000000000", "279037", 2000000000, 66666666, true},
+		{"start of the period", "287082", 30, 1, true},
+		{"one period late", "287082", 89, 1, true},
+		{"one period early", "287082", 29, 1, true},
+		{"two periods late", "287082", 119, 0, false},
+		{"two periods early", "279037", 2000000000 - 60, 0, false},
+		{"wrong code", "287083", 59, 0, false},
+		{"too short", "28708", 59, 0, false},
+		{"eight digits", "94287082", 59, 0, false},
+		{"empty", "", 59, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := matchTOTP(rfc6238Secret, tt.code, time.Unix(tt.now, 0))
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("matchTOTP(%q at %d) = %d, %v, want %d, %v", tt.code, tt.now, step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+
+	if _, ok := matchTOTP("", "287082", time.Unix(59, 0)); ok {
+		t.Error("matchTOTP accepted a code without a secret")
+	}
+	if _, ok := matchTOTP("not base32!", "287082", time.Unix(59, 0)); ok {
+		t.Error("matchTOTP accepted a code for an invalid secret")
+	}
+}
+
+// The step a code matched is what VerifyCode stores to reject a replay, so a
+// code accepted late must report its own step, not the current one
+func TestMatchTOTPStepIsReplayable(t *testing.T) {
+	first, ok := matchTOTP(rfc6238Secret, "287082", time.Unix(59, 0))
+	if !ok {
+		t.Fatal("code not accepted in its own period")
+	}
+	late, ok := matchTOTP(rfc6238Secret, "287082", time.Unix(89, 0))
+	if !ok {
+		t.Fatal("code not accepted one period late")
+	}
+	if first != late {
+		t.Errorf("the same code matched step %d and then %d", first, late)
+	}
+}
+
+func TestBackupCodes(t *testing.T) {
+	codes, hashes, err := generateBackupCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != backupCodeCount || len(hashes) != backupCodeCount {
+		t.Fatalf("got %d codes and %d hashes, want %d", len(codes), len(hashes), backupCodeCount)
+	}
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if len(code) != 11 || code[5] != '-' || code != strings.ToLower(code) {
+			t.Errorf("code %q is not formatted as xxxxx-xxxxx", code)
+		}
+		if seen[code] {
+			t.Errorf("code %q issued twice", code)
+		}
+		seen[code] = true
+		if bcrypt.CompareHashAndPassword([]byte(hashes[i]), []byte(normalizeBackupCode(code))) != nil {
+			t.Errorf("hash %d does not match code %q", i, code)
+		}
+	}
+
+	tests := []struct {
+		input, want string
+	}{
+		{"abcde-fghij", "abcdefghij"},
+		{"ABCDE-FGHIJ", "abcdefghij"},
+		{"abcdefghij", "abcdefghij"},
+		{"ab-cde-fghij", "abcdefghij"},
+	}
+	for _, tt := range tests {
+		if got := normalizeBackupCode(tt.input); got != tt.want {
+			t.Errorf("normalizeBackupCode(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestTwoFactorServiceConsumeChallenge(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	user := &model.User{ID: primitive.NewObjectID(), TwoFactorEnabled: true}
+	newService := func(mt *mtest.T) *TwoFactorService {
+		return NewTwoFactorService(repository.NewUserRepository(mt.DB), repository.NewSettingsRepository(mt.DB), repository.NewTwoFactorChallengeRepository(mt.DB), "test", "challenge-secret", time.Minute)
+	}
+
+	mt.Run("first use", func(mt *mtest.T) {
+		s := newService(mt)
+		challenge, err := s.CreateChallenge(user)
+		if err != nil {
+			mt.Fatal(err)
+		}
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		if err := s.ConsumeChallenge(challenge); err != nil {
+			mt.Fatalf("ConsumeChallenge() error = %v", err)
+		}
+		used := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+		if used.Lookup("_id").StringValue() == "" || used.Lookup("expires_at").Time().Before(time.Now()) {
+			mt.Errorf("recorded %s, want the challenge ID and its expiry", used)
+		}
+	})
+
+	mt.Run("second use", func(mt *mtest.T) {
+		s := newService(mt)
+		challenge, err := s.CreateChallenge(user)
+		if err != nil {
+			mt.Fatal(err)
+		}
+		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key"}))
+
+		if err := s.ConsumeChallenge(challenge); !errors.Is(err, ErrInvalidChallenge) {
+			mt.Errorf("ConsumeChallenge() error = %v, want %v", err, ErrInvalidChallenge)
+		}
+	})
+
+	mt.Run("challenges are not interchangeable", func(mt *mtest.T) {
+		s := newService(mt)
+		first, _ := s.CreateChallenge(user)
+		second, _ := s.CreateChallenge(user)
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+		s.ConsumeChallenge(first)
+		s.ConsumeChallenge(second)
+
+		events := mt.GetAllStartedEvents()
+		id := func(i int) string {
+			return events[i].Command.Lookup("documents").Array().Index(0).Value().Document().Lookup("_id").StringValue()
+		}
+		if id(0) == id(1) {
+			mt.Errorf("two challenges share the ID %q", id(0))
+		}
+	})
+
+	mt.Run("tokens without an ID or with another purpose", func(mt *mtest.T) {
+		s := newService(mt)
+		exp := time.Now().Add(time.Minute).Unix()
+		for _, claims := range []jwt.MapClaims{
+			{"purpose": twoFactorChallengePurpose, "sub": user.ID.Hex(), "exp": exp},
+			{"purpose": "email_verification", "sub": user.ID.Hex(), "jti": "x", "exp": exp},
+		} {
+			token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("challenge-secret"))
+			if err := s.ConsumeChallenge(token); !errors.Is(err, ErrInvalidChallenge) {
+				mt.Errorf("ConsumeChallenge(%v) error = %v, want %v", claims, err, ErrInvalidChallenge)
+			}
+		}
+		if names := commandNames(mt); len(names) != 0 {
+			mt.Errorf("commands = %v, want none", names)
+		}
+	})
+}
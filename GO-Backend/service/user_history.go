@@ -0,0 +1,330 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	model "go-fiber-app/models"
+	"go-fiber-app/repository"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrRevisionNotFound is returned when reverting to a revision the user's history does not have
+var ErrRevisionNotFound = errors.New("revision not found in the user's history")
+
+// SetHistoryRepository turns on the change history. Every change made through
+// UserService and PhoneService is then recorded with who made it.
+func (s *UserService) SetHistoryRepository(history *repository.UserHistoryRepository) {
+	s.history = history
+}
+
+// History returns up to limit of the user's changes, newest first, starting below
+// the given revision when it is non-zero. Deleted users keep their history until purged.
+func (s *UserService) History(id primitive.ObjectID, before, limit int64) ([]model.UserChange, error) {
+	ctx := context.Background()
+	if _, err := s.userRepo.FindUserByIDIncludingDeleted(ctx, id); err != nil {
+		return nil, err
+	}
+	if s.history == nil {
+		return []model.UserChange{}, nil
+	}
+	return s.history.FindChanges(ctx, id, before, limit)
+}
+
+// track reads the user before a change on behalf of actor. The returned function
+// records the change once it has been made.
+func (s *UserService) track(ctx context.Context, id, actor primitive.ObjectID) func(change model.UserChange) {
+	if s.history == nil {
+		return func(model.UserChange) {}
+	}
+	before, err := s.snapshotUser(ctx, id)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			fmt.Printf("Error reading user %s for the change history: %v\n", id.Hex(), err)
+		}
+		return func(model.UserChange) {}
+	}
+	return func(change model.UserChange) {
+		s.recordChange(ctx, id, actor, before, change)
+	}
+}
+
+// recordChange stores the change with the field differences between before (nil
+// for a new user) and the user now. A change that altered nothing is not recorded.
+// Failures are logged rather than returned so the history never fails the change itself.
+func (s *UserService) recordChange(ctx context.Context, id, actor primitive.ObjectID, before *model.UserSnapshot, change model.UserChange) {
+	if s.history == nil {
+		return
+	}
+	after, err := s.snapshotUser(ctx, id)
+	if err != nil {
+		fmt.Printf("Error reading user %s for the change history: %v\n", id.Hex(), err)
+		return
+	}
+	if before == nil {
+		before = &model.UserSnapshot{}
+	}
+	change.Changes = append(diffSnapshots(before, after), change.Changes...)
+	if len(change.Changes) == 0 {
+		return
+	}
+	change.UserID = id
+	if !actor.IsZero() {
+		change.ActorID = &actor
+	}
+	change.Snapshot = *after
+	change.CreatedAt = time.Now()
+	if err := s.history.AddChange(ctx, &change); err != nil {
+		fmt.Printf("Error recording change history for user %s: %v\n", id.Hex(), err)
+	}
+}
+
+// snapshotUser captures the user, deleted or not, with their phone numbers
+func (s *UserService) snapshotUser(ctx context.Context, id primitive.ObjectID) (*model.UserSnapshot, error) {
+	user, err := s.userRepo.FindUserByIDIncludingDeleted(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &model.UserSnapshot{
+		Name:                user.Name,
+		Email:               user.Email,
+		NIC:                 user.NIC,
+		Address:             user.Address,
+		Birthday:            user.Birthday,
+		Gender:              user.Gender,
+		Photo:               user.Photo,
+		Roles:               user.Roles,
+		Phones:              []model.PhoneSnapshot{},
+		DeletionScheduledAt: user.DeletionScheduledAt,
+		Deleted:             user.DeletedAt != nil,
+	}
+	if s.phoneRepo != nil {
+		phones, err := s.phoneRepo.GetPhonesByUser(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		for _, phone := range phones {
+			snapshot.Phones = append(snapshot.Phones, model.PhoneSnapshot{ID: phone.ID, Number: phone.Number, Type: phone.Type})
+		}
+	}
+	return snapshot, nil
+}
+
+// diffSnapshots lists the fields that differ between two snapshots. Phone numbers
+// are reported per phone as phones.<id>.number and phones.<id>.type.
+func diffSnapshots(before, after *model.UserSnapshot) []model.FieldChange {
+	var changes []model.FieldChange
+	diff := func(field, from, to string) {
+		if from != to {
+			changes = append(changes, model.FieldChange{Field: field, From: from, To: to})
+		}
+	}
+	diff("name", before.Name, after.Name)
+	diff("email", before.Email, after.Email)
+	diff("nic", before.NIC, after.NIC)
+	diff("address", before.Address, after.Address)
+	diff("birthday", formatDate(before.Birthday), formatDate(after.Birthday))
+	diff("gender", before.Gender, after.Gender)
+	diff("photo", before.Photo, after.Photo)
+	diff("roles", formatRoles(before.Roles), formatRoles(after.Roles))
+
+	old := map[primitive.ObjectID]model.PhoneSnapshot{}
+	for _, phone := range before.Phones {
+		old[phone.ID] = phone
+	}
+	for _, phone := range after.Phones {
+		prev := old[phone.ID]
+		delete(old, phone.ID)
+		diff("phones."+phone.ID.Hex()+".number", prev.Number, phone.Number)
+		diff("phones."+phone.ID.Hex()+".type", prev.Type, phone.Type)
+	}
+	for _, phone := range before.Phones {
+		if _, removed := old[phone.ID]; removed {
+			diff("phones."+phone.ID.Hex()+".number", phone.Number, "")
+			diff("phones."+phone.ID.Hex()+".type", phone.Type, "")
+		}
+	}
+
+	diff("deletion_scheduled_at", formatTime(before.DeletionScheduledAt), formatTime(after.DeletionScheduledAt))
+	diff("deleted", strconv.FormatBool(before.Deleted), strconv.FormatBool(after.Deleted))
+	return changes
+}
+
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// formatRoles lists roles in a fixed order, so reordering them is not a change
+func formatRoles(roles []string) string {
+	sorted := append([]string(nil), roles...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ", ")
+}
+
+// RevertUser puts the user's profile, roles and phone numbers back the way they
+// were at the given revision, on behalf of actor. It returns the reverted user and
+// the names of the profile fields that changed, so a new email can be verified.
+// Deletion state is not reverted; a deleted user has to be restored first. A photo
+// is only brought back if its file has not been removed since. The revert itself
+// is recorded as a new revision.
+func (s *UserService) RevertUser(id, actor primitive.ObjectID, revision int64) (*model.User, []string, error) {
+	ctx := context.Background()
+	existing, err := s.userRepo.FindUserByID(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if s.history == nil {
+		return nil, nil, ErrRevisionNotFound
+	}
+	entry, err := s.history.FindRevision(ctx, id, revision)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil, ErrRevisionNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	target := entry.Snapshot
+
+	user := *existing
+	user.Name = target.Name
+	user.Email = target.Email
+	user.NIC = target.NIC
+	user.Address = target.Address
+	user.Birthday = target.Birthday
+	user.Gender = target.Gender
+	if target.Photo == "" || photoExists(target.Photo) {
+		user.Photo = target.Photo
+	}
+	normalizeIdentifiers(&user)
+	if user.Email != existing.Email {
+		// A changed address has to be verified again
+		user.EmailVerified = false
+		user.EmailVerifiedAt = nil
+	}
+	if user.NIC != "" {
+		if err := s.checkNIC(&user); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	set, unset, changed := profileChanges(existing, &user)
+	if formatRoles(target.Roles) != formatRoles(existing.Roles) {
+		if existing.HasRole(model.RoleAdmin) && !hasRole(target.Roles, model.RoleAdmin) {
+			admins, err := s.userRepo.CountUsersWithRole(ctx, model.RoleAdmin)
+			if err != nil {
+				return nil, nil, err
+			}
+			if admins <= 1 {
+				return nil, nil, ErrLastAdmin
+			}
+		}
+		if len(target.Roles) > 0 {
+			set["roles"] = target.Roles
+		} else {
+			unset = append(unset, "roles")
+		}
+	}
+
+	record := s.track(ctx, id, actor)
+	err = s.transactions.Run(ctx, func(ctx context.Context) error {
+		if len(set) > 0 || len(unset) > 0 {
+			if err := s.userRepo.UpdateUserFields(ctx, id, existing.Version, set, unset); err != nil {
+				return err
+			}
+		}
+		return s.revertPhones(ctx, id, target.Phones)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if existing.Photo != "" && user.Photo != existing.Photo {
+		removePhoto(existing.Photo)
+	}
+	record(model.UserChange{Action: model.ChangeReverted, RevertedTo: revision})
+	s.ReindexUser(id)
+	reverted, err := s.GetUser(id)
+	return reverted, changed, err
+}
+
+// revertPhones makes the user's phone numbers match the snapshot. Phones removed
+// since are added back under a new ID.
+func (s *UserService) revertPhones(ctx context.Context, userID primitive.ObjectID, target []model.PhoneSnapshot) error {
+	if s.phoneRepo == nil {
+		return nil
+	}
+	current, err := s.phoneRepo.GetPhonesByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	wanted := map[primitive.ObjectID]model.PhoneSnapshot{}
+	for _, phone := range target {
+		wanted[phone.ID] = phone
+	}
+
+	// Removals go first so a number can move back to a phone that was re-added
+	for _, phone := range current {
+		if _, keep := wanted[phone.ID]; !keep {
+			if err := s.phoneRepo.DeletePhone(ctx, userID, phone.ID, phone.Version); err != nil {
+				return err
+			}
+		}
+	}
+	for _, phone := range current {
+		want, keep := wanted[phone.ID]
+		delete(wanted, phone.ID)
+		if !keep || (want.Number == phone.Number && want.Type == phone.Type) {
+			continue
+		}
+		phone.Number, phone.Type = want.Number, want.Type
+		if err := s.phoneRepo.UpdatePhone(ctx, phone); err != nil {
+			return err
+		}
+	}
+	for _, phone := range target {
+		if _, missing := wanted[phone.ID]; !missing {
+			continue
+		}
+		restored := &model.PhoneNumber{Number: phone.Number, Type: phone.Type, UserID: userID}
+		if err := s.phoneRepo.CreatePhone(ctx, restored); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// photoExists reports whether an uploaded photo's file is still there
+func photoExists(photo string) bool {
+	if !strings.HasPrefix(photo, "/uploads/") {
+		return false
+	}
+	_, err := os.Stat(filepath.Join(photoDir, filepath.Base(photo)))
+	return err == nil
+}
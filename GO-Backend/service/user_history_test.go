@@ -0,0 +1,220 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	model "go-fiber-app/models"
+	"go-fiber-app/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	kept, changed, removed, added := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	scheduled := time.Date(2026, 5, 1, 8, 30, 0, 0, time.UTC)
+	before := &model.UserSnapshot{
+		Name:     "Nimal Perera",
+		Email:    "nimal@example.com",
+		Birthday: time.Date(1990, 4, 14, 0, 0, 0, 0, time.UTC),
+		Roles:    []string{model.RoleMember, model.RoleAdmin},
+		Phones: []model.PhoneSnapshot{
+			{ID: kept, Number: "0711234567", Type: "mobile"},
+			{ID: changed, Number: "0112345678", Type: "home"},
+			{ID: removed, Number: "0771234567", Type: "work"},
+		},
+	}
+	after := &model.UserSnapshot{
+		Name:     "Nimal Perera",
+		Email:    "nimal.perera@example.com",
+		Birthday: time.Date(1990, 4, 14, 0, 0, 0, 0, time.UTC),
+		Roles:    []string{model.RoleAdmin, model.RoleMember},
+		Phones: []model.PhoneSnapshot{
+			{ID: kept, Number: "0711234567", Type: "mobile"},
+			{ID: changed, Number: "0112345679", Type: "home"},
+			{ID: added, Number: "0761234567", Type: "mobile"},
+		},
+		DeletionScheduledAt: &scheduled,
+	}
+
+	want := []model.FieldChange{
+		{Field: "email", From: "nimal@example.com", To: "nimal.perera@example.com"},
+		{Field: "phones." + changed.Hex() + ".number", From: "0112345678", To: "0112345679"},
+		{Field: "phones." + added.Hex() + ".number", From: "", To: "0761234567"},
+		{Field: "phones." + added.Hex() + ".type", From: "", To: "mobile"},
+		{Field: "phones." + removed.Hex() + ".number", From: "0771234567", To: ""},
+		{Field: "phones." + removed.Hex() + ".type", From: "work", To: ""},
+		{Field: "deletion_scheduled_at", From: "", To: "2026-05-01T08:30:00Z"},
+	}
+	if got := diffSnapshots(before, after); !reflect.DeepEqual(got, want) {
+		t.Errorf("diffSnapshots() =\n%v\nwant\n%v", got, want)
+	}
+
+	// A new user is diffed against an empty snapshot, so every set field shows up
+	created := diffSnapshots(&model.UserSnapshot{}, &model.UserSnapshot{Name: "Kamal", Birthday: before.Birthday})
+	wantCreated := []model.FieldChange{{Field: "name", To: "Kamal"}, {Field: "birthday", To: "1990-04-14"}}
+	if !reflect.DeepEqual(created, wantCreated) {
+		t.Errorf("diffSnapshots() of a new user = %v, want %v", created, wantCreated)
+	}
+	if got := diffSnapshots(after, after); len(got) != 0 {
+		t.Errorf("diffSnapshots() of identical snapshots = %v, want none", got)
+	}
+}
+
+func newTestHistoryService(mt *mtest.T) *UserService {
+	s := NewUserService(repository.NewUserRepository(mt.DB))
+	s.SetHistoryRepository(repository.NewUserHistoryRepository(mt.DB))
+	return s
+}
+
+func TestUserServiceRevertUser(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	existing := model.User{
+		ID:            primitive.NewObjectID(),
+		Name:          "Nimal Perera",
+		Email:         "nimal.perera@example.com",
+		EmailVerified: true,
+		Address:       "12 Galle Road",
+		Roles:         []string{model.RoleAdmin, model.RoleMember},
+		Version:       5,
+	}
+	revision := func(snapshot model.UserSnapshot) bson.D {
+		entry := model.UserChange{ID: primitive.NewObjectID(), UserID: existing.ID, Revision: 2, Snapshot: snapshot}
+		return findResponse("user_history", toDoc(mt.T, entry))
+	}
+	demoted := model.UserSnapshot{Name: "Nimal", Email: "nimal@example.com", Roles: []string{model.RoleMember}}
+
+	mt.Run("restores the profile and roles and records the revert", func(mt *mtest.T) {
+		s := newTestHistoryService(mt)
+		reverted := existing
+		reverted.Name, reverted.Email, reverted.Address, reverted.Roles = demoted.Name, demoted.Email, "", demoted.Roles
+		mt.AddMockResponses(
+			findResponse("users", toDoc(mt.T, existing)),
+			revision(demoted),
+			countResponse(2), // admins left after the demotion
+			findResponse("users", toDoc(mt.T, existing)),
+			updateResponse(1),
+			findResponse("users", toDoc(mt.T, reverted)),
+			findResponse("user_history", bson.D{{Key: "revision", Value: 3}}),
+			mtest.CreateSuccessResponse(),
+			findResponse("users", toDoc(mt.T, reverted)),
+		)
+
+		user, changed, err := s.RevertUser(existing.ID, primitive.NewObjectID(), 2)
+		if err != nil {
+			mt.Fatalf("RevertUser() error = %v", err)
+		}
+		if user.Name != "Nimal" {
+			mt.Errorf("RevertUser() = %+v", user)
+		}
+		// The caller sends a verification email when the address changed
+		if want := []string{"name", "email", "address"}; !reflect.DeepEqual(changed, want) {
+			mt.Errorf("RevertUser() changed %v, want %v", changed, want)
+		}
+
+		update := commandsNamed(mt, "update")[0].Lookup("updates").Array().Index(0).Value().Document()
+		if version := update.Lookup("q", "version").Int64(); version != existing.Version {
+			mt.Errorf("update expects version %d, want %d", version, existing.Version)
+		}
+		set := update.Lookup("u", "$set").Document()
+		if set.Lookup("name").StringValue() != "Nimal" || set.Lookup("email").StringValue() != "nimal@example.com" {
+			mt.Errorf("$set = %s", set)
+		}
+		// A changed address has to be verified again
+		if set.Lookup("email_verified").Boolean() {
+			mt.Errorf("$set = %s keeps the new address verified", set)
+		}
+		if roles := set.Lookup("roles").Array(); roles.Index(0).Value().StringValue() != model.RoleMember {
+			mt.Errorf("$set roles = %s, want [member]", roles)
+		}
+		if _, err := update.LookupErr("u", "$unset", "address"); err != nil {
+			mt.Errorf("address missing from the snapshot is not unset: %s", update)
+		}
+
+		change := commandsNamed(mt, "insert")[0].Lookup("documents").Array().Index(0).Value().Document()
+		if action := change.Lookup("action").StringValue(); action != model.ChangeReverted {
+			mt.Errorf("recorded action %q, want %q", action, model.ChangeReverted)
+		}
+		if to := change.Lookup("reverted_to").Int64(); to != 2 {
+			mt.Errorf("recorded reverted_to %d, want 2", to)
+		}
+		if next := change.Lookup("revision").Int64(); next != 4 {
+			mt.Errorf("recorded revision %d, want 4", next)
+		}
+	})
+
+	mt.Run("unknown revision", func(mt *mtest.T) {
+		s := newTestHistoryService(mt)
+		mt.AddMockResponses(findResponse("users", toDoc(mt.T, existing)), findResponse("user_history"))
+
+		if _, _, err := s.RevertUser(existing.ID, primitive.NewObjectID(), 9); !errors.Is(err, ErrRevisionNotFound) {
+			mt.Errorf("RevertUser() error = %v, want %v", err, ErrRevisionNotFound)
+		}
+	})
+
+	mt.Run("cannot demote the last admin", func(mt *mtest.T) {
+		s := newTestHistoryService(mt)
+		mt.AddMockResponses(findResponse("users", toDoc(mt.T, existing)), revision(demoted), countResponse(1))
+
+		if _, _, err := s.RevertUser(existing.ID, primitive.NewObjectID(), 2); !errors.Is(err, ErrLastAdmin) {
+			mt.Errorf("RevertUser() error = %v, want %v", err, ErrLastAdmin)
+		}
+		if updates := commandsNamed(mt, "update"); len(updates) != 0 {
+			mt.Errorf("%d updates sent, want none", len(updates))
+		}
+	})
+}
+
+func TestUserServiceRevertPhones(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	userID := primitive.NewObjectID()
+	kept := model.PhoneNumber{ID: primitive.NewObjectID(), UserID: userID, Number: "0711234567", Type: "mobile", Version: 1}
+	changed := model.PhoneNumber{ID: primitive.NewObjectID(), UserID: userID, Number: "0112345679", Type: "home", Version: 3}
+	added := model.PhoneNumber{ID: primitive.NewObjectID(), UserID: userID, Number: "0761234567", Type: "mobile", Version: 2}
+	removedID := primitive.NewObjectID()
+
+	mt.Run("matches the phones to the snapshot", func(mt *mtest.T) {
+		s := NewUserService(repository.NewUserRepository(mt.DB))
+		s.SetPhoneRepository(repository.NewPhoneRepository(mt.DB))
+		mt.AddMockResponses(
+			findResponse("phones", toDoc(mt.T, kept), toDoc(mt.T, changed), toDoc(mt.T, added)),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			updateResponse(1),
+			mtest.CreateSuccessResponse(),
+		)
+
+		target := []model.PhoneSnapshot{
+			{ID: kept.ID, Number: kept.Number, Type: kept.Type},
+			{ID: changed.ID, Number: "0112345678", Type: "home"},
+			{ID: removedID, Number: "0771234567", Type: "work"},
+		}
+		if err := s.revertPhones(mt.Context(), userID, target); err != nil {
+			mt.Fatalf("revertPhones() error = %v", err)
+		}
+
+		// The phone added since goes first, then the changed one is put back and the removed one re-added
+		if names := commandNames(mt); !reflect.DeepEqual(names, []string{"find", "delete", "update", "insert"}) {
+			mt.Fatalf("commands = %v, want [find delete update insert]", names)
+		}
+		deleted := commandsNamed(mt, "delete")[0].Lookup("deletes").Array().Index(0).Value().Document()
+		if id := deleted.Lookup("q", "_id").ObjectID(); id != added.ID {
+			mt.Errorf("deleted phone %s, want %s", id.Hex(), added.ID.Hex())
+		}
+		update := commandsNamed(mt, "update")[0].Lookup("updates").Array().Index(0).Value().Document()
+		if update.Lookup("q", "_id").ObjectID() != changed.ID || update.Lookup("q", "version").Int64() != changed.Version {
+			mt.Errorf("update filter = %s, want phone %s at version %d", update.Lookup("q"), changed.ID.Hex(), changed.Version)
+		}
+		if number := update.Lookup("u", "$set", "number").StringValue(); number != "0112345678" {
+			mt.Errorf("phone number reverted to %q, want 0112345678", number)
+		}
+		restored := commandsNamed(mt, "insert")[0].Lookup("documents").Array().Index(0).Value().Document()
+		if restored.Lookup("number").StringValue() != "0771234567" || restored.Lookup("user_id").ObjectID() != userID {
+			mt.Errorf("re-added phone = %s", restored)
+		}
+	})
+}
@@ -0,0 +1,426 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	model "go-fiber-app/models"
+	"go-fiber-app/repository"
+	"go-fiber-app/utils"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrInvalidImport is returned for an import file or column mapping that cannot be used at all
+var ErrInvalidImport = errors.New("invalid import")
+
+// ImportFields are the user fields an import file can fill, each read from the
+// column with the same name unless the column mapping says otherwise
+var ImportFields = []string{"name", "email", "nic", "address", "birthday", "gender", "password"}
+
+// requiredImportColumns must be present in every import file. Without a
+// password column every imported user is invited to choose one.
+var requiredImportColumns = []string{"name", "email", "nic", "birthday", "gender"}
+
+// A running import saves its progress after this many rows, or this long, whichever comes first
+const (
+	importProgressRows     = 25
+	importProgressInterval = 2 * time.Second
+)
+
+// ImportReport is the outcome of a dry run: what importing the file would do
+type ImportReport struct {
+	Total   int                    `json:"total"`
+	Valid   int                    `json:"valid"`
+	Invalid int                    `json:"invalid"`
+	Invites int                    `json:"invites"` // Valid rows without a password, whose users would be invited
+	Errors  []model.ImportRowError `json:"errors"`
+}
+
+// importRow is a row that passed validation and can be created
+type importRow struct {
+	line     int
+	user     *model.User
+	password string // Empty when the user is to be invited
+}
+
+// UserImportService creates users in bulk from CSV and XLSX files. Rows are checked
+// with the same rules as UserService.CreateUser, and imports run as background jobs.
+type UserImportService struct {
+	users        *UserService
+	jobs         *repository.ImportJobRepository
+	invites      *PasswordResetService
+	verification *EmailVerificationService
+	maxRows      int
+}
+
+func NewUserImportService(users *UserService, jobs *repository.ImportJobRepository) *UserImportService {
+	return &UserImportService{users: users, jobs: jobs, maxRows: 5000}
+}
+
+// SetInviteService lets rows without a password through; their users are emailed a link to choose one
+func (s *UserImportService) SetInviteService(invites *PasswordResetService) {
+	s.invites = invites
+}
+
+// SetEmailVerificationService sends imported users the same verification email as users created one by one
+func (s *UserImportService) SetEmailVerificationService(verification *EmailVerificationService) {
+	s.verification = verification
+}
+
+// SetMaxRows limits how many data rows one file may have
+func (s *UserImportService) SetMaxRows(maxRows int) {
+	s.maxRows = maxRows
+}
+
+// ImportFile is an uploaded import file read into a header and data rows
+type ImportFile struct {
+	Name        string
+	header      []string
+	rows        [][]string
+	spreadsheet bool // XLSX, where dates may be stored as serial numbers
+}
+
+// ReadImportFile reads a .csv file, or the first sheet of a .xlsx file
+func (s *UserImportService) ReadImportFile(name string, r io.Reader) (*ImportFile, error) {
+	file := &ImportFile{Name: name}
+	var records [][]string
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", name, err)
+		}
+		// Spreadsheet programs often save CSV with a byte order mark
+		reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+		reader.FieldsPerRecord = -1
+		if records, err = reader.ReadAll(); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+		}
+	case ".xlsx":
+		workbook, err := excelize.OpenReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+		}
+		defer workbook.Close()
+		if records, err = workbook.GetRows(workbook.GetSheetName(0), excelize.Options{RawCellValue: true}); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+		}
+		file.spreadsheet = true
+	default:
+		return nil, fmt.Errorf("%w: the file must be .csv or .xlsx", ErrInvalidImport)
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%w: the file is empty", ErrInvalidImport)
+	}
+	file.header, file.rows = records[0], records[1:]
+	if len(file.rows) > s.maxRows {
+		return nil, fmt.Errorf("%w: the file has %d rows, more than the limit of %d", ErrInvalidImport, len(file.rows), s.maxRows)
+	}
+	return file, nil
+}
+
+// columns finds the column of each field. mapping names the column header to use
+// for a field; other fields use the column named after them. Headers are matched
+// ignoring case and surrounding spaces.
+func (f *ImportFile) columns(mapping map[string]string) (map[string]int, error) {
+	known := map[string]bool{}
+	for _, field := range ImportFields {
+		known[field] = true
+	}
+	for field := range mapping {
+		if !known[field] {
+			return nil, fmt.Errorf("%w: unknown field %q in the column mapping; use %s", ErrInvalidImport, field, strings.Join(ImportFields, ", "))
+		}
+	}
+
+	index := map[string]int{}
+	for i, header := range f.header {
+		index[strings.ToLower(strings.TrimSpace(header))] = i
+	}
+	columns := map[string]int{}
+	for _, field := range ImportFields {
+		header, mapped := mapping[field]
+		if !mapped {
+			header = field
+		}
+		if i, ok := index[strings.ToLower(strings.TrimSpace(header))]; ok {
+			columns[field] = i
+		} else if mapped {
+			return nil, fmt.Errorf("%w: no column %q for %s", ErrInvalidImport, header, field)
+		}
+	}
+	for _, field := range requiredImportColumns {
+		if _, ok := columns[field]; !ok {
+			return nil, fmt.Errorf("%w: no %s column; name one in the column mapping", ErrInvalidImport, field)
+		}
+	}
+	return columns, nil
+}
+
+// DryRun validates every row without creating anyone
+func (s *UserImportService) DryRun(file *ImportFile, mapping map[string]string) (*ImportReport, error) {
+	rows, rowErrors, total, err := s.validate(file, mapping)
+	if err != nil {
+		return nil, err
+	}
+	report := &ImportReport{Total: total, Valid: len(rows), Invalid: total - len(rows), Errors: rowErrors}
+	for _, row := range rows {
+		if row.password == "" {
+			report.Invites++
+		}
+	}
+	return report, nil
+}
+
+// StartImport validates the file and creates its valid rows in the background on
+// behalf of actor. Poll Job for progress; invalid rows are reported as errors.
+func (s *UserImportService) StartImport(file *ImportFile, mapping map[string]string, actor primitive.ObjectID) (*model.ImportJob, error) {
+	rows, rowErrors, total, err := s.validate(file, mapping)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	job := &model.ImportJob{
+		Status:    model.ImportQueued,
+		FileName:  file.Name,
+		Total:     total,
+		Processed: len(rowErrors),
+		Failed:    len(rowErrors),
+		Errors:    rowErrors,
+		StartedBy: actor,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.jobs.CreateJob(context.Background(), job); err != nil {
+		return nil, err
+	}
+	snapshot := *job
+	go s.run(job, rows, actor)
+	return &snapshot, nil
+}
+
+// Job returns an import job, or mongo.ErrNoDocuments
+func (s *UserImportService) Job(id primitive.ObjectID) (*model.ImportJob, error) {
+	return s.jobs.FindJob(context.Background(), id)
+}
+
+// FailStaleJobs marks jobs that stopped making progress, because the server running them went down, as failed
+func (s *UserImportService) FailStaleJobs(staleAfter time.Duration) (int64, error) {
+	return s.jobs.FailStaleJobs(context.Background(), time.Now().Add(-staleAfter))
+}
+
+func (s *UserImportService) run(job *model.ImportJob, rows []importRow, actor primitive.ObjectID) {
+	ctx := context.Background()
+	job.Status = model.ImportRunning
+	s.saveProgress(ctx, job)
+
+	for _, row := range rows {
+		invited, err := s.createUser(row, actor)
+		job.Processed++
+		switch {
+		case err != nil:
+			job.Failed++
+			job.Errors = append(job.Errors, rowError(row.line, err))
+		case invited:
+			job.Invited++
+			fallthrough
+		default:
+			job.Created++
+		}
+		if job.Processed%importProgressRows == 0 || time.Since(job.UpdatedAt) >= importProgressInterval {
+			s.saveProgress(ctx, job)
+		}
+	}
+
+	finished := time.Now()
+	job.Status = model.ImportCompleted
+	job.FinishedAt = &finished
+	s.saveProgress(ctx, job)
+}
+
+func (s *UserImportService) saveProgress(ctx context.Context, job *model.ImportJob) {
+	job.UpdatedAt = time.Now()
+	if err := s.jobs.SaveProgress(ctx, job); err != nil {
+		fmt.Printf("Error saving progress of import job %s: %v\n", job.ID.Hex(), err)
+	}
+}
+
+// createUser saves one validated row. Users without a password get an unusable
+// random one and an invite to choose their own. It reports whether the user was invited.
+func (s *UserImportService) createUser(row importRow, actor primitive.ObjectID) (bool, error) {
+	password := row.password
+	if password == "" {
+		random, err := utils.GenerateToken(32)
+		if err != nil {
+			return false, err
+		}
+		password = random
+	}
+	hash, err := s.users.HashPassword(password)
+	if err != nil {
+		return false, err
+	}
+	user := *row.user
+	user.Password = hash
+	if err := s.users.CreateUser(&user, actor); err != nil {
+		return false, err
+	}
+
+	if s.verification != nil {
+		if err := s.verification.SendVerification(&user); err != nil {
+			fmt.Printf("Error sending verification email to %s: %v\n", user.Email, err)
+		}
+	}
+	if row.password != "" {
+		return false, nil
+	}
+	if err := s.invites.SendInvite(&user); err != nil {
+		// The user exists; an admin can send a password reset instead
+		fmt.Printf("Error sending invite to %s: %v\n", user.Email, err)
+	}
+	return true, nil
+}
+
+// validate checks every non-empty data row with the rules CreateUser applies, and
+// also against the other rows and the existing users for clashing emails and NICs.
+// It returns the valid rows, an error per invalid row and the number of rows checked.
+func (s *UserImportService) validate(file *ImportFile, mapping map[string]string) ([]importRow, []model.ImportRowError, int, error) {
+	columns, err := file.columns(mapping)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	ctx := context.Background()
+
+	valid := []importRow{}
+	rowErrors := []model.ImportRowError{}
+	total := 0
+	emails := map[string]int{}
+	nics := map[string]int{}
+	for i, record := range file.rows {
+		line := i + 2 // the header is row 1
+		if blankRecord(record) {
+			continue
+		}
+		total++
+		cell := func(field string) string {
+			if c, ok := columns[field]; ok && c < len(record) {
+				return strings.TrimSpace(record[c])
+			}
+			return ""
+		}
+
+		row, fieldErr := s.buildRow(file, cell)
+		if fieldErr == nil {
+			fieldErr = s.checkUnique(ctx, row, emails, nics)
+		}
+		if fieldErr != nil {
+			fieldErr.Row = line
+			rowErrors = append(rowErrors, *fieldErr)
+			continue
+		}
+		row.line = line
+		emails[strings.ToLower(row.user.Email)] = line
+		nics[row.user.NICNormalized] = line
+		valid = append(valid, row)
+	}
+	return valid, rowErrors, total, nil
+}
+
+// buildRow turns one row's cells into a user, or explains what is wrong with it
+func (s *UserImportService) buildRow(file *ImportFile, cell func(field string) string) (importRow, *model.ImportRowError) {
+	user := &model.User{
+		Name:    cell("name"),
+		Email:   cell("email"),
+		NIC:     cell("nic"),
+		Address: cell("address"),
+		Gender:  cell("gender"),
+	}
+	row := importRow{user: user, password: cell("password")}
+
+	if value := cell("birthday"); value != "" {
+		birthday, err := parseImportDate(value, file.spreadsheet)
+		if err != nil {
+			return row, &model.ImportRowError{Field: "birthday", Message: "Invalid birthday format. Expected YYYY-MM-DD format"}
+		}
+		user.Birthday = birthday
+	}
+	if missing := user.MissingFields(); len(missing) > 0 {
+		return row, &model.ImportRowError{Field: missing[0], Message: strings.Join(missing, ", ") + " cannot be empty"}
+	}
+
+	normalizeIdentifiers(user)
+	if err := s.users.checkNIC(user); err != nil {
+		return row, &model.ImportRowError{Field: "nic", Message: err.Error()}
+	}
+
+	if row.password != "" {
+		if err := s.users.ValidatePassword(row.password, user.Name, user.Email, user.NIC); err != nil {
+			return row, &model.ImportRowError{Field: "password", Message: err.Error()}
+		}
+	} else if s.invites == nil {
+		return row, &model.ImportRowError{Field: "password", Message: "password cannot be empty, as invites are not available"}
+	}
+	return row, nil
+}
+
+// checkUnique rejects an email or NIC used by an earlier row or an existing user
+func (s *UserImportService) checkUnique(ctx context.Context, row importRow, emails, nics map[string]int) *model.ImportRowError {
+	if earlier, ok := emails[strings.ToLower(row.user.Email)]; ok {
+		return &model.ImportRowError{Field: "email", Message: fmt.Sprintf("same email as row %d", earlier)}
+	}
+	if earlier, ok := nics[row.user.NICNormalized]; ok {
+		return &model.ImportRowError{Field: "nic", Message: fmt.Sprintf("same NIC as row %d", earlier)}
+	}
+	checks := []struct{ field, key, value, message string }{
+		{"email", "email", row.user.Email, "A user with this email already exists"},
+		{"nic", "nic_normalized", row.user.NICNormalized, "A user with this NIC already exists"},
+	}
+	for _, check := range checks {
+		taken, err := s.users.userRepo.IsTaken(ctx, check.key, check.value)
+		if err != nil {
+			return &model.ImportRowError{Field: check.field, Message: err.Error()}
+		}
+		if taken {
+			return &model.ImportRowError{Field: check.field, Message: check.message}
+		}
+	}
+	return nil
+}
+
+// rowError describes a failure to create a validated row
+func rowError(line int, err error) model.ImportRowError {
+	if dup, ok := repository.IsDuplicateKey(err); ok {
+		return model.ImportRowError{Row: line, Field: dup.Field, Message: dup.Error()}
+	}
+	return model.ImportRowError{Row: line, Message: err.Error()}
+}
+
+// parseImportDate reads a YYYY-MM-DD date. Spreadsheets may also hold a date as
+// a serial number, which is what a date-formatted cell contains.
+func parseImportDate(value string, spreadsheet bool) (time.Time, error) {
+	if spreadsheet {
+		if serial, err := strconv.ParseFloat(value, 64); err == nil {
+			return excelize.ExcelDateToTime(serial, false)
+		}
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+func blankRecord(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
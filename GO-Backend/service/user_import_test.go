@@ -0,0 +1,140 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	model "go-fiber-app/models"
+	"go-fiber-app/repository"
+
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestImportFileColumns(t *testing.T) {
+	header := []string{" Full Name ", "EMAIL", "nic", "Date of Birth", "gender", "Notes"}
+
+	tests := []struct {
+		name    string
+		header  []string
+		mapping map[string]string
+		want    map[string]int
+		wantErr bool
+	}{
+		{
+			name:    "mapped and same-named columns, ignoring case and spaces",
+			header:  header,
+			mapping: map[string]string{"name": "full name", "birthday": "Date of Birth"},
+			want:    map[string]int{"name": 0, "email": 1, "nic": 2, "birthday": 3, "gender": 4},
+		},
+		{
+			name:   "optional columns are picked up by name",
+			header: []string{"name", "email", "nic", "birthday", "gender", "Password", "address"},
+			want:   map[string]int{"name": 0, "email": 1, "nic": 2, "birthday": 3, "gender": 4, "password": 5, "address": 6},
+		},
+		{name: "required column missing", header: header, mapping: map[string]string{"name": "Full Name"}, wantErr: true},
+		{name: "mapped column missing", header: header, mapping: map[string]string{"name": "Full Name", "birthday": "DOB"}, wantErr: true},
+		{name: "unknown field", header: header, mapping: map[string]string{"name": "Full Name", "birthday": "Date of Birth", "roles": "Notes"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := &ImportFile{header: tt.header}
+			got, err := file.columns(tt.mapping)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidImport) {
+					t.Errorf("columns() error = %v, want %v", err, ErrInvalidImport)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("columns() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("columns() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseImportDate(t *testing.T) {
+	birthday := time.Date(1990, time.December, 5, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		value       string
+		spreadsheet bool
+		want        time.Time
+		wantErr     bool
+	}{
+		{"ISO date", "1990-12-05", false, birthday, false},
+		{"ISO date in a spreadsheet", "1990-12-05", true, birthday, false},
+		{"serial number in a spreadsheet", "33212", true, birthday, false},
+		{"serial number in a CSV", "33212", false, time.Time{}, true},
+		{"other date format", "05/12/1990", false, time.Time{}, true},
+		{"no such day", "1990-02-30", false, time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseImportDate(tt.value, tt.spreadsheet)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseImportDate(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseImportDate(%q) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserImportServiceDryRunDuplicates(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	csv := strings.Join([]string{
+		"name,email,nic,birthday,gender,password",
+		"Nimal Perera,nimal@example.com,853400937V,1985-12-05,Male,Violet-Harbor-42",
+		"Kamal Silva,NIMAL@example.com,903660000V,1990-12-31,Male,Violet-Harbor-42",
+		"Sunil Fernando,sunil@example.com, 853400937v ,1985-12-05,Male,Violet-Harbor-42",
+		",,,,,",
+		"Saman Jayasuriya,saman@example.com,199034001234,1990-12-05,Male,Violet-Harbor-42",
+		"Ruwan Dias,ruwan@example.com,900010000V,1990-01-01,Male,Violet-Harbor-42",
+		"Amal Perera,amal@example.com,198534000937,1985-12-05,Male,Violet-Harbor-42",
+	}, "\n")
+
+	mt.Run("rows clashing with earlier rows or existing users", func(mt *mtest.T) {
+		s := NewUserImportService(NewUserService(repository.NewUserRepository(mt.DB)), repository.NewImportJobRepository(mt.DB))
+		// Only rows that pass the in-file checks ask the database, email then NIC
+		mt.AddMockResponses(
+			countResponse(0), countResponse(0), // row 2
+			countResponse(0), countResponse(0), // row 6
+			countResponse(1), // row 7: email already registered
+		)
+
+		file, err := s.ReadImportFile("users.csv", strings.NewReader(csv))
+		if err != nil {
+			mt.Fatalf("ReadImportFile() error = %v", err)
+		}
+		report, err := s.DryRun(file, nil)
+		if err != nil {
+			mt.Fatalf("DryRun() error = %v", err)
+		}
+
+		wantErrors := []model.ImportRowError{
+			{Row: 3, Field: "email", Message: "same email as row 2"},
+			{Row: 4, Field: "nic", Message: "same NIC as row 2"},
+			{Row: 7, Field: "email", Message: "A user with this email already exists"},
+			{Row: 8, Field: "nic", Message: "same NIC as row 2"}, // the same number in the 12-digit format
+		}
+		if report.Total != 6 || report.Valid != 2 || report.Invalid != 4 || report.Invites != 0 {
+			mt.Errorf("DryRun() = %+v, want 6 rows, 2 valid", report)
+		}
+		if !reflect.DeepEqual(report.Errors, wantErrors) {
+			mt.Errorf("DryRun() errors = %+v, want %+v", report.Errors, wantErrors)
+		}
+		if counts := commandsNamed(mt, "aggregate"); len(counts) != 5 {
+			mt.Errorf("%d uniqueness queries sent, want 5", len(counts))
+		}
+		if filter := commandsNamed(mt, "aggregate")[1].Lookup("pipeline").Array().Index(0).Value().Document().Lookup("$match"); filter.Document().Lookup("nic_normalized").StringValue() != "198534000937" {
+			mt.Errorf("NIC uniqueness query = %s", filter)
+		}
+	})
+}
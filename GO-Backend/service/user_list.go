@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	model "go-fiber-app/models"
+	"go-fiber-app/repository"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidListQuery = errors.New("invalid list query")
+
+const (
+	DefaultUserListLimit = 20
+	MaxUserListLimit     = 100
+)
+
+// userSortFields maps the sort names accepted by the API to bson fields
+var userSortFields = map[string]string{
+	"created":  "_id",
+	"name":     "name",
+	"email":    "email",
+	"birthday": "birthday",
+}
+
+// UserListParams are the raw listing options from the query string
+type UserListParams struct {
+	Limit        int
+	Cursor       string
+	Sort         string // created (default), name, email or birthday
+	Order        string // asc (default) or desc
+	Gender       string
+	BirthdayFrom string // YYYY-MM-DD
+	BirthdayTo   string // YYYY-MM-DD
+	EmailDomain  string
+	NICFlagged   bool
+	Deleted      bool // soft-deleted users instead of live ones
+}
+
+// Pagination describes a page of results and how to get the next one
+type Pagination struct {
+	Limit      int    `json:"limit"`
+	Sort       string `json:"sort"`
+	Order      string `json:"order"`
+	Total      int64  `json:"total"`
+	HasMore    bool   `json:"has_more"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	Next       string `json:"next,omitempty"` // URL of the next page, filled in by the handler
+}
+
+type UserPage struct {
+	Data       []*model.User `json:"data"`
+	Pagination Pagination    `json:"pagination"`
+}
+
+// listCursor is the decoded form of the opaque cursor handed to clients
+type listCursor struct {
+	Sort  string `json:"s"`
+	Order string `json:"o"`
+	Value string `json:"v,omitempty"`
+	ID    string `json:"id"`
+}
+
+// ListUsers returns one page of users
+func (s *UserService) ListUsers(params UserListParams) (*UserPage, error) {
+	return s.listUsers(params, false)
+}
+
+// ListUsersWithPhones returns one page of users with their phone numbers
+func (s *UserService) ListUsersWithPhones(params UserListParams) (*UserPage, error) {
+	return s.listUsers(params, true)
+}
+
+func (s *UserService) listUsers(params UserListParams, withPhones bool) (*UserPage, error) {
+	ctx := context.Background()
+	query, err := buildUserListQuery(&params)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fetch one extra user to learn whether another page follows
+	limit := query.Limit
+	query.Limit++
+	users, err := s.userRepo.ListUsers(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	total, err := s.userRepo.CountUsers(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &UserPage{Pagination: Pagination{Limit: int(limit), Sort: params.Sort, Order: params.Order, Total: total}}
+	if int64(len(users)) > limit {
+		users = users[:limit]
+		page.Pagination.HasMore = true
+		page.Pagination.NextCursor = encodeListCursor(params, users[len(users)-1])
+	}
+	if withPhones {
+		s.attachPhones(ctx, users)
+	}
+	page.Data = users
+	return page, nil
+}
+
+// attachPhones loads the phone numbers of each user, leaving an empty list when they cannot be loaded
+func (s *UserService) attachPhones(ctx context.Context, users []*model.User) {
+	for _, user := range users {
+		user.Phones = []*model.PhoneNumber{}
+		if s.phoneRepo == nil {
+			continue
+		}
+		phones, err := s.phoneRepo.GetPhonesByUser(ctx, user.ID)
+		if err != nil {
+			// Log the error but don't fail the request
+			fmt.Printf("Error fetching phones for user %s: %v\n", user.ID.Hex(), err)
+			continue
+		}
+		user.Phones = phones
+	}
+}
+
+// buildUserListQuery validates the params, filling in defaults, and turns them into a repository query
+func buildUserListQuery(params *UserListParams) (repository.UserListQuery, error) {
+	var query repository.UserListQuery
+
+	if params.Limit == 0 {
+		params.Limit = DefaultUserListLimit
+	}
+	if params.Limit < 1 || params.Limit > MaxUserListLimit {
+		return query, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidListQuery, MaxUserListLimit)
+	}
+	query.Limit = int64(params.Limit)
+
+	if params.Sort == "" {
+		params.Sort = "created"
+	}
+	field, ok := userSortFields[params.Sort]
+	if !ok {
+		return query, fmt.Errorf("%w: sort must be one of created, name, email, birthday", ErrInvalidListQuery)
+	}
+	query.SortField = field
+
+	params.Order = strings.ToLower(params.Order)
+	switch params.Order {
+	case "", "asc":
+		params.Order = "asc"
+	case "desc":
+		query.Descending = true
+	default:
+		return query, fmt.Errorf("%w: order must be asc or desc", ErrInvalidListQuery)
+	}
+
+	query.Gender = strings.TrimSpace(params.Gender)
+	query.EmailDomain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(params.EmailDomain)), "@")
+	query.NICFlagged = params.NICFlagged
+	query.Deleted = params.Deleted
+
+	var err error
+	if params.BirthdayFrom != "" {
+		if query.BirthdayFrom, err = time.Parse("2006-01-02", params.BirthdayFrom); err != nil {
+			return query, fmt.Errorf("%w: birthday_from must be YYYY-MM-DD", ErrInvalidListQuery)
+		}
+	}
+	if params.BirthdayTo != "" {
+		if query.BirthdayTo, err = time.Parse("2006-01-02", params.BirthdayTo); err != nil {
+			return query, fmt.Errorf("%w: birthday_to must be YYYY-MM-DD", ErrInvalidListQuery)
+		}
+	}
+
+	if params.Cursor != "" {
+		if query.After, err = decodeListCursor(params.Cursor, params.Sort, params.Order); err != nil {
+			return query, err
+		}
+	}
+	return query, nil
+}
+
+func encodeListCursor(params UserListParams, last *model.User) string {
+	cursor := listCursor{Sort: params.Sort, Order: params.Order, ID: last.ID.Hex()}
+	switch params.Sort {
+	case "name":
+		cursor.Value = last.Name
+	case "email":
+		cursor.Value = last.Email
+	case "birthday":
+		cursor.Value = last.Birthday.UTC().Format(time.RFC3339Nano)
+	}
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeListCursor reads a cursor, which must come from a listing with the same sort and order
+func decodeListCursor(encoded, sort, order string) (*repository.UserListPosition, error) {
+	invalid := fmt.Errorf("%w: invalid cursor", ErrInvalidListQuery)
+
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, invalid
+	}
+	var cursor listCursor
+	if err := json.Unmarshal(raw, &cursor); err != nil {
+		return nil, invalid
+	}
+	if cursor.Sort != sort || cursor.Order != order {
+		return nil, fmt.Errorf("%w: cursor belongs to a listing with a different sort or order", ErrInvalidListQuery)
+	}
+	id, err := primitive.ObjectIDFromHex(cursor.ID)
+	if err != nil {
+		return nil, invalid
+	}
+
+	position := &repository.UserListPosition{ID: id, Value: cursor.Value}
+	if sort == "birthday" {
+		birthday, err := time.Parse(time.RFC3339Nano, cursor.Value)
+		if err != nil {
+			return nil, invalid
+		}
+		position.Value = birthday
+	}
+	return position, nil
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	model "go-fiber-app/models"
+	"go-fiber-app/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestListCursorRoundTrip(t *testing.T) {
+	birthday := time.Date(1990, 4, 14, 0, 0, 0, 0, time.UTC)
+	last := &model.User{ID: primitive.NewObjectID(), Name: "Nimal Perera", Email: "nimal@example.com", Birthday: birthday}
+
+	tests := []struct {
+		sort  string
+		order string
+		want  interface{}
+	}{
+		{"created", "asc", ""},
+		{"name", "asc", "Nimal Perera"},
+		{"email", "desc", "nimal@example.com"},
+		{"birthday", "desc", birthday},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sort+" "+tt.order, func(t *testing.T) {
+			encoded := encodeListCursor(UserListParams{Sort: tt.sort, Order: tt.order}, last)
+			position, err := decodeListCursor(encoded, tt.sort, tt.order)
+			if err != nil {
+				t.Fatalf("decodeListCursor() error = %v", err)
+			}
+			if position.ID != last.ID {
+				t.Errorf("cursor ID = %s, want %s", position.ID.Hex(), last.ID.Hex())
+			}
+			if position.Value != tt.want {
+				t.Errorf("cursor value = %#v, want %#v", position.Value, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeListCursorRejects(t *testing.T) {
+	last := &model.User{ID: primitive.NewObjectID(), Name: "Nimal Perera"}
+	byName := encodeListCursor(UserListParams{Sort: "name", Order: "asc"}, last)
+	encode := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+
+	tests := []struct {
+		name    string
+		encoded string
+		sort    string
+		order   string
+	}{
+		{"not base64", "%%%", "name", "asc"},
+		{"not JSON", encode("name"), "name", "asc"},
+		{"another sort", byName, "email", "asc"},
+		{"another order", byName, "name", "desc"},
+		{"bad ID", encode(`{"s":"name","o":"asc","v":"x","id":"42"}`), "name", "asc"},
+		{"bad birthday", encode(`{"s":"birthday","o":"asc","v":"1990","id":"` + last.ID.Hex() + `"}`), "birthday", "asc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeListCursor(tt.encoded, tt.sort, tt.order); !errors.Is(err, ErrInvalidListQuery) {
+				t.Errorf("decodeListCursor() error = %v, want %v", err, ErrInvalidListQuery)
+			}
+		})
+	}
+}
+
+func TestBuildUserListQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  UserListParams
+		want    repository.UserListQuery
+		wantErr bool
+	}{
+		{"defaults", UserListParams{}, repository.UserListQuery{Limit: DefaultUserListLimit, SortField: "_id"}, false},
+		{"descending name", UserListParams{Limit: 5, Sort: "name", Order: "DESC"}, repository.UserListQuery{Limit: 5, SortField: "name", Descending: true}, false},
+		{"email domain", UserListParams{EmailDomain: " @Example.COM "}, repository.UserListQuery{Limit: DefaultUserListLimit, SortField: "_id", EmailDomain: "example.com"}, false},
+		{"limit too large", UserListParams{Limit: MaxUserListLimit + 1}, repository.UserListQuery{}, true},
+		{"negative limit", UserListParams{Limit: -1}, repository.UserListQuery{}, true},
+		{"unknown sort", UserListParams{Sort: "password"}, repository.UserListQuery{}, true},
+		{"unknown order", UserListParams{Order: "up"}, repository.UserListQuery{}, true},
+		{"bad birthday", UserListParams{BirthdayFrom: "14/04/1990"}, repository.UserListQuery{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := buildUserListQuery(&tt.params)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidListQuery) {
+					t.Errorf("buildUserListQuery() error = %v, want %v", err, ErrInvalidListQuery)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("buildUserListQuery() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("buildUserListQuery() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// countResponse answers the aggregation CountDocuments runs
+func countResponse(n int) bson.D {
+	return mtest.CreateCursorResponse(0, "test.users", mtest.FirstBatch, bson.D{{Key: "n", Value: n}})
+}
+
+func TestUserServiceListUsersTieBreak(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	// Two users share a name, so only their IDs tell where the first page ended
+	first := model.User{ID: primitive.NewObjectID(), Name: "Kamal"}
+	second := model.User{ID: primitive.NewObjectID(), Name: "Nimal"}
+	third := model.User{ID: primitive.NewObjectID(), Name: "Nimal"}
+
+	for _, order := range []string{"asc", "desc"} {
+		mt.Run(order, func(mt *mtest.T) {
+			s := NewUserService(repository.NewUserRepository(mt.DB))
+			mt.AddMockResponses(
+				findResponse("users", toDoc(mt.T, first), toDoc(mt.T, second), toDoc(mt.T, third)),
+				countResponse(3),
+			)
+
+			page, err := s.ListUsers(UserListParams{Limit: 2, Sort: "name", Order: order})
+			if err != nil {
+				mt.Fatalf("ListUsers() error = %v", err)
+			}
+			if len(page.Data) != 2 || !page.Pagination.HasMore || page.Pagination.Total != 3 {
+				mt.Fatalf("first page = %d users, pagination %+v", len(page.Data), page.Pagination)
+			}
+			// One extra user is fetched to learn whether another page follows
+			if limit := mt.GetStartedEvent().Command.Lookup("limit").Int64(); limit != 3 {
+				mt.Errorf("find limit = %d, want 3", limit)
+			}
+			mt.ClearEvents()
+
+			mt.AddMockResponses(findResponse("users", toDoc(mt.T, third)), countResponse(3))
+			page, err = s.ListUsers(UserListParams{Limit: 2, Sort: "name", Order: order, Cursor: page.Pagination.NextCursor})
+			if err != nil {
+				mt.Fatalf("ListUsers() with cursor error = %v", err)
+			}
+			if page.Pagination.HasMore || page.Pagination.NextCursor != "" {
+				mt.Errorf("last page pagination = %+v", page.Pagination)
+			}
+
+			find := mt.GetStartedEvent().Command
+			op := "$gt"
+			direction := int32(1)
+			if order == "desc" {
+				op, direction = "$lt", -1
+			}
+			sort := find.Lookup("sort").Document()
+			if keys, _ := sort.Elements(); len(keys) != 2 || keys[0].Key() != "name" || keys[1].Key() != "_id" || keys[1].Value().Int32() != direction {
+				mt.Errorf("sort = %s, want name then _id %d", sort, direction)
+			}
+			// Users after the cursor have a later name, or the same name and a later _id
+			after := find.Lookup("filter", "$and").Array().Index(1).Value().Document().Lookup("$or").Array()
+			if got := after.Index(0).Value().Document().Lookup("name", op).StringValue(); got != "Nimal" {
+				mt.Errorf("value bound = %q, want Nimal", got)
+			}
+			tie := after.Index(1).Value().Document()
+			if tie.Lookup("name").StringValue() != "Nimal" || tie.Lookup("_id", op).ObjectID() != second.ID {
+				mt.Errorf("tie-break = %s, want name Nimal and _id %s %s", tie, op, second.ID.Hex())
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	model "go-fiber-app/models"
+	"go-fiber-app/nic"
+	"strings"
+)
+
+var (
+	ErrInvalidNIC  = errors.New("invalid NIC")
+	ErrNICMismatch = errors.New("details contradict the NIC")
+)
+
+// NICPolicy decides what happens to a user whose birthday or gender contradicts their NIC
+type NICPolicy string
+
+const (
+	NICFlag   NICPolicy = "flag"   // save the user with the contradictions in NICWarnings
+	NICReject NICPolicy = "reject" // refuse to save the user
+)
+
+// SetNICPolicy sets how contradictions between a user's details and their NIC are handled
+func (s *UserService) SetNICPolicy(policy NICPolicy) {
+	s.nicPolicy = policy
+}
+
+// checkNIC validates the user's NIC and compares it with their birthday and gender,
+// rejecting or flagging contradictions according to the NIC policy
+func (s *UserService) checkNIC(user *model.User) error {
+	user.NICWarnings = nil
+	parsed, err := nic.Parse(user.NIC)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidNIC, err)
+	}
+	user.NIC = parsed.Number
+
+	mismatches := parsed.Check(user.Birthday, user.Gender)
+	if len(mismatches) == 0 {
+		return nil
+	}
+	warnings := make([]string, len(mismatches))
+	for i, m := range mismatches {
+		warnings[i] = m.Error()
+	}
+	if s.nicPolicy == NICReject {
+		return fmt.Errorf("%w: %s", ErrNICMismatch, strings.Join(warnings, "; "))
+	}
+	user.NICWarnings = warnings
+	return nil
+}
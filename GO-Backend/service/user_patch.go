@@ -0,0 +1,170 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	model "go-fiber-app/models"
+	"go-fiber-app/repository"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrInvalidPatch is returned for a merge patch that cannot be applied to a user
+var ErrInvalidPatch = errors.New("invalid patch")
+
+// PatchUser applies an RFC 7396 JSON Merge Patch to the user's profile. A null
+// clears the field. Only the fields that actually change are written, and the
+// merged user must still pass model.User.Validate. The user must be at a version
+// ifMatch allows. actor is recorded in the change history. It returns the patched
+// user and the names of the fields that changed.
+func (s *UserService) PatchUser(id, actor primitive.ObjectID, ifMatch IfMatch, patch map[string]json.RawMessage) (*model.User, []string, error) {
+	ctx := context.Background()
+	existing, err := s.userRepo.FindUserByID(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ifMatch.Allows(existing.Version) {
+		return nil, nil, repository.ErrVersionConflict
+	}
+
+	user := *existing
+	if err := applyMergePatch(&user, patch); err != nil {
+		return nil, nil, err
+	}
+	normalizeIdentifiers(&user)
+	if user.Email != existing.Email {
+		// A changed address has to be verified again
+		user.EmailVerified = false
+		user.EmailVerifiedAt = nil
+	}
+	if missing := user.MissingFields(); len(missing) > 0 {
+		return nil, nil, fmt.Errorf("%w: %s cannot be empty", ErrInvalidPatch, strings.Join(missing, ", "))
+	}
+	if err := s.checkNIC(&user); err != nil {
+		return nil, nil, err
+	}
+
+	set, unset, changed := profileChanges(existing, &user)
+	if len(changed) == 0 {
+		return &user, nil, nil
+	}
+	record := s.track(ctx, id, actor)
+	if err := s.userRepo.UpdateUserFields(ctx, id, existing.Version, set, unset); err != nil {
+		return nil, nil, err
+	}
+	user.Version++
+	record(model.UserChange{Action: model.ChangeUpdated})
+	if existing.Photo != "" && user.Photo != existing.Photo {
+		removePhoto(existing.Photo)
+	}
+	s.ReindexUser(id)
+	return &user, changed, nil
+}
+
+// applyMergePatch merges the patch into the user's profile fields. Every profile
+// field is a scalar, so a value replaces the field outright.
+func applyMergePatch(user *model.User, patch map[string]json.RawMessage) error {
+	text := map[string]*string{
+		"name":    &user.Name,
+		"email":   &user.Email,
+		"nic":     &user.NIC,
+		"address": &user.Address,
+		"gender":  &user.Gender,
+	}
+	for field, raw := range patch {
+		isNull := bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+		switch field {
+		case "name", "email", "nic", "address", "gender":
+			if isNull {
+				*text[field] = ""
+			} else if err := json.Unmarshal(raw, text[field]); err != nil {
+				return fmt.Errorf("%w: %s must be a string", ErrInvalidPatch, field)
+			}
+		case "birthday":
+			if isNull {
+				user.Birthday = time.Time{}
+				continue
+			}
+			var value string
+			if err := json.Unmarshal(raw, &value); err != nil {
+				return fmt.Errorf("%w: birthday must be a string in YYYY-MM-DD format", ErrInvalidPatch)
+			}
+			birthday, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				return fmt.Errorf("%w: birthday must be in YYYY-MM-DD format", ErrInvalidPatch)
+			}
+			user.Birthday = birthday
+		case "photo":
+			if !isNull {
+				return fmt.Errorf("%w: photo can only be cleared; upload a new one as multipart form data", ErrInvalidPatch)
+			}
+			user.Photo = ""
+		default:
+			return fmt.Errorf("%w: %s cannot be changed with a patch", ErrInvalidPatch, field)
+		}
+	}
+	return nil
+}
+
+// profileChanges compares the stored user with the patched one and returns the
+// fields to $set and $unset, and the names of the profile fields that changed
+func profileChanges(existing, user *model.User) (bson.M, []string, []string) {
+	set := bson.M{}
+	var unset, changed []string
+
+	fields := []struct {
+		name     string
+		old, new string
+	}{
+		{"name", existing.Name, user.Name},
+		{"email", existing.Email, user.Email},
+		{"nic", existing.NIC, user.NIC},
+		{"address", existing.Address, user.Address},
+		{"gender", existing.Gender, user.Gender},
+		{"photo", existing.Photo, user.Photo},
+	}
+	for _, f := range fields {
+		if f.old == f.new {
+			continue
+		}
+		if f.new == "" {
+			unset = append(unset, f.name)
+		} else {
+			set[f.name] = f.new
+		}
+		changed = append(changed, f.name)
+	}
+	if !existing.Birthday.Equal(user.Birthday) {
+		set["birthday"] = user.Birthday
+		changed = append(changed, "birthday")
+	}
+	if len(changed) == 0 {
+		return set, unset, nil
+	}
+
+	if existing.EmailVerified != user.EmailVerified {
+		set["email_verified"] = user.EmailVerified
+		unset = append(unset, "email_verified_at")
+	}
+	if existing.NICNormalized != user.NICNormalized {
+		if user.NICNormalized != "" {
+			set["nic_normalized"] = user.NICNormalized
+		} else {
+			unset = append(unset, "nic_normalized")
+		}
+	}
+	if strings.Join(existing.NICWarnings, "\n") != strings.Join(user.NICWarnings, "\n") {
+		if len(user.NICWarnings) > 0 {
+			set["nic_warnings"] = user.NICWarnings
+		} else {
+			unset = append(unset, "nic_warnings")
+		}
+	}
+	return set, unset, changed
+}
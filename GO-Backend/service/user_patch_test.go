@@ -0,0 +1,219 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	model "go-fiber-app/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func patchOf(t *testing.T, body string) map[string]json.RawMessage {
+	t.Helper()
+	var patch map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(body), &patch); err != nil {
+		t.Fatal(err)
+	}
+	return patch
+}
+
+func storedUser() model.User {
+	return model.User{
+		Name:          "Nimal Perera",
+		Email:         "nimal@example.com",
+		NIC:           "853400937V",
+		Address:       "12 Galle Road, Colombo",
+		Gender:        "Male",
+		Birthday:      time.Date(1985, time.December, 5, 0, 0, 0, 0, time.UTC),
+		Photo:         "uploads/nimal.jpg",
+		EmailVerified: true,
+	}
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		patch  string
+		want   func(u *model.User)
+		errMsg string
+	}{
+		{
+			name:  "empty patch changes nothing",
+			patch: `{}`,
+			want:  func(u *model.User) {},
+		},
+		{
+			name:  "value replaces the field",
+			patch: `{"name": "Nimal Jayasuriya", "address": "4 Kandy Road"}`,
+			want: func(u *model.User) {
+				u.Name = "Nimal Jayasuriya"
+				u.Address = "4 Kandy Road"
+			},
+		},
+		{
+			name:  "null clears the field",
+			patch: `{"address": null, "gender": null}`,
+			want: func(u *model.User) {
+				u.Address = ""
+				u.Gender = ""
+			},
+		},
+		{
+			name:  "null with whitespace",
+			patch: `{"address":  null }`,
+			want:  func(u *model.User) { u.Address = "" },
+		},
+		{
+			name:  "absent fields are left alone",
+			patch: `{"email": "nimal.p@example.com"}`,
+			want:  func(u *model.User) { u.Email = "nimal.p@example.com" },
+		},
+		{
+			name:  "birthday is parsed",
+			patch: `{"birthday": "1986-01-31"}`,
+			want: func(u *model.User) {
+				u.Birthday = time.Date(1986, time.January, 31, 0, 0, 0, 0, time.UTC)
+			},
+		},
+		{
+			name:  "null birthday clears it",
+			patch: `{"birthday": null}`,
+			want:  func(u *model.User) { u.Birthday = time.Time{} },
+		},
+		{
+			name:  "photo can be cleared",
+			patch: `{"photo": null}`,
+			want:  func(u *model.User) { u.Photo = "" },
+		},
+		{name: "photo cannot be set", patch: `{"photo": "uploads/other.jpg"}`, errMsg: "photo can only be cleared"},
+		{name: "objects do not merge into scalars", patch: `{"name": {"first": "Nimal"}}`, errMsg: "name must be a string"},
+		{name: "numbers are not strings", patch: `{"nic": 853400937}`, errMsg: "nic must be a string"},
+		{name: "birthday in another format", patch: `{"birthday": "05/12/1985"}`, errMsg: "YYYY-MM-DD"},
+		{name: "birthday that is not a string", patch: `{"birthday": 19851205}`, errMsg: "YYYY-MM-DD"},
+		{name: "protected field", patch: `{"role": "admin"}`, errMsg: "role cannot be changed"},
+		{name: "unknown field", patch: `{"nickname": "Nimo"}`, errMsg: "nickname cannot be changed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := storedUser()
+			err := applyMergePatch(&user, patchOf(t, tt.patch))
+			if tt.errMsg != "" {
+				if !errors.Is(err, ErrInvalidPatch) || !strings.Contains(err.Error(), tt.errMsg) {
+					t.Fatalf("applyMergePatch() error = %v, want %v mentioning %q", err, ErrInvalidPatch, tt.errMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyMergePatch() error = %v", err)
+			}
+			want := storedUser()
+			tt.want(&want)
+			if !reflect.DeepEqual(user, want) {
+				t.Errorf("applyMergePatch() = %+v, want %+v", user, want)
+			}
+		})
+	}
+}
+
+func TestProfileChanges(t *testing.T) {
+	tests := []struct {
+		name      string
+		patch     func(u *model.User)
+		wantSet   bson.M
+		wantUnset []string
+		changed   []string
+	}{
+		{
+			name:    "nothing changed",
+			patch:   func(u *model.User) {},
+			wantSet: bson.M{},
+		},
+		{
+			name:    "same value is not a change",
+			patch:   func(u *model.User) { u.Name = "Nimal Perera" },
+			wantSet: bson.M{},
+		},
+		{
+			name:    "changed field is set",
+			patch:   func(u *model.User) { u.Address = "4 Kandy Road" },
+			wantSet: bson.M{"address": "4 Kandy Road"},
+			changed: []string{"address"},
+		},
+		{
+			name:      "cleared field is unset",
+			patch:     func(u *model.User) { u.Gender = ""; u.Photo = "" },
+			wantSet:   bson.M{},
+			wantUnset: []string{"gender", "photo"},
+			changed:   []string{"gender", "photo"},
+		},
+		{
+			name: "birthday",
+			patch: func(u *model.User) {
+				u.Birthday = time.Date(1986, time.January, 31, 0, 0, 0, 0, time.UTC)
+			},
+			wantSet: bson.M{"birthday": time.Date(1986, time.January, 31, 0, 0, 0, 0, time.UTC)},
+			changed: []string{"birthday"},
+		},
+		{
+			name: "new email resets verification",
+			patch: func(u *model.User) {
+				u.Email = "nimal.p@example.com"
+				u.EmailVerified = false
+			},
+			wantSet:   bson.M{"email": "nimal.p@example.com", "email_verified": false},
+			wantUnset: []string{"email_verified_at"},
+			changed:   []string{"email"},
+		},
+		{
+			name: "NIC warnings follow the NIC",
+			patch: func(u *model.User) {
+				u.NIC = "858400937V"
+				u.NICWarnings = []string{"gender does not match the NIC"}
+			},
+			wantSet: bson.M{"nic": "858400937V", "nic_warnings": []string{"gender does not match the NIC"}},
+			changed: []string{"nic"},
+		},
+		{
+			name: "verification alone is not a profile change",
+			patch: func(u *model.User) {
+				u.EmailVerified = false
+			},
+			wantSet: bson.M{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			existing, user := storedUser(), storedUser()
+			tt.patch(&user)
+			set, unset, changed := profileChanges(&existing, &user)
+			sort.Strings(unset)
+			if !reflect.DeepEqual(set, tt.wantSet) {
+				t.Errorf("set = %v, want %v", set, tt.wantSet)
+			}
+			if !reflect.DeepEqual(unset, tt.wantUnset) {
+				t.Errorf("unset = %v, want %v", unset, tt.wantUnset)
+			}
+			if !reflect.DeepEqual(changed, tt.changed) {
+				t.Errorf("changed = %v, want %v", changed, tt.changed)
+			}
+		})
+	}
+}
+
+// The stored NIC warnings are dropped once the NIC and profile agree again
+func TestProfileChangesClearsNICWarnings(t *testing.T) {
+	existing, user := storedUser(), storedUser()
+	existing.Birthday = time.Date(1985, time.December, 6, 0, 0, 0, 0, time.UTC)
+	existing.NICWarnings = []string{"birthday does not match the NIC"}
+
+	_, unset, _ := profileChanges(&existing, &user)
+	if !reflect.DeepEqual(unset, []string{"nic_warnings"}) {
+		t.Errorf("unset = %v, want [nic_warnings]", unset)
+	}
+}
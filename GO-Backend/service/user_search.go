@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	model "go-fiber-app/models"
+	"go-fiber-app/search"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const MaxUserSearchLimit = 50
+
+// UserSearchWeights rank matches in identifying fields above the address
+var UserSearchWeights = map[string]float64{
+	"name":    3,
+	"email":   3,
+	"nic":     3,
+	"phones":  2,
+	"address": 1,
+}
+
+// UserSearchResult is a matching user with its relevance and highlighted fields
+type UserSearchResult struct {
+	User       *model.User       `json:"user"`
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights"`
+}
+
+// SetSearchIndex enables SearchUsers. The index is updated whenever the service changes a user.
+func (s *UserService) SetSearchIndex(index *search.Index) {
+	s.searchIndex = index
+}
+
+// RebuildSearchIndex loads every user and their phone numbers into the search index
+func (s *UserService) RebuildSearchIndex() error {
+	if s.searchIndex == nil {
+		return nil
+	}
+	ctx := context.Background()
+	users, err := s.userRepo.GetAllUsers(ctx)
+	if err != nil {
+		return err
+	}
+	s.attachPhones(ctx, users)
+
+	docs := make([]search.Document, 0, len(users))
+	for _, user := range users {
+		docs = append(docs, userDocument(user))
+	}
+	s.searchIndex.Replace(docs)
+	return nil
+}
+
+// ReindexUser refreshes one user in the search index, e.g. after their phone numbers changed
+func (s *UserService) ReindexUser(id primitive.ObjectID) {
+	if s.searchIndex == nil {
+		return
+	}
+	user, err := s.GetUserWithPhones(id)
+	if err != nil {
+		// Gone or unreadable; a missing entry is better than a stale one
+		s.searchIndex.Delete(id.Hex())
+		return
+	}
+	s.searchIndex.Put(userDocument(user))
+}
+
+// SearchUsers finds users by name, email, NIC, address or phone number, best match first
+func (s *UserService) SearchUsers(query string, limit int) ([]UserSearchResult, error) {
+	if s.searchIndex == nil {
+		return nil, fmt.Errorf("user search is not enabled")
+	}
+	hits := s.searchIndex.Search(query, limit)
+	if len(hits) == 0 {
+		return []UserSearchResult{}, nil
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(hits))
+	for _, hit := range hits {
+		id, err := primitive.ObjectIDFromHex(hit.ID)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	users, err := s.userRepo.FindUsersByIDs(context.Background(), ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*model.User, len(users))
+	for _, user := range users {
+		byID[user.ID.Hex()] = user
+	}
+
+	results := make([]UserSearchResult, 0, len(hits))
+	for _, hit := range hits {
+		user, ok := byID[hit.ID]
+		if !ok {
+			continue // deleted since it was indexed
+		}
+		results = append(results, UserSearchResult{User: user, Score: hit.Score, Highlights: hit.Highlights})
+	}
+	return results, nil
+}
+
+func (s *UserService) unindexUser(id primitive.ObjectID) {
+	if s.searchIndex != nil {
+		s.searchIndex.Delete(id.Hex())
+	}
+}
+
+// userDocument is what the search index knows about a user. Phone numbers are
+// reduced to their digits so "077 123 4567" and "0771234567" match alike.
+func userDocument(user *model.User) search.Document {
+	phones := make([]string, 0, len(user.Phones))
+	for _, phone := range user.Phones {
+		phones = append(phones, strings.Map(func(r rune) rune {
+			if unicode.IsDigit(r) {
+				return r
+			}
+			return -1
+		}, phone.Number))
+	}
+	return search.Document{
+		ID: user.ID.Hex(),
+		Fields: map[string]string{
+			"name":    user.Name,
+			"email":   user.Email,
+			"nic":     user.NIC,
+			"address": user.Address,
+			"phones":  strings.Join(phones, ", "),
+		},
+	}
+}
@@ -2,40 +2,224 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	model "go-fiber-app/models"
+	"go-fiber-app/nic"
+	"go-fiber-app/password"
 	"go-fiber-app/repository"
+	"go-fiber-app/search"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	ErrInvalidRole     = errors.New("unknown role")
+	ErrLastAdmin       = errors.New("cannot revoke the admin role from the last admin")
+	ErrDeleteLastAdmin = errors.New("cannot delete the last admin")
+	ErrMemberRequired  = errors.New("the member role cannot be revoked")
+
+	ErrDeletionNotScheduled = errors.New("account deletion is not scheduled")
+)
+
+// photoDir is where uploaded photos served under /uploads are stored
+const photoDir = "./storage/uploads"
+
 type UserService struct {
-	userRepo  *repository.UserRepository
-	phoneRepo *repository.PhoneRepository
+	userRepo       *repository.UserRepository
+	phoneRepo      *repository.PhoneRepository
+	passwordPolicy *password.Policy
+	passwordHasher *password.Hasher
+	deletionGrace  time.Duration
+	retention      time.Duration
+	searchIndex    *search.Index
+	nicPolicy      NICPolicy
+	sessions       *SessionService
+	transactions   *repository.Transactions
+	history        *repository.UserHistoryRepository
 }
 
 func NewUserService(userRepo *repository.UserRepository) *UserService {
-	return &UserService{userRepo: userRepo}
+	return &UserService{
+		userRepo:       userRepo,
+		passwordPolicy: password.NewPolicy(password.Config{MinLength: 8}, nil),
+		passwordHasher: password.NewHasher(password.Bcrypt{Cost: bcrypt.DefaultCost}),
+		deletionGrace:  30 * 24 * time.Hour,
+		retention:      30 * 24 * time.Hour,
+		nicPolicy:      NICFlag,
+	}
 }
 
 func (s *UserService) SetPhoneRepository(phoneRepo *repository.PhoneRepository) {
 	s.phoneRepo = phoneRepo
 }
 
-func (s *UserService) CreateUser(user *model.User) error {
+func (s *UserService) SetPasswordPolicy(policy *password.Policy) {
+	s.passwordPolicy = policy
+}
+
+func (s *UserService) SetPasswordHasher(hasher *password.Hasher) {
+	s.passwordHasher = hasher
+}
+
+// SetDeletionGracePeriod sets how long a self-service deletion can be cancelled before the data is removed
+func (s *UserService) SetDeletionGracePeriod(grace time.Duration) {
+	s.deletionGrace = grace
+}
+
+// SetDeletedUserRetention sets how long soft-deleted users can be restored before they are purged
+func (s *UserService) SetDeletedUserRetention(retention time.Duration) {
+	s.retention = retention
+}
+
+// SetSessionService lets deleting a user sign them out everywhere
+func (s *UserService) SetSessionService(sessions *SessionService) {
+	s.sessions = sessions
+}
+
+// SetTransactions lets permanent deletes remove the user and their phones in one transaction
+func (s *UserService) SetTransactions(transactions *repository.Transactions) {
+	s.transactions = transactions
+}
+
+// HashPassword hashes a password with the preferred algorithm
+func (s *UserService) HashPassword(pw string) (string, error) {
+	return s.passwordHasher.Hash(pw)
+}
+
+// VerifyPassword checks the user's password, whichever algorithm its hash was made with
+func (s *UserService) VerifyPassword(user *model.User, pw string) bool {
+	matched, err := s.passwordHasher.Verify(pw, user.Password)
+	if err != nil {
+		fmt.Printf("Error verifying password for user %s: %v\n", user.ID.Hex(), err)
+	}
+	return matched
+}
+
+// UpgradePasswordHash re-hashes a just-verified password when its hash uses an
+// old algorithm or weaker parameters than configured
+func (s *UserService) UpgradePasswordHash(user *model.User, pw string) error {
+	if !s.passwordHasher.NeedsRehash(user.Password) {
+		return nil
+	}
+	hash, err := s.passwordHasher.Hash(pw)
+	if err != nil {
+		return err
+	}
+	if err := s.userRepo.ReplacePasswordHash(context.Background(), user.ID, user.Password, hash); err != nil {
+		return err
+	}
+	user.Password = hash
+	return nil
+}
+
+// ValidatePassword checks a password against the policy. userInputs are the
+// user's own details (name, email, NIC), which make a password easy to guess.
+func (s *UserService) ValidatePassword(pw string, userInputs ...string) error {
+	return s.passwordPolicy.Validate(pw, userInputs...)
+}
+
+// CheckNewPassword checks a replacement password against the policy and the user's recent passwords
+func (s *UserService) CheckNewPassword(user *model.User, newPassword string) error {
+	if err := s.passwordPolicy.Validate(newPassword, user.Name, user.Email, user.NIC); err != nil {
+		return err
+	}
+	recent := append([]string{user.Password}, user.PasswordHistory...)
+	return s.passwordPolicy.CheckReuse(newPassword, recent, s.passwordHasher)
+}
+
+// ChangePassword stores a new password that passes CheckNewPassword and records
+// the old hash in the password history. The change history notes that actor
+// changed the password, but never the password itself. It fails with
+// repository.ErrVersionConflict if the user changed since it was read.
+func (s *UserService) ChangePassword(user *model.User, newPassword string, actor primitive.ObjectID) error {
+	if err := s.CheckNewPassword(user, newPassword); err != nil {
+		return err
+	}
+
+	hashedPassword, err := s.passwordHasher.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	record := s.track(ctx, user.ID, actor)
+	// The history holds the passwords before the current one
+	if err := s.userRepo.UpdatePassword(ctx, user.ID, user.Version, hashedPassword, s.passwordPolicy.HistorySize()-1); err != nil {
+		return err
+	}
+	user.Version++
+	record(model.UserChange{Action: model.ChangePasswordChanged, Changes: []model.FieldChange{{Field: "password"}}})
+	return nil
+}
+
+// CreateUser saves a new user on behalf of actor, who is unset when users sign themselves up
+func (s *UserService) CreateUser(user *model.User, actor primitive.ObjectID) error {
+	normalizeIdentifiers(user)
 	if !user.Validate() {
 		return fmt.Errorf("user validation failed")
 	}
+	if err := s.checkNIC(user); err != nil {
+		return err
+	}
+	// New accounts always start out as plain, unverified members
+	user.Roles = []string{model.RoleMember}
+	user.EmailVerified = false
+	user.EmailVerifiedAt = nil
 	ctx := context.Background()
 	if err := s.userRepo.CreateUser(ctx, user); err != nil {
 		return err
 	}
+	s.recordChange(ctx, user.ID, actor, nil, model.UserChange{Action: model.ChangeCreated})
+	s.ReindexUser(user.ID)
 	return nil
 }
 
-func (s *UserService) GetAllUsers() ([]*model.User, error) {
+// CreateExternalUser creates an account for someone signing in through an identity
+// provider, which has already verified the email address. Unlike CreateUser it does
+// not require the profile fields the provider does not supply.
+func (s *UserService) CreateExternalUser(user *model.User) error {
+	normalizeIdentifiers(user)
+	now := time.Now()
+	user.Roles = []string{model.RoleMember}
+	user.EmailVerified = true
+	user.EmailVerifiedAt = &now
 	ctx := context.Background()
-	return s.userRepo.GetAllUsers(ctx)
+	if err := s.userRepo.CreateUser(ctx, user); err != nil {
+		return err
+	}
+	s.recordChange(ctx, user.ID, user.ID, nil, model.UserChange{Action: model.ChangeCreated})
+	s.ReindexUser(user.ID)
+	return nil
+}
+
+// LinkIdentity links an identity provider account to the user, who proved they own
+// it by signing in there. The provider vouched for the email address too, which is
+// what the verification link would have proved, so an unverified email becomes verified.
+func (s *UserService) LinkIdentity(user *model.User, identity model.ExternalIdentity) error {
+	ctx := context.Background()
+	record := s.track(ctx, user.ID, user.ID)
+	if err := s.userRepo.AddIdentity(ctx, user.ID, identity); err != nil {
+		return err
+	}
+	changes := []model.FieldChange{{Field: "identities", To: identity.Issuer}}
+	if !user.EmailVerified {
+		if err := s.userRepo.MarkEmailVerified(ctx, user.ID, user.Email); err != nil {
+			return err
+		}
+		user.EmailVerified = true
+		changes = append(changes, model.FieldChange{Field: "email_verified", From: "false", To: "true"})
+	}
+	user.Identities = append(user.Identities, identity)
+	record(model.UserChange{Action: model.ChangeIdentityLinked, Changes: changes})
+	s.ReindexUser(user.ID)
+	return nil
 }
 
 func (s *UserService) GetUser(id primitive.ObjectID) (*model.User, error) {
@@ -43,6 +227,11 @@ func (s *UserService) GetUser(id primitive.ObjectID) (*model.User, error) {
 	return s.userRepo.FindUserByID(ctx, id)
 }
 
+// GetUserIncludingDeleted finds the user whether or not it was soft-deleted
+func (s *UserService) GetUserIncludingDeleted(id primitive.ObjectID) (*model.User, error) {
+	return s.userRepo.FindUserByIDIncludingDeleted(context.Background(), id)
+}
+
 func (s *UserService) GetUserWithPhones(id primitive.ObjectID) (*model.User, error) {
 	ctx := context.Background()
 	// Get the user
@@ -70,54 +259,349 @@ func (s *UserService) GetUserWithPhones(id primitive.ObjectID) (*model.User, err
 	return user, nil
 }
 
-func (s *UserService) GetAllUsersWithPhones() ([]*model.User, error) {
+// UpdateUser saves the user's profile on behalf of actor
+func (s *UserService) UpdateUser(user *model.User, actor primitive.ObjectID) error {
+	normalizeIdentifiers(user)
+	// Accounts created through OIDC have no NIC until the user adds one
+	if user.NIC != "" {
+		if err := s.checkNIC(user); err != nil {
+			return err
+		}
+	}
 	ctx := context.Background()
-	// Get all users
-	users, err := s.userRepo.GetAllUsers(ctx)
+	record := s.track(ctx, user.ID, actor)
+	if err := s.userRepo.UpdateUser(ctx, user); err != nil {
+		return err
+	}
+	user.Version++
+	record(model.UserChange{Action: model.ChangeUpdated})
+	s.ReindexUser(user.ID)
+	return nil
+}
+
+// normalizeIdentifiers tidies the fields that must be unique, so stray
+// whitespace, case or the NIC format cannot be used to register the same person twice
+func normalizeIdentifiers(user *model.User) {
+	user.Email = strings.TrimSpace(user.Email)
+	user.NIC = strings.ToUpper(strings.TrimSpace(user.NIC))
+	// An invalid NIC is left without a normalized form; checkNIC rejects it where one is required
+	user.NICNormalized, _ = nic.ToNewFormat(user.NIC)
+}
+
+// DeleteUser soft-deletes the user on behalf of actor and signs them out. The
+// user can be restored until the retention period ends and it is purged.
+func (s *UserService) DeleteUser(id, actor primitive.ObjectID, ifMatch IfMatch) error {
+	ctx := context.Background()
+	user, err := s.userRepo.FindUserByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !ifMatch.Allows(user.Version) {
+		return repository.ErrVersionConflict
+	}
+	if err := s.checkNotLastAdmin(ctx, user); err != nil {
+		return err
+	}
+	record := s.track(ctx, id, actor)
+	if err := s.userRepo.SoftDeleteUser(ctx, id, actor, time.Now(), user.Version); err != nil {
+		return err
+	}
+	record(model.UserChange{Action: model.ChangeDeleted})
+	s.unindexUser(id)
+	if s.sessions != nil {
+		if _, err := s.sessions.RevokeAll(id); err != nil {
+			fmt.Printf("Error signing out deleted user %s: %v\n", id.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// checkNotLastAdmin refuses to delete a live user who is the only admin left
+func (s *UserService) checkNotLastAdmin(ctx context.Context, user *model.User) error {
+	if !user.HasRole(model.RoleAdmin) {
+		return nil
+	}
+	admins, err := s.userRepo.CountUsersWithRole(ctx, model.RoleAdmin)
 	if err != nil {
+		return err
+	}
+	if admins <= 1 {
+		return ErrDeleteLastAdmin
+	}
+	return nil
+}
+
+// RestoreUser brings back a soft-deleted user that has not been purged yet, on behalf of actor
+func (s *UserService) RestoreUser(id, actor primitive.ObjectID) (*model.User, error) {
+	ctx := context.Background()
+	record := s.track(ctx, id, actor)
+	if err := s.userRepo.RestoreUser(ctx, id); err != nil {
 		return nil, err
 	}
+	record(model.UserChange{Action: model.ChangeRestored})
+	s.ReindexUser(id)
+	return s.userRepo.FindUserByID(ctx, id)
+}
 
-	// Get phone numbers for each user if phone repository is available
-	if s.phoneRepo != nil {
-		for _, user := range users {
-			phones, err := s.phoneRepo.GetPhonesByUser(ctx, user.ID)
-			if err != nil {
-				// Log the error but don't fail the request
-				fmt.Printf("Error fetching phones for user %s: %v\n", user.ID.Hex(), err)
-				// Initialize empty slice even on error
-				user.Phones = []*model.PhoneNumber{}
-			} else {
-				user.Phones = phones
-			}
+// PurgeDeletedUsers permanently removes the users soft-deleted longer ago than
+// the retention period and returns how many were removed
+func (s *UserService) PurgeDeletedUsers() (int, error) {
+	ctx := context.Background()
+	users, err := s.userRepo.FindUsersDeletedBefore(ctx, time.Now().Add(-s.retention))
+	if err != nil {
+		return 0, err
+	}
+	return s.purgeUsers(ctx, users)
+}
+
+func (s *UserService) GetUserByEmail(email string) (*model.User, error) {
+	ctx := context.Background()
+	return s.userRepo.FindUserByEmail(ctx, email)
+}
+
+// AssignRole gives the user a role on behalf of actor
+func (s *UserService) AssignRole(id primitive.ObjectID, role string, actor primitive.ObjectID) (*model.User, error) {
+	if !model.IsValidRole(role) {
+		return nil, ErrInvalidRole
+	}
+	ctx := context.Background()
+	record := s.track(ctx, id, actor)
+	if err := s.userRepo.AddRole(ctx, id, role); err != nil {
+		return nil, err
+	}
+	record(model.UserChange{Action: model.ChangeRolesChanged})
+	return s.userRepo.FindUserByID(ctx, id)
+}
+
+// RevokeRole takes a role away from the user on behalf of actor
+func (s *UserService) RevokeRole(id primitive.ObjectID, role string, actor primitive.ObjectID) (*model.User, error) {
+	if !model.IsValidRole(role) {
+		return nil, ErrInvalidRole
+	}
+	if role == model.RoleMember {
+		return nil, ErrMemberRequired
+	}
+	ctx := context.Background()
+	if role == model.RoleAdmin {
+		admins, err := s.userRepo.CountUsersWithRole(ctx, model.RoleAdmin)
+		if err != nil {
+			return nil, err
 		}
-	} else {
-		// Initialize empty phones slice for all users if no phone repository
-		for _, user := range users {
-			user.Phones = []*model.PhoneNumber{}
+		user, err := s.userRepo.FindUserByID(ctx, id)
+		if err != nil {
+			return nil, err
 		}
+		if admins <= 1 && user.HasRole(model.RoleAdmin) {
+			return nil, ErrLastAdmin
+		}
+	}
+	record := s.track(ctx, id, actor)
+	if err := s.userRepo.RemoveRole(ctx, id, role); err != nil {
+		return nil, err
 	}
+	record(model.UserChange{Action: model.ChangeRolesChanged})
+	return s.userRepo.FindUserByID(ctx, id)
+}
 
-	return users, nil
+// ScheduleDeletion starts a self-service account deletion. The account keeps
+// working until the grace period ends so the user can change their mind. The
+// only admin left cannot leave, or nobody would be able to manage users. It fails
+// with ErrVersionConflict if the user changed since it was read.
+func (s *UserService) ScheduleDeletion(user *model.User) (*time.Time, error) {
+	if user.DeletionScheduledAt != nil {
+		return user.DeletionScheduledAt, nil
+	}
+	ctx := context.Background()
+	if err := s.checkNotLastAdmin(ctx, user); err != nil {
+		return nil, err
+	}
+	at := time.Now().Add(s.deletionGrace)
+	record := s.track(ctx, user.ID, user.ID)
+	if err := s.userRepo.SetDeletionScheduledAt(ctx, user.ID, user.Version, &at); err != nil {
+		return nil, err
+	}
+	record(model.UserChange{Action: model.ChangeDeletionScheduled})
+	user.DeletionScheduledAt = &at
+	user.Version++
+	return &at, nil
 }
 
-func (s *UserService) UpdateUser(user *model.User) error {
+// CancelDeletion keeps an account whose deletion is still in its grace period
+func (s *UserService) CancelDeletion(user *model.User) error {
+	if user.DeletionScheduledAt == nil {
+		return ErrDeletionNotScheduled
+	}
 	ctx := context.Background()
-	if err := s.userRepo.UpdateUser(ctx, user); err != nil {
+	record := s.track(ctx, user.ID, user.ID)
+	if err := s.userRepo.SetDeletionScheduledAt(ctx, user.ID, user.Version, nil); err != nil {
 		return err
 	}
+	record(model.UserChange{Action: model.ChangeDeletionCancelled})
+	user.DeletionScheduledAt = nil
+	user.Version++
 	return nil
 }
 
-func (s *UserService) DeleteUser(id primitive.ObjectID) error {
+// PurgeScheduledDeletions removes the accounts whose grace period has ended,
+// together with their phone numbers and photo, and returns how many were removed
+func (s *UserService) PurgeScheduledDeletions() (int, error) {
 	ctx := context.Background()
-	if err := s.userRepo.DeleteUser(ctx, id); err != nil {
-		return err
+	users, err := s.userRepo.FindUsersDueForDeletion(ctx, time.Now())
+	if err != nil {
+		return 0, err
 	}
-	return nil
+	return s.purgeUsers(ctx, users)
 }
 
-func (s *UserService) GetUserByEmail(email string) (*model.User, error) {
+// purgeUsers permanently removes the users with their phone numbers and photos.
+// A user that cannot be removed, such as the last admin, is skipped so the rest
+// still go; the errors are returned together once every user has been tried.
+func (s *UserService) purgeUsers(ctx context.Context, users []*model.User) (int, error) {
+	purged := 0
+	var errs []error
+	for _, user := range users {
+		if _, err := s.PurgeUser(user.ID, nil); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				continue // purged by someone else in the meantime
+			}
+			fmt.Printf("Error purging user %s: %v\n", user.ID.Hex(), err)
+			errs = append(errs, fmt.Errorf("error purging user %s: %w", user.ID.Hex(), err))
+			continue
+		}
+		purged++
+	}
+	return purged, errors.Join(errs...)
+}
+
+// DeletionResult reports what permanently deleting a user removed
+type DeletionResult struct {
+	UserID        primitive.ObjectID `json:"user_id"`
+	Phones        int64              `json:"phones_removed"`
+	Photo         bool               `json:"photo_removed"`
+	Transactional bool               `json:"transactional"` // false when CleanupOrphans finishes a delete that failed part way
+}
+
+// PurgeUser permanently deletes a user, live or soft-deleted, together with their
+// phone numbers, photo and change history. The user and phones are removed in one transaction where
+// the deployment supports it. Otherwise the user goes first, so whatever a failure
+// leaves behind is orphaned and removed by CleanupOrphans. The user must be at a
+// version ifMatch allows.
+func (s *UserService) PurgeUser(id primitive.ObjectID, ifMatch IfMatch) (*DeletionResult, error) {
+	user, err := s.userRepo.FindUserByIDIncludingDeleted(context.Background(), id)
+	if err != nil {
+		return nil, err
+	}
+	if !ifMatch.Allows(user.Version) {
+		return nil, repository.ErrVersionConflict
+	}
+	// Soft-deleted users no longer count as admins and can always be purged
+	if user.DeletedAt == nil {
+		if err := s.checkNotLastAdmin(context.Background(), user); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &DeletionResult{UserID: id, Transactional: s.transactions.Supported()}
+	photo := ""
+	err = s.transactions.Run(context.Background(), func(ctx context.Context) error {
+		deleted, err := s.userRepo.DeleteUser(ctx, id, user.Version)
+		if err != nil {
+			return err
+		}
+		photo = deleted.Photo
+		if s.phoneRepo != nil {
+			if result.Phones, err = s.phoneRepo.DeletePhonesByUser(ctx, id); err != nil {
+				return err
+			}
+		}
+		// The history holds copies of the personal data being removed
+		if s.history != nil {
+			if _, err := s.history.DeleteChanges(ctx, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Files cannot take part in the transaction, so the photo goes once it has committed
+	result.Photo = removePhoto(photo)
+	s.unindexUser(id)
+	return result, nil
+}
+
+// orphanPhotoAge keeps CleanupOrphans away from photos uploaded for a user that is still being saved
+const orphanPhotoAge = time.Hour
+
+// uploadedPhotoName matches the names photo uploads are saved under, "<unix time>_<original name>"
+// with an image extension, so CleanupOrphans leaves any other file in photoDir alone
+var uploadedPhotoName = regexp.MustCompile(`^[0-9]+_.+\.(jpg|jpeg|png|gif)$`)
+
+// CleanupOrphans removes phone numbers and change history whose user no longer exists
+// and uploaded photos no user refers to, left behind by deletes that failed part way
+func (s *UserService) CleanupOrphans() (phones int64, photos int, err error) {
 	ctx := context.Background()
-	return s.userRepo.FindUserByEmail(ctx, email)
+	if s.phoneRepo != nil {
+		if phones, err = s.phoneRepo.DeleteOrphanedPhones(ctx); err != nil {
+			return 0, 0, err
+		}
+	}
+	if s.history != nil {
+		if _, err = s.history.DeleteOrphanedChanges(ctx); err != nil {
+			return phones, 0, err
+		}
+	}
+
+	referenced, err := s.userRepo.FindPhotos(ctx)
+	if err != nil {
+		return phones, 0, err
+	}
+	inUse := make(map[string]bool, len(referenced))
+	for _, photo := range referenced {
+		inUse[filepath.Base(photo)] = true
+	}
+
+	entries, err := os.ReadDir(photoDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return phones, 0, nil
+		}
+		return phones, 0, fmt.Errorf("error reading %s: %w", photoDir, err)
+	}
+	cutoff := time.Now().Add(-orphanPhotoAge)
+	for _, entry := range entries {
+		if entry.IsDir() || !uploadedPhotoName.MatchString(entry.Name()) || inUse[entry.Name()] {
+			continue
+		}
+		if info, err := entry.Info(); err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if removePhoto("/uploads/" + entry.Name()) {
+			photos++
+		}
+	}
+	return phones, photos, nil
+}
+
+// DiscardPhoto deletes an uploaded photo that could not be saved to a user
+func (s *UserService) DiscardPhoto(photo string) {
+	removePhoto(photo)
+}
+
+// removePhoto deletes an uploaded photo file and reports whether it did.
+// A missing file is not an error.
+func removePhoto(photo string) bool {
+	if !strings.HasPrefix(photo, "/uploads/") {
+		return false
+	}
+	path := filepath.Join(photoDir, filepath.Base(photo))
+	if err := os.Remove(path); err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Printf("Error removing photo %s: %v\n", path, err)
+		}
+		return false
+	}
+	return true
 }
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	model "go-fiber-app/models"
+	"go-fiber-app/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestUserServicePurgeScheduledDeletions(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	due := time.Now().Add(-time.Hour)
+	admin := model.User{ID: primitive.NewObjectID(), Roles: []string{model.RoleAdmin}, DeletionScheduledAt: &due}
+	member := model.User{ID: primitive.NewObjectID(), Roles: []string{model.RoleMember}, DeletionScheduledAt: &due}
+	gone := model.User{ID: primitive.NewObjectID(), DeletionScheduledAt: &due}
+
+	mt.Run("skips users it cannot purge and carries on", func(mt *mtest.T) {
+		s := NewUserService(repository.NewUserRepository(mt.DB))
+		mt.AddMockResponses(
+			findResponse("users", toDoc(mt.T, admin), toDoc(mt.T, gone), toDoc(mt.T, member)),
+			findResponse("users", toDoc(mt.T, admin)),
+			countResponse(1),      // the only admin left
+			findResponse("users"), // purged by someone else in the meantime
+			findResponse("users", toDoc(mt.T, member)),
+			mtest.CreateSuccessResponse(bson.E{Key: "value", Value: toDoc(mt.T, member)}),
+		)
+
+		purged, err := s.PurgeScheduledDeletions()
+		if purged != 1 {
+			mt.Errorf("PurgeScheduledDeletions() purged %d, want 1", purged)
+		}
+		if !errors.Is(err, ErrDeleteLastAdmin) {
+			mt.Fatalf("PurgeScheduledDeletions() error = %v, want %v", err, ErrDeleteLastAdmin)
+		}
+		if errors.Is(err, repository.ErrVersionConflict) {
+			mt.Errorf("PurgeScheduledDeletions() error = %v reports a user that was skipped silently", err)
+		}
+		deleted := commandsNamed(mt, "findAndModify")
+		if len(deleted) != 1 || deleted[0].Lookup("query", "_id").ObjectID() != member.ID {
+			mt.Errorf("deleted %d users, want only %s", len(deleted), member.ID.Hex())
+		}
+	})
+}
+
+func TestUserServiceScheduleDeletion(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	admin := model.User{ID: primitive.NewObjectID(), Roles: []string{model.RoleAdmin, model.RoleMember}, Version: 5}
+
+	mt.Run("the last admin cannot leave", func(mt *mtest.T) {
+		s := NewUserService(repository.NewUserRepository(mt.DB))
+		mt.AddMockResponses(countResponse(1))
+
+		user := admin
+		if _, err := s.ScheduleDeletion(&user); !errors.Is(err, ErrDeleteLastAdmin) {
+			mt.Fatalf("ScheduleDeletion() error = %v, want %v", err, ErrDeleteLastAdmin)
+		}
+		if user.DeletionScheduledAt != nil || len(commandsNamed(mt, "update")) != 0 {
+			mt.Errorf("deletion of the last admin was scheduled")
+		}
+	})
+
+	mt.Run("an admin can leave while another remains", func(mt *mtest.T) {
+		s := NewUserService(repository.NewUserRepository(mt.DB))
+		mt.AddMockResponses(countResponse(2), updateResponse(1))
+
+		user := admin
+		at, err := s.ScheduleDeletion(&user)
+		if err != nil {
+			mt.Fatalf("ScheduleDeletion() error = %v", err)
+		}
+		if at == nil || user.DeletionScheduledAt != at {
+			mt.Errorf("ScheduleDeletion() = %v, user scheduled at %v", at, user.DeletionScheduledAt)
+		}
+		if version := updateFilter(commandsNamed(mt, "update")[0]).Lookup("version").Int64(); version != admin.Version {
+			mt.Errorf("update expects version %d, want %d", version, admin.Version)
+		}
+		if user.Version != admin.Version+1 {
+			mt.Errorf("user version = %d, want %d", user.Version, admin.Version+1)
+		}
+	})
+
+	mt.Run("a user changed since it was read", func(mt *mtest.T) {
+		s := NewUserService(repository.NewUserRepository(mt.DB))
+		member := model.User{ID: primitive.NewObjectID(), Roles: []string{model.RoleMember}, Version: 2}
+		mt.AddMockResponses(updateResponse(0), countResponse(1))
+
+		if _, err := s.ScheduleDeletion(&member); !errors.Is(err, repository.ErrVersionConflict) {
+			mt.Errorf("ScheduleDeletion() error = %v, want %v", err, repository.ErrVersionConflict)
+		}
+		if member.DeletionScheduledAt != nil {
+			mt.Errorf("deletion scheduled despite the conflict")
+		}
+	})
+}
+
+func TestUploadedPhotoName(t *testing.T) {
+	tests := map[string]bool{
+		"1752041076_download.png":  true,
+		"1752041076_my photo.jpeg": true,
+		"1752041076_download.PNG":  false,
+		"download.png":             false,
+		"_download.png":            false,
+		"1752041076_notes.txt":     false,
+		".gitkeep":                 false,
+		"README.md":                false,
+	}
+	for name, want := range tests {
+		if got := uploadedPhotoName.MatchString(name); got != want {
+			t.Errorf("uploadedPhotoName.MatchString(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestNormalizeIdentifiers(t *testing.T) {
+	tests := []struct {
+		nic, wantNIC, wantNormalized string
+	}{
+		{" 853400937v ", "853400937V", "198534000937"},
+		{"198534000937", "198534000937", "198534000937"},
+		{"not a NIC", "NOT A NIC", ""},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		user := &model.User{Email: " nimal@example.com ", NIC: tt.nic}
+		normalizeIdentifiers(user)
+		if user.Email != "nimal@example.com" || user.NIC != tt.wantNIC || user.NICNormalized != tt.wantNormalized {
+			t.Errorf("normalizeIdentifiers(%q) = %q, %q, %q", tt.nic, user.Email, user.NIC, user.NICNormalized)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package service
+
+// IfMatch holds the versions a conditional request accepts, from its If-Match
+// header. A nil IfMatch accepts any version.
+type IfMatch []int64
+
+// Allows reports whether a record at the given version may be changed
+func (m IfMatch) Allows(version int64) bool {
+	if m == nil {
+		return true
+	}
+	for _, v := range m {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
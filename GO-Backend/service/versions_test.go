@@ -0,0 +1,22 @@
+package service
+
+import "testing"
+
+func TestIfMatchAllows(t *testing.T) {
+	tests := []struct {
+		name    string
+		ifMatch IfMatch
+		version int64
+		want    bool
+	}{
+		{"any version", nil, 7, true},
+		{"listed version", IfMatch{3, 7}, 7, true},
+		{"unlisted version", IfMatch{3, 6}, 7, false},
+		{"no usable tags", IfMatch{}, 0, false},
+	}
+	for _, tt := range tests {
+		if got := tt.ifMatch.Allows(tt.version); got != tt.want {
+			t.Errorf("%s: %v.Allows(%d) = %v, want %v", tt.name, tt.ifMatch, tt.version, got, tt.want)
+		}
+	}
+}
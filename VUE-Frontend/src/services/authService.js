@@ -1,8 +1,12 @@
+import axios from 'axios'
+
 const API_BASE_URL = 'http://localhost:8080/api'
 
 class AuthService {
   constructor() {
     this.token = localStorage.getItem('token')
+    this.refreshToken = localStorage.getItem('refreshToken')
+    this.refreshPromise = null
   }
 
   async login(email, password) {
@@ -37,8 +41,7 @@ class AuthService {
       console.log('Login successful, data:', data)
       
       if (data.token) {
-        this.token = data.token
-        localStorage.setItem('token', data.token)
+        this.setTokens(data)
         localStorage.setItem('user', JSON.stringify(data.user || { email }))
         return data
       } else {
@@ -50,9 +53,55 @@ class AuthService {
     }
   }
 
+  setTokens(data) {
+    this.token = data.token
+    localStorage.setItem('token', data.token)
+    if (data.refresh_token) {
+      this.refreshToken = data.refresh_token
+      localStorage.setItem('refreshToken', data.refresh_token)
+    }
+  }
+
+  // Exchange the refresh token for a new access token.
+  // Concurrent callers share the same in-flight request.
+  refresh() {
+    if (!this.refreshToken) {
+      return Promise.reject(new Error('No refresh token'))
+    }
+    if (!this.refreshPromise) {
+      this.refreshPromise = fetch(`${API_BASE_URL}/auth/refresh`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ refresh_token: this.refreshToken })
+      })
+        .then(async (response) => {
+          if (!response.ok) {
+            throw new Error('Session expired')
+          }
+          const data = await response.json()
+          this.setTokens(data)
+          return data.token
+        })
+        .finally(() => {
+          this.refreshPromise = null
+        })
+    }
+    return this.refreshPromise
+  }
+
   logout() {
+    if (this.refreshToken) {
+      // Best effort - the local session is cleared either way
+      fetch(`${API_BASE_URL}/auth/logout`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ refresh_token: this.refreshToken })
+      }).catch(() => {})
+    }
     this.token = null
+    this.refreshToken = null
     localStorage.removeItem('token')
+    localStorage.removeItem('refreshToken')
     localStorage.removeItem('user')
   }
 
@@ -69,6 +118,13 @@ class AuthService {
     return user ? JSON.parse(user) : null
   }
 
+  // Load the signed-in user's profile from the token instead of a stored ID
+  async fetchMe() {
+    const response = await axios.get(`${API_BASE_URL}/auth/me`, { headers: this.getAuthHeaders() })
+    localStorage.setItem('user', JSON.stringify(response.data))
+    return response.data
+  }
+
   // Add authorization header to requests
   getAuthHeaders() {
     return {
@@ -78,4 +134,26 @@ class AuthService {
   }
 }
 
-export default new AuthService()
+const authService = new AuthService()
+
+// Retry requests that failed with 401 once after refreshing the access token
+axios.interceptors.response.use(
+  (response) => response,
+  async (error) => {
+    const original = error.config
+    if (error.response?.status === 401 && original && !original._retried && authService.refreshToken) {
+      original._retried = true
+      try {
+        const token = await authService.refresh()
+        original.headers = { ...original.headers, Authorization: `Bearer ${token}` }
+        return axios(original)
+      } catch {
+        authService.logout()
+        window.location.href = '/login'
+      }
+    }
+    return Promise.reject(error)
+  }
+)
+
+export default authService
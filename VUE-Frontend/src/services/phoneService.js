@@ -9,7 +9,14 @@ const getAuthHeaders = () => {
   return token ? { Authorization: `Bearer ${token}` } : {}
 }
 
+// Updates and deletes send the phone's version as If-Match (412 when it changed since)
+const ifMatch = (version) => ({ 'If-Match': `"${version}"` })
+
 export const getPhonesByUser = (userId) => axios.get(`${API_URL}/users/${userId}/phones`, { headers: getAuthHeaders() })
 export const createPhone = (userId, data) => axios.post(`${API_URL}/users/${userId}/phones`, data, { headers: getAuthHeaders() })
-export const updatePhone = (userId, phoneId, data) => axios.put(`${API_URL}/users/${userId}/phones/${phoneId}`, data, { headers: getAuthHeaders() })
-export const deletePhone = (userId, phoneId) => axios.delete(`${API_URL}/users/${userId}/phones/${phoneId}`, { headers: getAuthHeaders() })
+export const updatePhone = (userId, phoneId, data) => axios.put(`${API_URL}/users/${userId}/phones/${phoneId}`, data, {
+  headers: { ...getAuthHeaders(), ...ifMatch(data.version) }
+})
+export const deletePhone = (userId, phoneId, version) => axios.delete(`${API_URL}/users/${userId}/phones/${phoneId}`, {
+  headers: { ...getAuthHeaders(), ...ifMatch(version) }
+})
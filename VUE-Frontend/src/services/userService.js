@@ -9,8 +9,14 @@ const getAuthHeaders = () => {
   return token ? { Authorization: `Bearer ${token}` } : {}
 }
 
-export const getUsers = () => axios.get(API_URL, { headers: getAuthHeaders() })
-export const getUsersWithPhones = () => axios.get(`${API_URL}/with-phones`, { headers: getAuthHeaders() })
+// Writes to an existing user send the version they were based on as If-Match;
+// the API answers 412 with the current user when it has changed since
+const ifMatch = (version) => ({ 'If-Match': `"${version}"` })
+
+// Listings are paged: the response is { data, pagination } and pagination.next_cursor
+// (passed back as params.cursor) fetches the next page
+export const getUsers = (params = {}) => axios.get(API_URL, { headers: getAuthHeaders(), params })
+export const getUsersWithPhones = (params = {}) => axios.get(`${API_URL}/with-phones`, { headers: getAuthHeaders(), params })
 export const getUser = (id) => axios.get(`${API_URL}/${id}`, { headers: getAuthHeaders() })
 export const createUser = (data) => axios.post(API_URL, data, { headers: getAuthHeaders() })
 export const createUserWithPhoto = (formData) => {
@@ -21,13 +27,41 @@ export const createUserWithPhoto = (formData) => {
     }
   })
 }
-export const updateUser = (id, data) => axios.put(`${API_URL}/${id}`, data, { headers: getAuthHeaders() })
-export const updateUserWithPhoto = (id, formData) => {
+export const updateUser = (id, data, version) => axios.put(`${API_URL}/${id}`, data, {
+  headers: { ...getAuthHeaders(), ...ifMatch(version) }
+})
+export const updateUserWithPhoto = (id, formData, version) => {
   return axios.put(`${API_URL}/${id}`, formData, {
     headers: {
       ...getAuthHeaders(),
+      ...ifMatch(version),
       'Content-Type': 'multipart/form-data'
     }
   })
 }
-export const deleteUser = (id) => axios.delete(`${API_URL}/${id}`, { headers: getAuthHeaders() })
+// RFC 7396 merge patch: only the fields sent change, and null clears a field
+export const patchUser = (id, patch, version) => axios.patch(`${API_URL}/${id}`, patch, {
+  headers: {
+    ...getAuthHeaders(),
+    ...ifMatch(version),
+    'Content-Type': 'application/merge-patch+json'
+  }
+})
+export const deleteUser = (id, version) => axios.delete(`${API_URL}/${id}`, {
+  headers: { ...getAuthHeaders(), ...ifMatch(version) }
+})
+// Bulk import from a .csv or .xlsx file. mapping names the column to read each field from;
+// a dry run only reports per-row errors, otherwise the answer is a job to poll with getImportJob
+export const importUsers = (file, { mapping, dryRun = false } = {}) => {
+  const formData = new FormData()
+  formData.append('file', file)
+  if (mapping) formData.append('mapping', JSON.stringify(mapping))
+  return axios.post(`${API_URL}/import`, formData, {
+    headers: {
+      ...getAuthHeaders(),
+      'Content-Type': 'multipart/form-data'
+    },
+    params: { dry_run: dryRun }
+  })
+}
+export const getImportJob = (jobId) => axios.get(`${API_URL}/import/${jobId}`, { headers: getAuthHeaders() })